@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 
 	"github.com/gorilla/mux"
 )
 
-// HandleAdd adds a Command
+// HandleAdd adds a Command and returns it
 func (a *App) HandleAdd(w http.ResponseWriter, r *http.Request) {
 
 	// Get variables from the request
@@ -22,126 +21,113 @@ func (a *App) HandleAdd(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
 		return
 	}
 
 	_, err = os.Stat(variables.WorkingDirectory)
 	if os.IsNotExist(err) {
 		a.DmnLogFile.Log.Println("Invalid working directory")
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "Invalid working directory")
+		writeError(w, http.StatusUnprocessableEntity, "invalid working directory: "+variables.WorkingDirectory, nil)
 		return
 	}
 
-	// Select the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 400
 	testCmd := new(Command)
 
 	testCmd.Set(variables.Command, variables.Description, variables.WorkingDirectory)
 
+	// The Command goes in the library of the user, or in the team library if asked for
+	testCmd.Owner = user.Name
+	testCmd.Shared = r.URL.Query().Get("library") == "team"
+
 	a.DmnLogFile.Log.Printf("Adding command: " + testCmd.CmdHash)
 
-	if a.SaveCmd(*testCmd) != true {
-		w.WriteHeader(http.StatusBadRequest)
-		out, _ := json.Marshal("false")
-		io.WriteString(w, string(out))
-		return
+	// The same command string can only be saved once in each working directory of the
+	// libraries of the user
+	if cmds, err := a.History.ReadCmdHistoryFile(); err == nil {
+		for _, c := range cmds {
+			if testCmd.duplicates(c) {
+				a.writeFailure(w, http.StatusConflict, "Unable to add command", ErrDuplicateCommand)
+				return
+			}
+		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	out, _ := json.Marshal("true")
-	io.WriteString(w, string(out))
-}
-
-// SaveCmd writes a dmn.Command to the history file
-func (a *App) SaveCmd(cmd Command) bool {
-
-	// Do some validation of the command
-	_, err := os.Stat(cmd.WorkingDirectory)
-	if os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Invalid working directory\n")
-		return false
+	if a.SaveCmd(*testCmd) != true {
+		a.DmnLogFile.Log.Printf("Unable to add command %v\n", testCmd.CmdHash)
+		writeError(w, http.StatusInternalServerError, "unable to add command", nil)
+		return
 	}
 
-	// Check if the file does not exist. If not, then create it and add our first dmn.Command to it.
-	f, err := os.Open(a.History.Path)
+	a.audit(r, user, AuditEntry{Action: AuditAdd, CmdHash: testCmd.CmdHash, After: testCmd})
 
-	// Immediately close the file since we plan to write to it
-	f.Close()
+	out, err := json.Marshal(testCmd)
 
-	// Check if the file doesn't exist and if so, then write it.
 	if err != nil {
-		// The array of dmn.Commands
-		var cmds []Command
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
 
-		cmds = append(cmds, cmd)
+	io.WriteString(w, string(out))
+}
 
-		mode := int(0644)
+// SaveCmd writes a dmn.Command to the history file and adds it to the search index
+func (a *App) SaveCmd(cmd Command) bool {
 
-		updatedData, _ := json.MarshalIndent(cmds, "", "\t")
+	// Commands that were not created with Set don't have an ID yet
+	if cmd.ID == "" {
+		cmd.ID = newUUID()
+	}
 
-		error := ioutil.WriteFile(a.History.Path, updatedData, os.FileMode(mode))
+	if cmd.CmdHash == "" {
+		cmd.CmdHash = hashFromID(cmd.ID)
+	}
 
-		return error == nil
+	if !a.writeCmd(cmd) {
+		return false
 	}
 
-	// Update the Command in the history file
+	a.syncCmd(cmd, "Add")
 
-	// The array of dmn.Commands
-	var cmds []Command
+	return true
+}
 
-	// Read history file
-	data, err := ioutil.ReadFile(a.History.Path)
+// writeCmd adds a dmn.Command to the history file
+func (a *App) writeCmd(cmd Command) bool {
 
-	// An error occured while reading historyFile.
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+	// Do some validation of the command
+	_, err := os.Stat(cmd.WorkingDirectory)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Invalid working directory\n")
 		return false
 	}
 
-	// No data in file, write our Command to it
-	if len(data) == 0 {
-		cmds = append(cmds, cmd)
-		updatedData, _ := json.MarshalIndent(cmds, "", "\t")
-		mode := int(0644)
-		error := ioutil.WriteFile(a.History.Path, updatedData, os.FileMode(mode))
-		return error == nil
-	}
-	if err := json.Unmarshal(data, &cmds); err != nil {
-		fmt.Fprintf(os.Stderr, "JSON unmarshalling failed: %s\n", err)
-		return false
-	}
+	err = a.History.Modify(func(cmds []Command) ([]Command, error) {
 
-	// Check if the dmn.Command hash alaready exists, and prevent the user from adding the same Command
-	for _, c := range cmds {
-		if c.CmdHash == cmd.CmdHash {
-			// c.Duration = cmd.Duration
-			fmt.Fprintf(os.Stderr, "dmn.Command hash already exists: %s\n", cmd.CmdString)
-			//break
-			return false
+		// Check if the dmn.Command hash alaready exists, and prevent the user from adding the same Command.
+		// The same command string can be saved more than once as long as the working directories
+		// or the libraries differ.
+		for _, c := range cmds {
+			if c.CmdHash == cmd.CmdHash || c.ID == cmd.ID || cmd.duplicates(c) {
+				fmt.Fprintf(os.Stderr, "dmn.Command hash already exists: %s\n", cmd.CmdString)
+				return nil, ErrDuplicateCommand
+			}
 		}
-	}
 
-	cmds = append(cmds, cmd)
-
-	// Convert the struct to JSON
-	updatedData, updatedDataErr := json.MarshalIndent(cmds, "", "\t")
+		return append(cmds, cmd), nil
+	})
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", updatedDataErr)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
 
-	mode := int(0644)
-
-	error := ioutil.WriteFile(a.History.Path, updatedData, os.FileMode(mode))
-
-	return error == nil
-
+	return err == nil
 }
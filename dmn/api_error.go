@@ -0,0 +1,125 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrorCode is the machine readable reason in an error response. Each status has one code.
+type ErrorCode string
+
+const (
+	// CodeBadRequest means that the request is malformed, such as a route variable that is
+	// not base64 encoded or a body that is not valid JSON
+	CodeBadRequest ErrorCode = "bad_request"
+
+	// CodeUnauthorized means that the secret, token or client certificate is not valid
+	CodeUnauthorized ErrorCode = "unauthorized"
+
+	// CodeForbidden means that the user is not allowed to do what was asked
+	CodeForbidden ErrorCode = "forbidden"
+
+	// CodeNotFound means that a Command, run, schedule, pipeline, user or token doesn't exist
+	CodeNotFound ErrorCode = "not_found"
+
+	// CodeConflict means that the request conflicts with the current state, such as a
+	// Command that already exists or a prefix that matches several Commands
+	CodeConflict ErrorCode = "conflict"
+
+	// CodeTooLarge means that the body of the request is too large
+	CodeTooLarge ErrorCode = "too_large"
+
+	// CodeURITooLong means that the path of the request is too long
+	CodeURITooLong ErrorCode = "uri_too_long"
+
+	// CodeInvalid means that the request is well formed but a value in it is not valid
+	CodeInvalid ErrorCode = "invalid"
+
+	// CodeRateLimited means that the client made too many requests
+	CodeRateLimited ErrorCode = "rate_limited"
+
+	// CodeInternal means that the daemon failed, for instance to read or write a file
+	CodeInternal ErrorCode = "internal"
+
+	// CodeBadGateway means that a remote, such as the git repository of the library, failed
+	CodeBadGateway ErrorCode = "bad_gateway"
+)
+
+// statusCodes maps the status of an error response to its code
+var statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusRequestURITooLong:     CodeURITooLong,
+	http.StatusUnprocessableEntity:   CodeInvalid,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusBadGateway:            CodeBadGateway,
+}
+
+// APIError is the error in the body of every failed request. Details holds more about the
+// error where there is more to say, such as the candidates of an ambiguous prefix.
+type APIError struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError writes a status along with an error body. The code is decided by the status.
+func writeError(w http.ResponseWriter, status int, message string, details interface{}) {
+
+	code, ok := statusCodes[status]
+
+	if !ok {
+		code = CodeInternal
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	out, _ := json.Marshal(ErrorResponse{Error: APIError{Code: code, Message: message, Details: details}})
+	io.WriteString(w, string(out))
+}
+
+// writeVariablesError writes status 400 for route variables that could not be decoded
+func writeVariablesError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, "route variables must be base64 encoded: "+err.Error(), nil)
+}
+
+// errorStatus returns the status for an error: 404 for something that doesn't exist, 409
+// for a conflict with the current state, or status for any other error
+func errorStatus(err error, status int) int {
+
+	for _, notFound := range []error{ErrCommandNotFound, ErrRunNotFound, ErrScheduleNotFound, ErrPipelineNotFound, ErrUserNotFound, ErrTokenNotFound} {
+		if errors.Is(err, notFound) {
+			return http.StatusNotFound
+		}
+	}
+
+	for _, conflict := range []error{ErrAlreadyQueued, ErrDuplicateCommand, ErrUserExists, ErrSyncDisabled} {
+		if errors.Is(err, conflict) {
+			return http.StatusConflict
+		}
+	}
+
+	return status
+}
+
+// writeFailure logs why a request failed and writes the error response. status is used
+// unless the error says that something doesn't exist or conflicts, see errorStatus.
+func (a *App) writeFailure(w http.ResponseWriter, status int, message string, err error) {
+
+	a.DmnLogFile.Log.Printf("%v: %v\n", message, err)
+
+	writeError(w, errorStatus(err, status), message+": "+err.Error(), nil)
+}
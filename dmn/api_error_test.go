@@ -0,0 +1,64 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("%w: 42", ErrRunNotFound), http.StatusNotFound},
+		{ErrScheduleNotFound, http.StatusNotFound},
+		{ErrDuplicateCommand, http.StatusConflict},
+		{fmt.Errorf("add: %w", ErrUserExists), http.StatusConflict},
+		{errors.New("disk is full"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		if status := errorStatus(test.err, http.StatusInternalServerError); status != test.status {
+			t.Errorf("Expected status %v for %v but got %v", test.status, test.err, status)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+
+	writeError(recorder, http.StatusConflict, "prefix is ambiguous", ambiguousDetails{Candidates: []Command{{CmdHash: "abcd1"}}})
+
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 but got %v", recorder.Code)
+	}
+
+	var response struct {
+		Error struct {
+			Code    ErrorCode        `json:"code"`
+			Message string           `json:"message"`
+			Details ambiguousDetails `json:"details"`
+		} `json:"error"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Error.Code != CodeConflict || response.Error.Message != "prefix is ambiguous" || len(response.Error.Details.Candidates) != 1 {
+		t.Errorf("Unexpected error response %v", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	writeError(recorder, http.StatusTeapot, "short and stout", nil)
+
+	if recorder.Body.String() != `{"error":{"code":"internal","message":"short and stout"}}` {
+		t.Errorf("Expected an unknown status to have the internal code but got %v", recorder.Body.String())
+	}
+}
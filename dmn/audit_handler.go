@@ -0,0 +1,133 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// auditVerification is the body returned when the audit log is verified. Error is set
+// if the chain is broken, and Entries is the number of entries that were verified.
+type auditVerification struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	Error   string `json:"error,omitempty"`
+}
+
+// routeTemplate returns the method and the route of a request. The route is used instead
+// of the path so that the secret or token in the path is not recorded.
+func routeTemplate(r *http.Request) string {
+
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+
+	return r.Method
+}
+
+// audit records an action of the user in the audit log. Failing to write the audit log is
+// logged but does not fail the request.
+func (a *App) audit(r *http.Request, user User, e AuditEntry) {
+
+	e.User = user.Name
+	e.From = remoteAddr(r)
+	e.Route = routeTemplate(r)
+
+	if _, err := a.Audit.Append(e); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to write the audit log: %v\n", err)
+	}
+}
+
+// HandleAudit returns the entries of the audit log, oldest first. They can be selected by
+// the query parameters in ParseAuditQuery. Only admins can read the audit log.
+func (a *App) HandleAudit(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	if _, ok := a.authorize(w, r, variables, ManageUsers); !ok {
+		return
+	}
+
+	query, err := ParseAuditQuery(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid audit query", err)
+		return
+	}
+
+	entries, err := a.Audit.Query(query)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read the audit log", err)
+		return
+	}
+
+	out, err := json.Marshal(entries)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleVerifyAudit checks the hash chain of the audit log. Status 200 is returned whether
+// or not the chain is intact; valid is false if an entry was changed or removed. Only
+// admins can verify the audit log.
+func (a *App) HandleVerifyAudit(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	if _, ok := a.authorize(w, r, variables, ManageUsers); !ok {
+		return
+	}
+
+	count, err := a.Audit.Verify()
+
+	result := auditVerification{Valid: err == nil, Entries: count}
+
+	var chainErr *AuditChainError
+
+	if err != nil && !errors.As(err, &chainErr) {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read the audit log", err)
+		return
+	}
+
+	if err != nil {
+		a.DmnLogFile.Log.Println(err)
+		result.Error = err.Error()
+	}
+
+	out, _ := json.Marshal(result)
+	io.WriteString(w, string(out))
+}
@@ -0,0 +1,426 @@
+package dmn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The audit log
+	recmdAuditFile = "recmd_audit.log"
+
+	// The sequence number and hash of the last entry of the audit log
+	recmdAuditHeadFile = "recmd_audit.head"
+)
+
+// AuditAction names an action recorded in the audit log
+type AuditAction string
+
+const (
+	// AuditAdd records that a Command was added
+	AuditAdd AuditAction = "add"
+
+	// AuditUpdate records that a Command or one of its settings was changed
+	AuditUpdate AuditAction = "update"
+
+	// AuditDelete records that a Command was deleted
+	AuditDelete AuditAction = "delete"
+
+	// AuditRun records that a Command ran, or was set to run later
+	AuditRun AuditAction = "run"
+
+	// AuditCancel records that a run was cancelled
+	AuditCancel AuditAction = "cancel"
+
+	// AuditSchedule records that a schedule was added, paused, resumed or deleted
+	AuditSchedule AuditAction = "schedule"
+
+	// AuditPipeline records that a pipeline was added, deleted or run
+	AuditPipeline AuditAction = "pipeline"
+
+	// AuditImport records that a library or shell history was imported
+	AuditImport AuditAction = "import"
+
+	// AuditSync records that the library was synchronised
+	AuditSync AuditAction = "sync"
+
+	// AuditUser records that a user, their role or their tokens were changed
+	AuditUser AuditAction = "user"
+
+	// AuditDenied records that a user was not allowed to do something
+	AuditDenied AuditAction = "denied"
+)
+
+// AuditEntry represents an entry of the audit log. Before and After are the state of the
+// Command before and after an edit. Hash is the SHA256 hash of the entry as it is stored
+// in the audit log, which includes the hash of the previous entry, so changing or
+// removing an entry breaks the chain.
+type AuditEntry struct {
+	Seq      int         `json:"seq"`
+	Time     time.Time   `json:"time"`
+	User     string      `json:"user"`
+	From     string      `json:"from"`
+	Action   AuditAction `json:"action"`
+	Route    string      `json:"route,omitempty"`
+	CmdHash  string      `json:"commandHash,omitempty"`
+	RunID    string      `json:"runId,omitempty"`
+	Detail   string      `json:"detail,omitempty"`
+	Before   *Command    `json:"before,omitempty"`
+	After    *Command    `json:"after,omitempty"`
+	PrevHash string      `json:"prevHash"`
+	Hash     string      `json:"hash"`
+
+	// The line of the audit log that the entry was read from
+	line []byte
+}
+
+// auditHead is the sequence number and hash of the last entry of the audit log. It is
+// kept apart from the audit log so that removing entries from the end is noticed.
+type auditHead struct {
+	Seq  int    `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditQuery selects entries of the audit log. Empty fields select every entry.
+type AuditQuery struct {
+	Since   time.Time
+	Until   time.Time
+	CmdHash string
+	User    string
+	Action  AuditAction
+}
+
+// AuditChainError is returned when the hash chain of the audit log is broken
+type AuditChainError struct {
+	Seq    int
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit log is broken at entry %v: %v", e.Seq, e.Reason)
+}
+
+// lineHash returns the hash of a line of the audit log, with the hash of the entry in it
+// left empty. The stored line is hashed rather than the entry, so that fields added to
+// AuditEntry or Command later don't change the hash of entries that were already written.
+func lineHash(line []byte, hash string) string {
+
+	field := []byte(`"hash":"` + hash + `"`)
+
+	// The hash is the last field of the entry
+	if index := bytes.LastIndex(line, field); index >= 0 {
+		line = append(append(append([]byte{}, line[:index]...), `"hash":""`...), line[index+len(field):]...)
+	}
+
+	sum := sha256.Sum256(line)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAuditQuery reads an AuditQuery from the query parameters since, until, cmdHash, user
+// and action. since and until are RFC 3339 timestamps.
+func ParseAuditQuery(query url.Values) (AuditQuery, error) {
+
+	var q AuditQuery
+
+	for key, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := query.Get(key); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+
+			if err != nil {
+				return q, fmt.Errorf("invalid %v: %v", key, value)
+			}
+
+			*t = parsed
+		}
+	}
+
+	q.CmdHash = query.Get("cmdHash")
+	q.User = query.Get("user")
+	q.Action = AuditAction(query.Get("action"))
+
+	return q, nil
+}
+
+// match returns true if the entry is selected by the query. A Command matches by a
+// prefix of its hash.
+func (q AuditQuery) match(e AuditEntry) bool {
+
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+
+	if q.CmdHash != "" && (e.CmdHash == "" || !strings.HasPrefix(e.CmdHash, q.CmdHash)) {
+		return false
+	}
+
+	if q.User != "" && e.User != q.User {
+		return false
+	}
+
+	return q.Action == "" || e.Action == q.Action
+}
+
+// AuditFile represents the audit log. Entries are appended as JSON lines and the file is
+// never truncated. The last entry is also recorded in the head file.
+type AuditFile struct {
+	Path     string
+	HeadPath string
+	mutex    sync.Mutex
+	seq      int
+	lastHash string
+}
+
+// Set sets the path to the audit log and its head file
+func (f *AuditFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdAuditFile)
+	f.HeadPath = filepath.Join(path, recmdAuditHeadFile)
+}
+
+// Remove removes the audit log and its head file
+func (f *AuditFile) Remove() {
+	os.Remove(f.Path)
+	os.Remove(f.HeadPath)
+}
+
+// Open reads the last entry of the audit log so that new entries continue the chain. If
+// entries were removed from the end, the chain continues from the head file instead, so
+// that the gap is still found by Verify.
+func (f *AuditFile) Open() error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.seq = 0
+	f.lastHash = ""
+
+	entries, err := f.read()
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		f.seq = last.Seq
+		f.lastHash = last.Hash
+	}
+
+	head, err := f.readHead()
+
+	if err != nil {
+		return err
+	}
+
+	if head.Seq > f.seq {
+		f.seq = head.Seq
+		f.lastHash = head.Hash
+	}
+
+	return nil
+}
+
+// readHead reads the head file. If it doesn't exist, nothing was recorded yet. The caller
+// must hold the mutex.
+func (f *AuditFile) readHead() (auditHead, error) {
+
+	var head auditHead
+
+	data, err := ioutil.ReadFile(f.HeadPath)
+
+	if os.IsNotExist(err) {
+		return head, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &head)
+	}
+
+	return head, err
+}
+
+// writeHead replaces the head file. The caller must hold the mutex.
+func (f *AuditFile) writeHead(head auditHead) error {
+
+	data, err := json.Marshal(head)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := f.HeadPath + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, os.FileMode(0600)); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.HeadPath)
+}
+
+// read reads every entry of the audit log. The caller must hold the mutex.
+func (f *AuditFile) read() ([]AuditEntry, error) {
+
+	entries := []AuditEntry{}
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e AuditEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("entry %v: %v", len(entries)+1, err)
+		}
+
+		e.line = append([]byte{}, scanner.Bytes()...)
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Append numbers the entry, chains it to the previous one and appends it to the audit log
+func (f *AuditFile) Append(e AuditEntry) (AuditEntry, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	e.Seq = f.seq + 1
+	e.PrevHash = f.lastHash
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	e.Hash = ""
+
+	data, err := json.Marshal(e)
+
+	if err != nil {
+		return e, err
+	}
+
+	e.Hash = lineHash(data, "")
+
+	if data, err = json.Marshal(e); err != nil {
+		return e, err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.FileMode(0600))
+
+	if err != nil {
+		return e, err
+	}
+
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return e, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return e, err
+	}
+
+	f.seq = e.Seq
+	f.lastHash = e.Hash
+
+	return e, f.writeHead(auditHead{Seq: e.Seq, Hash: e.Hash})
+}
+
+// Query returns the entries selected by the query, oldest first
+func (f *AuditFile) Query(q AuditQuery) ([]AuditEntry, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries, err := f.read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []AuditEntry{}
+
+	for _, e := range entries {
+		if q.match(e) {
+			ret = append(ret, e)
+		}
+	}
+
+	return ret, nil
+}
+
+// Verify checks the hash chain of the audit log and returns the number of entries. An
+// AuditChainError is returned for the first entry that was changed, removed or reordered,
+// or if the last entries recorded in the head file were removed.
+func (f *AuditFile) Verify() (int, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries, err := f.read()
+
+	if err != nil {
+		return 0, err
+	}
+
+	prevHash := ""
+
+	for index, e := range entries {
+		switch {
+		case e.Seq != index+1:
+			return index, &AuditChainError{Seq: index + 1, Reason: fmt.Sprintf("found entry %v", e.Seq)}
+		case e.PrevHash != prevHash:
+			return index, &AuditChainError{Seq: e.Seq, Reason: "previous hash does not match"}
+		case lineHash(e.line, e.Hash) != e.Hash:
+			return index, &AuditChainError{Seq: e.Seq, Reason: "hash does not match"}
+		}
+
+		prevHash = e.Hash
+	}
+
+	head, err := f.readHead()
+
+	if err != nil {
+		return len(entries), err
+	}
+
+	switch {
+	case head.Seq > len(entries):
+		return len(entries), &AuditChainError{Seq: len(entries) + 1, Reason: fmt.Sprintf("entries up to %v were removed", head.Seq)}
+	case head.Seq > 0 && entries[head.Seq-1].Hash != head.Hash:
+		return len(entries), &AuditChainError{Seq: head.Seq, Reason: "hash does not match the head file"}
+	}
+
+	return len(entries), nil
+}
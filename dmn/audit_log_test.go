@@ -0,0 +1,140 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditChain(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	start := time.Now().Add(-time.Minute)
+
+	before := Command{CmdHash: "abc123", CmdString: "ls"}
+	after := Command{CmdHash: "abc123", CmdString: "ls -l"}
+
+	entries := []AuditEntry{
+		{User: "alice", Action: AuditAdd, CmdHash: "abc123", After: &before, Time: start},
+		{User: "alice", Action: AuditUpdate, CmdHash: "abc123", Before: &before, After: &after},
+		{User: "bob", Action: AuditRun, CmdHash: "def456", RunID: "1"},
+	}
+
+	for _, e := range entries {
+		if _, err := app.Audit.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	selected, err := app.Audit.Query(AuditQuery{CmdHash: "abc"})
+
+	if err != nil || len(selected) != 2 {
+		t.Fatalf("Expected 2 entries for the command but got %v: %v", len(selected), err)
+	}
+
+	if selected[1].Before.CmdString != "ls" || selected[1].After.CmdString != "ls -l" {
+		t.Errorf("Expected the state before and after the edit but got %v", selected[1])
+	}
+
+	selected, _ = app.Audit.Query(AuditQuery{Since: start.Add(time.Second)})
+
+	if len(selected) != 2 {
+		t.Errorf("Expected 2 entries since the start but got %v", len(selected))
+	}
+
+	// Reopening the audit log continues the chain
+	if err := app.Audit.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := app.Audit.Append(AuditEntry{User: "bob", Action: AuditDelete, CmdHash: "def456"})
+
+	if err != nil || last.Seq != 4 {
+		t.Fatalf("Expected entry 4 but got %v: %v", last.Seq, err)
+	}
+
+	if count, err := app.Audit.Verify(); err != nil || count != 4 {
+		t.Fatalf("Expected 4 verified entries but got %v: %v", count, err)
+	}
+
+	// Entries written with fields that Command doesn't have still verify
+	line := fmt.Sprintf(`{"seq":5,"time":"%v","user":"bob","action":"add","cmdHash":"ghi789","after":{"cmdHash":"ghi789","removed":true},"prevHash":"%v","hash":""}`,
+		time.Now().Format(time.RFC3339Nano), last.Hash)
+	line = strings.Replace(line, `"hash":""`, `"hash":"`+lineHash([]byte(line), "")+`"`, 1)
+
+	data, _ := ioutil.ReadFile(app.Audit.Path)
+
+	if err := ioutil.WriteFile(app.Audit.Path, append(data, line+"\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := app.Audit.Verify(); err != nil || count != 5 {
+		t.Fatalf("Expected 5 verified entries but got %v: %v", count, err)
+	}
+
+	// Removing entries from the end is found through the head file
+	lines := strings.SplitAfter(string(data), "\n")
+	truncated := strings.Join(lines[:2], "")
+
+	if err := ioutil.WriteFile(app.Audit.Path, []byte(truncated), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.Audit.Verify()
+
+	var chainErr *AuditChainError
+
+	if !errors.As(err, &chainErr) || chainErr.Seq != 3 {
+		t.Errorf("Expected entries to be missing from entry 3 but got %v", err)
+	}
+
+	// Reopening the truncated audit log keeps the gap
+	if err := app.Audit.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if next, err := app.Audit.Append(AuditEntry{User: "bob", Action: AuditRun, CmdHash: "def456"}); err != nil || next.Seq != 5 {
+		t.Errorf("Expected entry 5 but got %v: %v", next.Seq, err)
+	}
+
+	if _, err := app.Audit.Verify(); err == nil {
+		t.Errorf("Expected the gap to break the chain")
+	}
+
+	// Changing an entry breaks the chain
+	if err := ioutil.WriteFile(app.Audit.Path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"user":"bob"`, `"user":"eve"`, 1)
+
+	if err := ioutil.WriteFile(app.Audit.Path, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.Audit.Verify()
+
+	if !errors.As(err, &chainErr) || chainErr.Seq != 3 {
+		t.Errorf("Expected the chain to be broken at entry 3 but got %v", err)
+	}
+}
+
+func TestParseAuditQuery(t *testing.T) {
+
+	q, err := ParseAuditQuery(map[string][]string{"since": {"2020-01-02T03:04:05Z"}, "action": {"run"}})
+
+	if err != nil || q.Since.Year() != 2020 || q.Action != AuditRun {
+		t.Errorf("Unexpected query %v: %v", q, err)
+	}
+
+	if _, err := ParseAuditQuery(map[string][]string{"until": {"yesterday"}}); err == nil {
+		t.Errorf("Expected an invalid time to be rejected")
+	}
+}
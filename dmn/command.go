@@ -25,31 +25,91 @@ const (
 
 	// Failed means that the command failed
 	Failed CommandStatus = "Failed"
+
+	// Cancelled means that the command was cancelled before it completed
+	Cancelled CommandStatus = "Cancelled"
 )
 
-// Command represents a command and optionally a description to document what the command does
+// Command represents a command and optionally a description to document what the command does.
+// ID is a UUID that identifies the Command. CmdHash is the short handle used by the API: for
+// new Commands it is the first 15 hex digits of the ID, while Commands that were saved before
+// they had an ID keep the SHA1 based hash of their command string.
+// Folder is a path such as ops/db; the root folder is empty. A Command is in the library of
+// its Owner, or in the team library if it is Shared.
+// RunID, RunAt, RunBy and Position are only set on Commands in the queue. RunBy is the user
+// who started the run; it is empty for runs started by a schedule. Commands with a higher
+// Priority run first. Attempt is the number of the attempt of a run, starting at 1. Retries
+// have their own run ID and are linked to the original run with ParentRunID.
 type Command struct {
-	CmdHash          string        `json:"commandHash"`
-	CmdString        string        `json:"commandString"`
-	Description      string        `json:"description"`
-	Duration         time.Duration `json:"duration"`
-	WorkingDirectory string        `json:"workingDirectory"`
-	Status           CommandStatus `json:"status"`
+	ID               string            `json:"id"`
+	CmdHash          string            `json:"commandHash"`
+	CmdString        string            `json:"commandString"`
+	Description      string            `json:"description"`
+	Tags             []string          `json:"tags"`
+	Folder           string            `json:"folder"`
+	Owner            string            `json:"owner"`
+	Shared           bool              `json:"shared"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+	Duration         time.Duration     `json:"duration"`
+	LastRunAt        *time.Time        `json:"lastRunAt,omitempty"`
+	RunCount         int               `json:"runCount"`
+	WorkingDirectory string            `json:"workingDirectory"`
+	Status           CommandStatus     `json:"status"`
+	ExecSettings     ExecSettings      `json:"execSettings"`
+	Sandbox          SandboxSettings   `json:"sandbox"`
+	Retry            RetryPolicy       `json:"retry"`
+	Concurrency      ConcurrencyPolicy `json:"concurrency"`
+	Priority         int               `json:"priority"`
+	RunID            string            `json:"runId,omitempty"`
+	RunAt            *time.Time        `json:"runAt,omitempty"`
+	RunBy            string            `json:"runBy,omitempty"`
+	Position         int               `json:"position,omitempty"`
+	Attempt          int               `json:"attempt,omitempty"`
+	ParentRunID      string            `json:"parentRunId,omitempty"`
 }
 
-// Set sets the fields of a new Command
+// Set sets the fields of a new Command and gives it a new ID
 func (cmd *Command) Set(cmdString string, cmdComment string, workingDirectory string) {
 
-	formattedHash := func() string {
-		h := sha1.New()
-		h.Write([]byte(cmdString))
-		return fmt.Sprintf("%.15x", h.Sum(nil))
-	}()
-
-	cmd.CmdHash = formattedHash
+	cmd.ID = newUUID()
+	cmd.CmdHash = hashFromID(cmd.ID)
 	cmd.CmdString = strings.Trim(cmdString, "")
 	cmd.Description = strings.Trim(cmdComment, "")
 	cmd.WorkingDirectory = strings.Trim(workingDirectory, "")
 	cmd.Duration = -1
 	cmd.Status = Idle
+	cmd.Tags = []string{}
+	cmd.Owner = defaultOwner()
+	cmd.CreatedAt = time.Now()
+	cmd.UpdatedAt = cmd.CreatedAt
+}
+
+// matches returns true if value is a prefix of the CmdHash or the ID of the Command
+func (cmd Command) matches(value string) bool {
+	return strings.HasPrefix(cmd.CmdHash, value) || (cmd.ID != "" && strings.HasPrefix(cmd.ID, value))
+}
+
+// sameAs returns true if other runs the same command string in the same working directory
+func (cmd Command) sameAs(other Command) bool {
+	return cmd.CmdString == other.CmdString && cmd.WorkingDirectory == other.WorkingDirectory
+}
+
+// duplicates returns true if other is the same as cmd and is in the library of the owner
+// of cmd or in the team library. Users can save the same command in their own libraries.
+func (cmd Command) duplicates(other Command) bool {
+	return cmd.sameAs(other) && (other.Shared || other.Owner == cmd.Owner)
+}
+
+// hashFromID returns the CmdHash of a Command with the given ID
+func hashFromID(id string) string {
+	return strings.Replace(id, "-", "", -1)[:15]
+}
+
+// legacyHash returns the CmdHash that Commands saved before they had an ID were given,
+// which is derived from the command string
+func legacyHash(cmdString string) string {
+	h := sha1.New()
+	h.Write([]byte(cmdString))
+	return fmt.Sprintf("%.15x", h.Sum(nil))
 }
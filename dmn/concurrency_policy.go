@@ -0,0 +1,117 @@
+package dmn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ConcurrencyPolicy decides what happens when a Command is run while it is already queued or running
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent queues another run behind the existing ones. Since the scheduler
+	// runs one Command at a time, the runs do not overlap. This is the default.
+	AllowConcurrent ConcurrencyPolicy = "allow"
+
+	// ForbidConcurrent rejects the new run
+	ForbidConcurrent ConcurrencyPolicy = "forbid"
+
+	// CoalesceConcurrent merges the new run into a run that has not started yet. The caller
+	// receives the result of that run. If every run has started, a new run is queued.
+	CoalesceConcurrent ConcurrencyPolicy = "coalesce"
+
+	// ReplaceConcurrent cancels the existing runs and queues the new one
+	ReplaceConcurrent ConcurrencyPolicy = "replace"
+)
+
+// ErrAlreadyQueued is returned when a ForbidConcurrent Command is already queued or running
+var ErrAlreadyQueued = errors.New("command is already queued or running")
+
+// Validate checks that the policy is known
+func (p ConcurrencyPolicy) Validate() error {
+
+	switch p {
+	case "", AllowConcurrent, ForbidConcurrent, CoalesceConcurrent, ReplaceConcurrent:
+		return nil
+	}
+
+	return fmt.Errorf("invalid concurrency policy %q", p)
+}
+
+// activeRuns returns the queued Commands with the given hash that are scheduled or
+// running and were not cancelled. The caller must hold queueMutex.
+func (s *Scheduler) activeRuns(cmdHash string) []Command {
+
+	var active []Command
+
+	for _, cmd := range s.Runs.Active(cmdHash) {
+		if !s.cancelled[cmd.RunID] {
+			active = append(active, cmd)
+		}
+	}
+
+	return active
+}
+
+// cancelRun cancels a queued run. A run that is still waiting is skipped by the
+// scheduler, while a running one is killed. The caller must hold queueMutex.
+func (s *Scheduler) cancelRun(runID string) bool {
+
+	cmd, ok := s.Runs.Find(runID)
+
+	if !ok {
+		return false
+	}
+
+	switch cmd.Status {
+	case Scheduled:
+		s.cancelled[runID] = true
+
+		if retrying, ok := s.retrying[runID]; ok {
+			retrying.timer.Stop()
+			delete(s.retrying, runID)
+			s.requeue(retrying.run)
+		}
+
+		return true
+	case Running:
+		if cancel, ok := s.cancels[runID]; ok {
+			cancel()
+			return true
+		}
+	}
+
+	return false
+}
+
+// startRun is called by the scheduler when it takes a run off the CommandQueue. It returns
+// false if the run was cancelled while it was waiting.
+func (s *Scheduler) startRun(runID string) (context.Context, bool) {
+
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	if s.cancelled[runID] {
+		delete(s.cancelled, runID)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.cancels[runID] = cancel
+
+	return ctx, true
+}
+
+// finishRun releases the context of a run
+func (s *Scheduler) finishRun(runID string) {
+
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	if cancel, ok := s.cancels[runID]; ok {
+		cancel()
+		delete(s.cancels, runID)
+	}
+}
@@ -0,0 +1,93 @@
+package dmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleConcurrencyPolicy sets the concurrency policy of a Command
+func (a *App) HandleConcurrencyPolicy(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	policy := ConcurrencyPolicy(variables.ConcurrencyPolicy)
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	updatedCmd, err := a.UpdateCommandConcurrencyPolicy(selectedCmd.CmdHash, policy)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to update concurrency policy", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, CmdHash: updatedCmd.CmdHash, Detail: "concurrency policy", Before: &selectedCmd, After: &updatedCmd})
+
+	out, err := json.Marshal(updatedCmd)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// UpdateCommandConcurrencyPolicy validates the concurrency policy and stores it with the Command
+func (a *App) UpdateCommandConcurrencyPolicy(value string, policy ConcurrencyPolicy) (Command, error) {
+
+	if err := policy.Validate(); err != nil {
+		return Command{}, err
+	}
+
+	selectedCmd, err := a.SelectCmd(value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Updating concurrency policy for %v\n", selectedCmd.CmdHash)
+
+	return a.History.UpdateCmd(selectedCmd.CmdHash, func(cmd *Command) {
+		cmd.Concurrency = policy
+	})
+}
@@ -0,0 +1,182 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForQueuedStatus waits until a Command with the given hash has the given status in the queue
+func waitForQueuedStatus(t *testing.T, app *App, cmdHash string, status CommandStatus) {
+
+	for i := 0; i < 100; i++ {
+		for _, cmd := range app.CommandScheduler.Runs.Snapshot() {
+			if cmd.CmdHash == cmdHash && cmd.Status == status {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("Command %v never reached status %v", cmdHash, status)
+}
+
+func startTestScheduler(t *testing.T) *App {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	app.CreateScheduler()
+
+	go app.RunScheduler()
+	go app.QueuedCommandsCleanup()
+
+	return &app
+}
+
+func TestConcurrencyPolicyAllow(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	var cmd Command
+	cmd.Set("sleep 0.2", "sleep", ".")
+	cmd.Concurrency = AllowConcurrent
+
+	results := make(chan ScheduledCommand, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			sc, _ := app.RunCmd(cmd)
+			results <- sc
+		}()
+	}
+
+	first, second := <-results, <-results
+
+	if first.Status != Completed || second.Status != Completed {
+		t.Fatalf("Expected both runs to complete but got %v and %v", first.Status, second.Status)
+	}
+
+	// The second run is queued behind the first one instead of running alongside it
+	if second.StartTime.Before(first.EndTime) {
+		t.Errorf("Expected the runs not to overlap but the second started at %v before the first ended at %v", second.StartTime, first.EndTime)
+	}
+}
+
+func TestConcurrencyPolicyForbid(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	var cmd Command
+	cmd.Set("sleep 1", "sleep", ".")
+	cmd.Concurrency = ForbidConcurrent
+
+	go app.RunCmd(cmd)
+
+	waitForQueuedStatus(t, app, cmd.CmdHash, Running)
+
+	if _, err := app.RunCmd(cmd); err != ErrAlreadyQueued {
+		t.Errorf("Expected duplicate run to be rejected but got %v", err)
+	}
+}
+
+func TestConcurrencyPolicyReplace(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	var cmd Command
+	cmd.Set("sleep 5", "sleep", ".")
+	cmd.Concurrency = ReplaceConcurrent
+
+	first := make(chan ScheduledCommand)
+
+	go func() {
+		sc, _ := app.RunCmd(cmd)
+		first <- sc
+	}()
+
+	waitForQueuedStatus(t, app, cmd.CmdHash, Running)
+
+	go app.RunCmd(cmd)
+
+	select {
+	case sc := <-first:
+		if sc.Status != Cancelled {
+			t.Errorf("Expected the first run to be cancelled but got %v", sc.Status)
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("The first run was not replaced")
+	}
+}
+
+func TestConcurrencyPolicyCoalesce(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	// Keep the scheduler busy so that the next run stays scheduled
+	var busy Command
+	busy.Set("sleep 1", "busy", ".")
+
+	go app.RunCmd(busy)
+
+	waitForQueuedStatus(t, app, busy.CmdHash, Running)
+
+	var cmd Command
+	cmd.Set("echo coalesced", "echo", ".")
+	cmd.Concurrency = CoalesceConcurrent
+
+	first := make(chan ScheduledCommand)
+
+	go func() {
+		sc, _ := app.RunCmd(cmd)
+		first <- sc
+	}()
+
+	waitForQueuedStatus(t, app, cmd.CmdHash, Scheduled)
+
+	second, err := app.RunCmd(cmd)
+
+	if err != nil {
+		t.Fatalf("Unable to run command: %v", err)
+	}
+
+	sc := <-first
+
+	if second.RunID != sc.RunID || second.Status != Completed {
+		t.Errorf("Expected the runs to be coalesced but got %v and %v", sc.RunID, second.RunID)
+	}
+}
+
+func TestCancelQueuedRun(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	var cmd Command
+	cmd.Set("sleep 5", "sleep", ".")
+	cmd.RunID = newID()
+
+	done := make(chan ScheduledCommand)
+
+	go func() {
+		sc, _ := app.RunCmd(cmd)
+		done <- sc
+	}()
+
+	waitForQueuedStatus(t, app, cmd.CmdHash, Running)
+
+	if _, err := app.CancelQueuedRun(cmd.RunID); err != nil {
+		t.Fatalf("Unable to cancel run: %v", err)
+	}
+
+	if sc := <-done; sc.Status != Cancelled {
+		t.Errorf("Expected the run to be cancelled but got %v", sc.Status)
+	}
+
+	if _, err := app.CancelQueuedRun(newID()); err == nil {
+		t.Errorf("Cancelled a run that does not exist")
+	}
+}
@@ -0,0 +1,158 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// The configuration file
+	recmdConfigFile = "recmd_config.json"
+
+	// DefaultQueueRetention is how long finished runs stay in the queue
+	DefaultQueueRetention = 3 * time.Second
+
+	// DefaultMaxStoredOutputs is the number of past runs whose output is kept
+	DefaultMaxStoredOutputs = 1000
+
+	// DefaultRequestsPerSecond is the rate at which a client can make requests
+	DefaultRequestsPerSecond = 20
+
+	// DefaultBurst is the number of requests a client can make at once
+	DefaultBurst = 100
+
+	// DefaultMaxConcurrentRuns is the number of runs a client can wait for at once
+	DefaultMaxConcurrentRuns = 8
+
+	// DefaultMaxPathLength is the longest path and query of a request, in bytes
+	DefaultMaxPathLength = 64 << 10
+
+	// DefaultMaxSegmentLength is the longest segment of the path of a request, in bytes
+	DefaultMaxSegmentLength = 32 << 10
+)
+
+// Config represents the settings of the daemon. Durations are strings such as 30s or 5m.
+type Config struct {
+	QueueRetention   string       `json:"queueRetention"`
+	MaxStoredOutputs int          `json:"maxStoredOutputs"`
+	HistoryBlocklist []string     `json:"historyBlocklist"`
+	Sync             SyncConfig   `json:"sync"`
+	TLS              TLSConfig    `json:"tls"`
+	Limits           LimitsConfig `json:"limits"`
+}
+
+// SyncConfig configures the git repository that the command library is synchronised
+// with. Synchronisation is enabled when Remote is set.
+type SyncConfig struct {
+	Remote string `json:"remote"`
+	Branch string `json:"branch"`
+}
+
+// TLSConfig configures HTTPS. Without CertFile and KeyFile a self-signed certificate is
+// created in the conf directory. If ClientCAFile is set, clients can authenticate with a
+// certificate signed by one of its CAs instead of the secret, and RequireClientCert turns
+// away clients without one. Relative paths are relative to the conf directory.
+type TLSConfig struct {
+	Enabled           bool   `json:"enabled"`
+	CertFile          string `json:"certFile"`
+	KeyFile           string `json:"keyFile"`
+	ClientCAFile      string `json:"clientCAFile"`
+	RequireClientCert bool   `json:"requireClientCert"`
+}
+
+// LimitsConfig limits the requests of each client, which is told apart by its token,
+// secret or client certificate. A limit of 0 turns it off.
+type LimitsConfig struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+	MaxConcurrentRuns int     `json:"maxConcurrentRuns"`
+	MaxPathLength     int     `json:"maxPathLength"`
+	MaxSegmentLength  int     `json:"maxSegmentLength"`
+}
+
+// DefaultConfig returns the settings used when there is no configuration file
+func DefaultConfig() Config {
+	return Config{
+		QueueRetention:   DefaultQueueRetention.String(),
+		MaxStoredOutputs: DefaultMaxStoredOutputs,
+		HistoryBlocklist: DefaultHistoryBlocklist,
+		Sync:             SyncConfig{Branch: DefaultSyncBranch},
+		Limits: LimitsConfig{
+			RequestsPerSecond: DefaultRequestsPerSecond,
+			Burst:             DefaultBurst,
+			MaxConcurrentRuns: DefaultMaxConcurrentRuns,
+			MaxPathLength:     DefaultMaxPathLength,
+			MaxSegmentLength:  DefaultMaxSegmentLength,
+		},
+	}
+}
+
+// Retention returns how long finished runs stay in the queue
+func (c Config) Retention() (time.Duration, error) {
+
+	if c.QueueRetention == "" {
+		return DefaultQueueRetention, nil
+	}
+
+	retention, err := time.ParseDuration(c.QueueRetention)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if retention < 0 {
+		return 0, errors.New("queueRetention must not be negative")
+	}
+
+	return retention, nil
+}
+
+// ConfigFile represents the configuration file
+type ConfigFile struct {
+	Path string
+}
+
+// Set sets the path to the configuration file
+func (f *ConfigFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdConfigFile)
+}
+
+// WriteConfigToFile writes the default settings to the configuration file if it doesn't exist
+func (f *ConfigFile) WriteConfigToFile() error {
+
+	if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(DefaultConfig(), "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.Path, data, os.FileMode(0644))
+}
+
+// ReadConfig reads the configuration file. Settings that are missing keep their defaults.
+func (f *ConfigFile) ReadConfig() (Config, error) {
+
+	config := DefaultConfig()
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return config, err
+	}
+
+	if len(data) == 0 {
+		return config, nil
+	}
+
+	err = json.Unmarshal(data, &config)
+
+	return config, err
+}
@@ -0,0 +1,230 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit is how far ahead Next looks for a matching time before giving up
+const cronSearchLimit = 5 * 365 * 24 * time.Hour
+
+// CronExpression represents a parsed cron expression. It is either a standard five field
+// expression (minute hour day-of-month month day-of-week) or a fixed interval written
+// as "@every <duration>".
+type CronExpression struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	interval time.Duration
+
+	// Whether the day-of-month or day-of-week fields were restricted. When both are,
+	// a time matches if either of them matches.
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// cronDescriptors are the shortcuts that can be used instead of five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseCronExpression parses a cron expression
+func ParseCronExpression(expression string) (CronExpression, error) {
+
+	var expr CronExpression
+
+	expression = strings.TrimSpace(expression)
+
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil {
+			return expr, err
+		}
+		if interval < time.Second {
+			return expr, errors.New("interval must be at least one second")
+		}
+		expr.interval = interval
+		return expr, nil
+	}
+
+	if descriptor, ok := cronDescriptors[strings.ToLower(expression)]; ok {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+
+	if len(fields) != 5 {
+		return expr, fmt.Errorf("expected 5 fields but got %v", len(fields))
+	}
+
+	var err error
+
+	if expr.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return expr, fmt.Errorf("minute: %v", err)
+	}
+	if expr.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return expr, fmt.Errorf("hour: %v", err)
+	}
+	if expr.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return expr, fmt.Errorf("day of month: %v", err)
+	}
+	if expr.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return expr, fmt.Errorf("month: %v", err)
+	}
+	if expr.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return expr, fmt.Errorf("day of week: %v", err)
+	}
+
+	// Both 0 and 7 mean Sunday
+	if expr.weekdays&(1<<7) != 0 {
+		expr.weekdays |= 1
+	}
+
+	expr.daysRestricted = fields[2] != "*" && fields[2] != "?"
+	expr.weekdaysRestricted = fields[4] != "*" && fields[4] != "?"
+
+	return expr, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps into a bit set
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+
+	var bits uint64
+
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		if n < min || n > max {
+			return 0, fmt.Errorf("value %v out of range %v-%v", n, min, max)
+		}
+		return n, nil
+	}
+
+	for _, part := range strings.Split(field, ",") {
+
+		step := 1
+
+		if index := strings.Index(part, "/"); index != -1 {
+			n, err := strconv.Atoi(part[index+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[index+1:])
+			}
+			step = n
+			part = part[:index]
+		}
+
+		start, end := min, max
+
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if end, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			var err error
+			if start, err = value(part); err != nil {
+				return 0, err
+			}
+			if step == 1 {
+				end = start
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// IsInterval returns true if the expression is a fixed interval
+func (expr CronExpression) IsInterval() bool {
+	return expr.interval > 0
+}
+
+// dayMatches checks the day-of-month and day-of-week fields
+func (expr CronExpression) dayMatches(t time.Time) bool {
+
+	dayMatch := expr.days&(1<<uint(t.Day())) != 0
+	weekdayMatch := expr.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if expr.daysRestricted && expr.weekdaysRestricted {
+		return dayMatch || weekdayMatch
+	}
+
+	return dayMatch && weekdayMatch
+}
+
+// Next returns the first time after the given time that matches the expression.
+// The zero time is returned if there is no such time.
+func (expr CronExpression) Next(after time.Time) time.Time {
+
+	if expr.IsInterval() {
+		return after.Add(expr.interval)
+	}
+
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+
+		if expr.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !expr.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if expr.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if expr.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,60 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronExpressionNext(t *testing.T) {
+
+	start := time.Date(2020, time.November, 1, 10, 30, 15, 0, time.Local)
+
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.November, 1, 10, 31, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2020, time.November, 1, 10, 45, 0, 0, time.Local)},
+		{"0 2 * * *", time.Date(2020, time.November, 2, 2, 0, 0, 0, time.Local)},
+		{"0 9 * * mon-fri", time.Date(2020, time.November, 2, 9, 0, 0, 0, time.Local)},
+		{"0 0 1 jan *", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 13 * 5", time.Date(2020, time.November, 6, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2020, time.November, 1, 11, 0, 0, 0, time.Local)},
+		{"@every 90s", start.Add(90 * time.Second)},
+	}
+
+	for _, test := range tests {
+
+		expr, err := ParseCronExpression(test.expression)
+
+		if err != nil {
+			t.Errorf("Unable to parse %q: %v", test.expression, err)
+			continue
+		}
+
+		if next := expr.Next(start); !next.Equal(test.expected) {
+			t.Errorf("Next for %q was %v, expected %v", test.expression, next, test.expected)
+		}
+	}
+}
+
+func TestCronExpressionInvalid(t *testing.T) {
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every 1ms"} {
+		if _, err := ParseCronExpression(expression); err == nil {
+			t.Errorf("Accepted invalid expression %q", expression)
+		}
+	}
+}
+
+func TestMissedRuns(t *testing.T) {
+
+	expr, _ := ParseCronExpression("@every 1h")
+
+	next := time.Date(2020, time.November, 1, 10, 0, 0, 0, time.Local)
+	now := next.Add(150 * time.Minute)
+
+	if missed := missedRuns(expr, next, now); missed != 3 {
+		t.Errorf("Expected 3 missed runs but got %v", missed)
+	}
+}
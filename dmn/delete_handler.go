@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -22,29 +21,52 @@ func (a *App) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
 		return
 	}
 
-	// Select the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 400
-	selectedCmd, err := a.DeleteCmd(variables.CmdHash)
+	// Commands in the libraries of other users are not found
+	cmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, cmd) {
+		return
+	}
+
+	// Delete the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 404
+	selectedCmd, err := a.DeleteCmd(cmd.CmdHash)
+
+	if a.writeResolveError(w, err) {
 		return
 	}
 
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to delete command", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditDelete, CmdHash: cmd.CmdHash, Before: &selectedCmd[0]})
+
 	out, err := json.Marshal(selectedCmd)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
 		return
 	}
 
@@ -52,38 +74,33 @@ func (a *App) HandleDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteCmd deletes a dmn.Command. It's best to pass in the dmn.CommandHash
-// because dmn.Commands may look similar.
+// because dmn.Commands may look similar. The Command is resolved like in SelectCmd,
+// so nothing is deleted if the prefix is too short or matches more than one Command.
 func (a *App) DeleteCmd(value string) ([]Command, error) {
 
 	a.DmnLogFile.Log.Println("Deleting " + value)
 
 	ret := []Command{}
 
-	cmds, error := a.History.ReadCmdHistoryFile()
+	err := a.History.Modify(func(cmds []Command) ([]Command, error) {
 
-	if error != nil {
-		return ret, error
-	}
-
-	foundIndex := -1
+		foundIndex, err := resolveCmd(cmds, value)
 
-	for index, cmd := range cmds {
-		if strings.Index(cmd.CmdHash, value) == 0 {
-			foundIndex = index
-			break
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	if foundIndex != -1 {
 		ret = append(ret, cmds[foundIndex])
 
-		//fmt.Println("Found dmn.Command. Found index was " + strconv.Itoa(foundIndex))
 		// We may want to do more investigation to know why this works...
-		cmds = append(cmds[:foundIndex], cmds[foundIndex+1:]...)
+		return append(cmds[:foundIndex], cmds[foundIndex+1:]...), nil
+	})
 
-		// Return whether we are able to overwrite the history file
-		a.History.OverwriteCmdHistoryFile(cmds)
+	if err != nil {
+		return []Command{}, err
 	}
 
+	a.unsyncCmd(ret[0])
+
 	return ret, nil
 }
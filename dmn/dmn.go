@@ -36,6 +36,16 @@ type App struct {
 	Footprint        Footprint
 	DmnLogFile       LogFile
 	History          HistoryFile
+	Schedules        ScheduleFile
+	PendingRuns      PendingRunFile
+	Pipelines        PipelineFile
+	Config           ConfigFile
+	Settings         Config
+	Index            IndexFile
+	Library          GitLibrary
+	Users            UserFile
+	Audit            AuditFile
+	Limiter          RateLimiter
 }
 
 // InitializeProd initializes the app in production
@@ -50,19 +60,71 @@ func (a *App) InitializeProd() {
 	a.Secret.Set(footprint.confDirPath)
 	a.Secret.WriteSecretToFile()
 
+	// Set the users file
+	a.Users.Set(footprint.confDirPath)
+	a.Users.WriteUsersToFile()
+
 	// Set the log file
 	a.DmnLogFile.Set(footprint.logDirPath)
 	a.DmnLogFile.Create()
 
+	// Set the audit log, which is kept across restarts
+	a.Audit.Set(footprint.logDirPath)
+
+	if err := a.Audit.Open(); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read the audit log: %v\n", err)
+	}
+
 	// Set the history file
 	a.History.Set(footprint.confDirPath)
 	a.History.WriteHistoryToFile()
 
+	if migrated, err := a.History.Migrate(); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to migrate history file: %v\n", err)
+	} else if migrated > 0 {
+		a.DmnLogFile.Log.Printf("Gave IDs to %v commands in the history file\n", migrated)
+	}
+
+	// Set the schedules file
+	a.Schedules.Set(footprint.confDirPath)
+	a.Schedules.WriteSchedulesToFile()
+
+	// Set the pending runs file
+	a.PendingRuns.Set(footprint.confDirPath)
+	a.PendingRuns.WritePendingRunsToFile()
+
+	// Set the pipelines file
+	a.Pipelines.Set(footprint.confDirPath)
+	a.Pipelines.WritePipelinesToFile()
+
+	// Set the configuration file
+	a.Config.Set(footprint.confDirPath)
+	a.Config.WriteConfigToFile()
+	a.LoadConfig()
+
+	// Set the search index
+	a.Index.Set(footprint.confDirPath, footprint.dataDirPath)
+	a.LoadIndex()
+
+	// Set the library repository
+	a.Library.Set(footprint.dataDirPath)
+	a.InitLibrary()
+
 	a.DmnLogFile.Log.Printf("Initializing...")
 
 	// Server code
 	a.Server = http.Server{Addr: DefaultServerPort, Handler: nil}
 
+	if a.Settings.TLS.Enabled {
+		config, err := a.Settings.TLS.ServerConfig(footprint.confDirPath)
+
+		if err != nil {
+			a.DmnLogFile.Log.Fatalf("Unable to set up TLS: %v\n", err)
+		}
+
+		a.Server.TLSConfig = config
+	}
+
 	a.Router = mux.NewRouter()
 
 	a.InitializeRoutes()
@@ -70,6 +132,9 @@ func (a *App) InitializeProd() {
 	a.CreateScheduler()
 	go a.RunScheduler()
 	go a.QueuedCommandsCleanup()
+	go a.RunCronScheduler()
+
+	a.RestorePendingRuns()
 }
 
 // InitalizeTest deletes and recreates the testdata sandbox directory for testing.
@@ -93,10 +158,26 @@ func (a *App) InitalizeTest() error {
 		return err
 	}
 
+	// Set the users file
+	a.Users.Set(footprint.confDirPath)
+	os.Remove(a.Users.Path)
+	err = a.Users.WriteUsersToFile()
+	if err != nil {
+		return err
+	}
+
 	// Set the log file
 	a.DmnLogFile.Set(footprint.logDirPath)
 	a.DmnLogFile.Create()
 
+	// Set the audit log
+	a.Audit.Set(footprint.logDirPath)
+	a.Audit.Remove()
+	err = a.Audit.Open()
+	if err != nil {
+		return err
+	}
+
 	// Set the history file
 	a.History.Set(footprint.confDirPath)
 	a.History.Remove()
@@ -105,10 +186,84 @@ func (a *App) InitalizeTest() error {
 		return err
 	}
 
+	// Set the schedules file
+	a.Schedules.Set(footprint.confDirPath)
+	os.Remove(a.Schedules.Path)
+	err = a.Schedules.WriteSchedulesToFile()
+	if err != nil {
+		return err
+	}
+
+	// Set the pending runs file
+	a.PendingRuns.Set(footprint.confDirPath)
+	os.Remove(a.PendingRuns.Path)
+	err = a.PendingRuns.WritePendingRunsToFile()
+	if err != nil {
+		return err
+	}
+
+	// Set the pipelines file
+	a.Pipelines.Set(footprint.confDirPath)
+	os.Remove(a.Pipelines.Path)
+	err = a.Pipelines.WritePipelinesToFile()
+	if err != nil {
+		return err
+	}
+
+	// Set the configuration file
+	a.Config.Set(footprint.confDirPath)
+	os.Remove(a.Config.Path)
+	err = a.Config.WriteConfigToFile()
+	if err != nil {
+		return err
+	}
+	a.LoadConfig()
+
+	// Set the search index
+	a.Index.Set(footprint.confDirPath, footprint.dataDirPath)
+	a.Index.Remove()
+	a.LoadIndex()
+
+	// Set the library repository
+	a.Library.Set(footprint.dataDirPath)
+	os.RemoveAll(a.Library.Dir)
+	a.InitLibrary()
+
 	return nil
 
 }
 
+// LoadConfig reads the configuration file. If it cannot be read the default settings are used.
+func (a *App) LoadConfig() {
+
+	config, err := a.Config.ReadConfig()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read configuration, using defaults: %v\n", err)
+		config = DefaultConfig()
+	}
+
+	a.Settings = config
+}
+
+// LoadIndex indexes the stored outputs and the Commands in the history file. From then on
+// the index is updated every time the history file is written.
+func (a *App) LoadIndex() {
+
+	if err := a.Index.Load(); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read the stored outputs: %v\n", err)
+	}
+
+	cmds, err := a.History.ReadCmds()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read history file: %v\n", err)
+	}
+
+	a.Index.SetCmds(cmds)
+	a.History.OnWrite = a.Index.SetCmds
+}
+
 // InitializeConfigPath creates the config directory if it doesn't exist
 func (a *App) InitializeConfigPath(configPath string) {
 
@@ -163,21 +318,72 @@ func (a *App) CreateLogs() {
 
 // InitializeRoutes initializes the routes for this application
 func (a *App) InitializeRoutes() {
+
+	// Every route is subject to the limits on requests
+	a.Router.Use(a.LimitRequests)
+
 	a.Router.HandleFunc("/secret/{secret}/delete/cmdHash/{cmdHash}", a.HandleDelete)
 	a.Router.HandleFunc("/secret/{secret}/add/command/{command}/description/{description}/workingDirectory/{workingDirectory}", a.HandleAdd)
+	a.Router.HandleFunc("/secret/{secret}/update/cmdHash/{cmdHash}/update/{update}", a.HandleUpdate)
 	a.Router.HandleFunc("/secret/{secret}/select/cmdHash/{cmdHash}", a.HandleSelect)
 	a.Router.HandleFunc("/secret/{secret}/search/description/{description}", a.HandleSearch)
-	a.Router.HandleFunc("/secret/{secret}/run/cmdHash/{cmdHash}", a.HandleRun)
+	a.Router.HandleFunc("/secret/{secret}/search/query/{query}", a.HandleQuery)
+	a.Router.HandleFunc("/secret/{secret}/search/output/{output}", a.HandleSearchOutput)
+	a.Router.HandleFunc("/secret/{secret}/run/cmdHash/{cmdHash}", a.limitRuns(a.HandleRun))
+	a.Router.HandleFunc("/secret/{secret}/run/cmdHash/{cmdHash}/priority/{priority}", a.limitRuns(a.HandleRun))
+	a.Router.HandleFunc("/secret/{secret}/run/cmdHash/{cmdHash}/delay/{delay}", a.HandleRunLater)
+	a.Router.HandleFunc("/secret/{secret}/run/cmdHash/{cmdHash}/runAt/{runAt}", a.HandleRunLater)
+	a.Router.HandleFunc("/secret/{secret}/cancel/runID/{runID}", a.HandleCancel)
+	a.Router.HandleFunc("/secret/{secret}/pipelines", a.HandlePipelines)
+	a.Router.HandleFunc("/secret/{secret}/pipeline/add/pipeline/{pipeline}", a.HandleAddPipeline)
+	a.Router.HandleFunc("/secret/{secret}/pipeline/delete/pipelineID/{pipelineID}", a.HandleDeletePipeline)
+	a.Router.HandleFunc("/secret/{secret}/pipeline/run/pipelineID/{pipelineID}", a.limitRuns(a.HandleRunPipeline))
 	a.Router.HandleFunc("/secret/{secret}/show/cmdHash/{cmdHash}", a.HandleShow)
+	a.Router.HandleFunc("/secret/{secret}/export/format/{format}", a.HandleExport)
+	a.Router.HandleFunc("/secret/{secret}/import/format/{format}", a.HandleImport).Methods("POST")
+	a.Router.HandleFunc("/secret/{secret}/import/shell/{shell}", a.HandleImportShellHistory)
+	a.Router.HandleFunc("/secret/{secret}/sync", a.HandleSync)
+	a.Router.HandleFunc("/secret/{secret}/users", a.HandleUsers)
+	a.Router.HandleFunc("/secret/{secret}/user/add/name/{name}", a.HandleAddUser)
+	a.Router.HandleFunc("/secret/{secret}/user/delete/name/{name}", a.HandleDeleteUser)
+	a.Router.HandleFunc("/secret/{secret}/user/role/name/{name}/role/{role}", a.HandleSetRole)
+	a.Router.HandleFunc("/secret/{secret}/tokens", a.HandleTokens)
+	a.Router.HandleFunc("/secret/{secret}/token/add/name/{name}", a.HandleAddToken)
+	a.Router.HandleFunc("/secret/{secret}/token/delete/tokenID/{tokenID}", a.HandleDeleteToken)
+	a.Router.HandleFunc("/secret/{secret}/audit", a.HandleAudit)
+	a.Router.HandleFunc("/secret/{secret}/audit/verify", a.HandleVerifyAudit)
 	a.Router.HandleFunc("/secret/{secret}/list", a.HandleList)
 	a.Router.HandleFunc("/secret/{secret}/queue", a.HandleQueue)
 	a.Router.HandleFunc("/secret/{secret}/status", a.HandleStatus)
+	a.Router.HandleFunc("/secret/{secret}/settings/cmdHash/{cmdHash}/execSettings/{execSettings}", a.HandleExecSettings)
+	a.Router.HandleFunc("/secret/{secret}/sandbox/cmdHash/{cmdHash}/settings/{sandbox}", a.HandleSandbox)
+	a.Router.HandleFunc("/secret/{secret}/retry/cmdHash/{cmdHash}/policy/{retryPolicy}", a.HandleRetryPolicy)
+	a.Router.HandleFunc("/secret/{secret}/concurrency/cmdHash/{cmdHash}/policy/{concurrencyPolicy}", a.HandleConcurrencyPolicy)
+	a.Router.HandleFunc("/secret/{secret}/priority/cmdHash/{cmdHash}/priority/{priority}", a.HandlePriority)
+	a.Router.HandleFunc("/secret/{secret}/reprioritize/runID/{runID}/priority/{priority}", a.HandleReprioritize)
+	a.Router.HandleFunc("/secret/{secret}/schedules", a.HandleSchedules)
+	a.Router.HandleFunc("/secret/{secret}/schedule/add/cmdHash/{cmdHash}/expression/{expression}", a.HandleAddSchedule)
+	a.Router.HandleFunc("/secret/{secret}/schedule/add/cmdHash/{cmdHash}/expression/{expression}/missedRunPolicy/{missedRunPolicy}/overlapPolicy/{overlapPolicy}", a.HandleAddSchedule)
+	a.Router.HandleFunc("/secret/{secret}/schedule/pause/scheduleID/{scheduleID}", a.HandlePauseSchedule)
+	a.Router.HandleFunc("/secret/{secret}/schedule/resume/scheduleID/{scheduleID}", a.HandleResumeSchedule)
+	a.Router.HandleFunc("/secret/{secret}/schedule/delete/scheduleID/{scheduleID}", a.HandleDeleteSchedule)
 
 	http.Handle("/", a.Router)
 }
 
 // Run runs the application
 func (a *App) Run() {
+
+	// The certificate is already in the TLS configuration
+	if a.Server.TLSConfig != nil {
+		a.DmnLogFile.Log.Printf("Starting server on %v with TLS\n", DefaultServerPort)
+
+		if err := a.Server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	a.DmnLogFile.Log.Printf("Starting server on %v\n", DefaultServerPort)
 
 	//http.ListenAndServe(DefaultServerPort, nil)
@@ -0,0 +1,124 @@
+package dmn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinNice is the lowest (most favourable) nice level a Command can request
+	MinNice = -20
+
+	// MaxNice is the highest (least favourable) nice level a Command can request
+	MaxNice = 19
+)
+
+// geteuid returns the effective user ID of the daemon. Tests replace it to check the
+// settings that only root may use.
+var geteuid = os.Geteuid
+
+// CgroupRoot is the mount point of the cgroup v2 hierarchy. Commands with cgroup
+// settings are placed in a child group of CgroupRoot/recmd.
+var CgroupRoot = "/sys/fs/cgroup"
+
+// ExecSettings controls how a Command is executed. The zero value runs the Command
+// with the daemon's own user and without any limits.
+type ExecSettings struct {
+	UID               *uint32         `json:"uid,omitempty"`
+	GID               *uint32         `json:"gid,omitempty"`
+	Nice              int             `json:"nice"`
+	CPUTimeSeconds    uint64          `json:"cpuTimeSeconds"`
+	AddressSpaceBytes uint64          `json:"addressSpaceBytes"`
+	OpenFiles         uint64          `json:"openFiles"`
+	Processes         uint64          `json:"processes"`
+	Cgroup            *CgroupSettings `json:"cgroup,omitempty"`
+}
+
+// CgroupSettings represents the caps applied to the cgroup v2 group a Command runs in.
+// A value of zero leaves the corresponding controller at its default.
+type CgroupSettings struct {
+	MemoryMaxBytes int64 `json:"memoryMaxBytes"`
+	CPUMaxPercent  int   `json:"cpuMaxPercent"`
+}
+
+// Validate checks that the settings are within range. Only root can lower the nice level,
+// so a negative nice level is rejected unless the daemon runs as root.
+func (s ExecSettings) Validate() error {
+
+	if s.Nice < MinNice || s.Nice > MaxNice {
+		return fmt.Errorf("nice must be between %v and %v", MinNice, MaxNice)
+	}
+
+	if s.Nice < 0 && geteuid() != 0 {
+		return errors.New("a negative nice level needs the daemon to run as root")
+	}
+
+	if s.Cgroup != nil {
+		if s.Cgroup.MemoryMaxBytes < 0 {
+			return errors.New("cgroup memoryMaxBytes must not be negative")
+		}
+		if s.Cgroup.CPUMaxPercent < 0 {
+			return errors.New("cgroup cpuMaxPercent must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// changesCredential returns true if the Command should run as a different user or group
+func (s ExecSettings) changesCredential() bool {
+	return s.UID != nil || s.GID != nil
+}
+
+// scriptPrelude returns the shell statements that apply the resource limits. They are
+// written at the top of the script so that they only affect the Command. If a limit
+// cannot be applied the script exits with status 126 before the Command runs.
+func (s ExecSettings) scriptPrelude() string {
+
+	var prelude strings.Builder
+
+	if s.CPUTimeSeconds > 0 {
+		prelude.WriteString("ulimit -t " + strconv.FormatUint(s.CPUTimeSeconds, 10) + " || exit 126\n")
+	}
+
+	if s.AddressSpaceBytes > 0 {
+		// ulimit takes the address space in kilobytes
+		kb := s.AddressSpaceBytes / 1024
+		if kb == 0 {
+			kb = 1
+		}
+		prelude.WriteString("ulimit -v " + strconv.FormatUint(kb, 10) + " || exit 126\n")
+	}
+
+	if s.OpenFiles > 0 {
+		prelude.WriteString("ulimit -n " + strconv.FormatUint(s.OpenFiles, 10) + " || exit 126\n")
+	}
+
+	if s.Processes > 0 {
+		// bash uses -u for the process limit while dash uses -p
+		n := strconv.FormatUint(s.Processes, 10)
+		prelude.WriteString("{ ulimit -u " + n + " 2>/dev/null || ulimit -p " + n + "; } || exit 126\n")
+	}
+
+	if prelude.Len() > 0 {
+		prelude.WriteString("\n")
+	}
+
+	return prelude.String()
+}
+
+// command returns the exec.Cmd that runs the script, adjusting the nice level if necessary.
+// The process is killed if ctx is cancelled.
+func (s ExecSettings) command(ctx context.Context, script string) *exec.Cmd {
+
+	if s.Nice != 0 {
+		return exec.CommandContext(ctx, "nice", "-n", strconv.Itoa(s.Nice), "sh", script)
+	}
+
+	return exec.CommandContext(ctx, "sh", script)
+}
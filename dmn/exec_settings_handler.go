@@ -0,0 +1,103 @@
+package dmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleExecSettings sets the execution settings of a Command. The settings are passed
+// in as base64 encoded JSON. An empty JSON object clears the settings.
+func (a *App) HandleExecSettings(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	var settings ExecSettings
+
+	if err := json.Unmarshal([]byte(variables.ExecSettings), &settings); err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to parse execution settings", err)
+		return
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	updatedCmd, err := a.UpdateCommandExecSettings(selectedCmd.CmdHash, settings)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to update execution settings", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, CmdHash: updatedCmd.CmdHash, Detail: "execution settings", Before: &selectedCmd, After: &updatedCmd})
+
+	out, err := json.Marshal(updatedCmd)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// UpdateCommandExecSettings validates the settings and stores them with the Command
+func (a *App) UpdateCommandExecSettings(value string, settings ExecSettings) (Command, error) {
+
+	if err := settings.Validate(); err != nil {
+		return Command{}, err
+	}
+
+	selectedCmd, err := a.SelectCmd(value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	if err := selectedCmd.Sandbox.Validate(settings); err != nil {
+		return Command{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Updating execution settings for %v\n", selectedCmd.CmdHash)
+
+	return a.History.UpdateCmd(selectedCmd.CmdHash, func(cmd *Command) {
+		cmd.ExecSettings = settings
+	})
+}
@@ -0,0 +1,121 @@
+//go:build linux
+// +build linux
+
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// cpuMaxPeriod is the period in microseconds used when writing cpu.max
+const cpuMaxPeriod = 100000
+
+// apply configures cmd according to the settings. The returned function must be called
+// once the Command has exited to release anything that was created for it.
+func (s ExecSettings) apply(cmd *exec.Cmd, name string, script string) (func(), error) {
+
+	cleanup := func() {}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	// Run the script in its own process group so that cancelling the run also kills
+	// the processes started by the script
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	if s.changesCredential() {
+		if os.Geteuid() != 0 {
+			return cleanup, errors.New("uid and gid can only be changed when the daemon runs as root")
+		}
+
+		credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+		if s.UID != nil {
+			credential.Uid = *s.UID
+		}
+		if s.GID != nil {
+			credential.Gid = *s.GID
+		}
+		cmd.SysProcAttr.Credential = credential
+
+		// The script is created by the daemon, so make sure the new user can read it
+		if err := os.Chmod(script, 0644); err != nil {
+			return cleanup, err
+		}
+	}
+
+	if s.Cgroup != nil {
+		cgroupPath, err := createCgroup(name, *s.Cgroup)
+		if err != nil {
+			return cleanup, err
+		}
+
+		dir, err := os.Open(cgroupPath)
+		if err != nil {
+			os.Remove(cgroupPath)
+			return cleanup, err
+		}
+
+		// The child is cloned directly into the cgroup so no part of it runs without the caps
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+		cleanup = func() {
+			dir.Close()
+			os.Remove(cgroupPath)
+		}
+	}
+
+	return cleanup, nil
+}
+
+// createCgroup creates a cgroup v2 group for a single run and writes the caps to it
+func createCgroup(name string, settings CgroupSettings) (string, error) {
+
+	parent := filepath.Join(CgroupRoot, "recmd")
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("unable to create cgroup: %v", err)
+	}
+
+	// Delegate the controllers we need to the children of our parent group. Errors are
+	// ignored here because the controllers may already be enabled.
+	ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644)
+
+	cgroupPath := filepath.Join(parent, name+"-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+
+	if err := os.Mkdir(cgroupPath, 0755); err != nil {
+		return "", fmt.Errorf("unable to create cgroup: %v", err)
+	}
+
+	if settings.MemoryMaxBytes > 0 {
+		value := strconv.FormatInt(settings.MemoryMaxBytes, 10)
+		if err := ioutil.WriteFile(filepath.Join(cgroupPath, "memory.max"), []byte(value), 0644); err != nil {
+			os.Remove(cgroupPath)
+			return "", fmt.Errorf("unable to set memory.max: %v", err)
+		}
+	}
+
+	if settings.CPUMaxPercent > 0 {
+		quota := cpuMaxPeriod * settings.CPUMaxPercent / 100
+		value := strconv.Itoa(quota) + " " + strconv.Itoa(cpuMaxPeriod)
+		if err := ioutil.WriteFile(filepath.Join(cgroupPath, "cpu.max"), []byte(value), 0644); err != nil {
+			os.Remove(cgroupPath)
+			return "", fmt.Errorf("unable to set cpu.max: %v", err)
+		}
+	}
+
+	return cgroupPath, nil
+}
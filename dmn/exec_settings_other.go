@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package dmn
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// apply configures cmd according to the settings. Changing the user and cgroups are
+// only supported on Linux.
+func (s ExecSettings) apply(cmd *exec.Cmd, name string, script string) (func(), error) {
+
+	cleanup := func() {}
+
+	if s.changesCredential() {
+		return cleanup, errors.New("uid and gid are only supported on Linux")
+	}
+
+	if s.Cgroup != nil {
+		return cleanup, errors.New("cgroups are only supported on Linux")
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,98 @@
+package dmn
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExecSettingsLimits(t *testing.T) {
+
+	var sc ScheduledCommand
+	sc.Set("ulimit -n; nice", "show limits", ".")
+	sc.ExecSettings.OpenFiles = 64
+	sc.ExecSettings.Nice = 5
+
+	sc.RunShellScriptCommandWithExitStatus()
+
+	if sc.Status != Completed {
+		t.Fatalf("Command did not complete: %v", sc.Coutput)
+	}
+
+	lines := strings.Fields(sc.Coutput)
+
+	if len(lines) != 2 || lines[0] != "64" {
+		t.Errorf("Open files limit was not applied: %v", sc.Coutput)
+	}
+
+	if len(lines) == 2 && lines[1] != "5" {
+		t.Errorf("Nice level was not applied: %v", sc.Coutput)
+	}
+}
+
+func TestExecSettingsValidate(t *testing.T) {
+
+	var settings ExecSettings
+
+	settings.Nice = 20
+
+	if settings.Validate() == nil {
+		t.Errorf("Accepted nice level out of range")
+	}
+
+	// Only root can lower the nice level
+	defer func() { geteuid = os.Geteuid }()
+
+	settings.Nice = -5
+	geteuid = func() int { return 1000 }
+
+	if settings.Validate() == nil {
+		t.Errorf("Accepted a negative nice level without root")
+	}
+
+	geteuid = func() int { return 0 }
+
+	if err := settings.Validate(); err != nil {
+		t.Errorf("Rejected a negative nice level as root: %v", err)
+	}
+
+	settings.Nice = 0
+	settings.Cgroup = &CgroupSettings{MemoryMaxBytes: -1}
+
+	if settings.Validate() == nil {
+		t.Errorf("Accepted negative memory limit")
+	}
+}
+
+func TestUpdateCommandExecSettings(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if app.SaveCmd(cmd) != true {
+		t.Errorf("Unable to save command")
+	}
+
+	var settings ExecSettings
+	settings.CPUTimeSeconds = 10
+
+	_, err = app.UpdateCommandExecSettings(cmd.CmdHash, settings)
+
+	if err != nil {
+		t.Errorf("Unable to update execution settings: %v", err)
+	}
+
+	selectedCmd, _ := app.SelectCmd(cmd.CmdHash)
+
+	if selectedCmd.ExecSettings.CPUTimeSeconds != 10 {
+		t.Errorf("Execution settings were not saved")
+	}
+}
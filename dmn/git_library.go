@@ -0,0 +1,495 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// The directory containing the checked out library repository
+	recmdLibraryDir = "library"
+
+	// The directory in the repository containing a file for each Command
+	libraryCommandsDir = "commands"
+
+	// DefaultSyncBranch is the branch of the library repository that is used
+	DefaultSyncBranch = "main"
+)
+
+// Ways to resolve conflicts when pulling the library
+const (
+	// ResolveOurs keeps the local version of a conflicting Command
+	ResolveOurs = "ours"
+
+	// ResolveTheirs takes the version of a conflicting Command from the remote
+	ResolveTheirs = "theirs"
+)
+
+// ErrSyncDisabled is returned when the library is synchronised but no remote is configured
+var ErrSyncDisabled = errors.New("library synchronisation is not enabled")
+
+// SyncConflict represents a Command that was changed both locally and in the remote.
+// Ours or Theirs is nil if the Command was deleted on that side.
+type SyncConflict struct {
+	ID     string          `json:"id"`
+	Ours   *LibraryCommand `json:"ours"`
+	Theirs *LibraryCommand `json:"theirs"`
+}
+
+// SyncConflictError is returned when pulling the library runs into conflicts. Nothing is
+// merged, and pulling again with ResolveOurs or ResolveTheirs settles the conflicts.
+type SyncConflictError struct {
+	Conflicts []SyncConflict
+}
+
+func (e *SyncConflictError) Error() string {
+	return fmt.Sprintf("%v commands were changed both locally and in the remote", len(e.Conflicts))
+}
+
+// GitLibrary represents a checkout of a git repository that holds the team library, with
+// a JSON file for each shared Command. Changes to Commands are committed as they are made,
+// and Sync pulls the changes made elsewhere and pushes the local ones.
+type GitLibrary struct {
+	Dir    string
+	Remote string
+	Branch string
+	mutex  sync.Mutex
+}
+
+// Set sets the path to the checkout of the library repository
+func (g *GitLibrary) Set(path string) {
+	g.Dir = filepath.Join(path, recmdLibraryDir)
+}
+
+// Configure sets the remote and branch of the library repository
+func (g *GitLibrary) Configure(config SyncConfig) {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.Remote = config.Remote
+	g.Branch = config.Branch
+
+	if g.Branch == "" {
+		g.Branch = DefaultSyncBranch
+	}
+}
+
+// Enabled returns true if a remote is configured
+func (g *GitLibrary) Enabled() bool {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.Remote != ""
+}
+
+// git runs a git command in the checkout and returns its output
+func (g *GitLibrary) git(args ...string) (string, error) {
+
+	cmd := exec.Command("git", append([]string{"-C", g.Dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	out, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return string(out), fmt.Errorf("git %v: %v: %v", args[0], err, strings.TrimSpace(string(out)))
+	}
+
+	return string(out), nil
+}
+
+// libraryPath returns the path of the file of a Command, relative to the checkout
+func libraryPath(id string) string {
+	return filepath.Join(libraryCommandsDir, id+".json")
+}
+
+// Init clones the library repository if it is not checked out yet, checks out the branch
+// and commits the Commands that are not in the repository yet
+func (g *GitLibrary) Init(cmds []Command) error {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Remote == "" {
+		return ErrSyncDisabled
+	}
+
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(g.Dir), os.FileMode(0755)); err != nil {
+			return err
+		}
+
+		out, err := exec.Command("git", "clone", "--quiet", g.Remote, g.Dir).CombinedOutput()
+
+		if err != nil {
+			return fmt.Errorf("git clone: %v: %v", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// Commits need an author
+	for key, value := range map[string]string{"user.name": "recmd-dmn", "user.email": "recmd-dmn@localhost"} {
+		if _, err := g.git("config", key); err != nil {
+			if _, err := g.git("config", key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := g.checkout(); err != nil {
+		return err
+	}
+
+	return g.addMissing(cmds, "Add existing commands")
+}
+
+// deleted returns the IDs of the Commands whose files were deleted in the history of the
+// branch, here or in the remote. The caller must hold the mutex.
+func (g *GitLibrary) deleted() (map[string]bool, error) {
+
+	ret := make(map[string]bool)
+
+	// An empty repository has no history
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return ret, nil
+	}
+
+	out, err := g.git("log", "--diff-filter=D", "--name-only", "--format=", "--", libraryCommandsDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range strings.Fields(out) {
+		ret[strings.TrimSuffix(filepath.Base(path), ".json")] = true
+	}
+
+	return ret, nil
+}
+
+// addMissing writes and commits the files of the Commands that are not in the checkout,
+// such as Commands saved while synchronisation was disabled or whose commit failed.
+// Commands whose files were deleted are left out, since they are about to be deleted
+// from the history file. The caller must hold the mutex.
+func (g *GitLibrary) addMissing(cmds []Command, message string) error {
+
+	deleted, err := g.deleted()
+
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range cmds {
+		if deleted[cmd.ID] {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(g.Dir, libraryPath(cmd.ID))); os.IsNotExist(err) {
+			if err := g.write(cmd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return g.commit(message)
+}
+
+// checkout checks out the branch. If the branch doesn't exist locally, it is created from
+// the remote branch, or from the current branch if there is no remote branch. The caller
+// must hold the mutex.
+func (g *GitLibrary) checkout() error {
+
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "refs/heads/"+g.Branch); err == nil {
+		_, err = g.git("checkout", "--quiet", g.Branch)
+		return err
+	}
+
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+g.Branch); err == nil {
+		_, err = g.git("checkout", "--quiet", "-B", g.Branch, "origin/"+g.Branch)
+		return err
+	}
+
+	// An empty repository has no commits to branch from
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		_, err = g.git("symbolic-ref", "HEAD", "refs/heads/"+g.Branch)
+		return err
+	}
+
+	_, err := g.git("checkout", "--quiet", "-b", g.Branch)
+
+	return err
+}
+
+// write writes the file of a Command. The caller must hold the mutex.
+func (g *GitLibrary) write(cmd Command) error {
+
+	if err := os.MkdirAll(filepath.Join(g.Dir, libraryCommandsDir), os.FileMode(0755)); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(newLibraryCommand(cmd), "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(g.Dir, libraryPath(cmd.ID)), append(data, '\n'), os.FileMode(0644))
+}
+
+// commit commits the changes to the Commands, if there are any. The caller must hold the mutex.
+func (g *GitLibrary) commit(message string) error {
+
+	// git add fails if the directory is missing, which it is before the first Command
+	if err := os.MkdirAll(filepath.Join(g.Dir, libraryCommandsDir), os.FileMode(0755)); err != nil {
+		return err
+	}
+
+	if _, err := g.git("add", "--all", libraryCommandsDir); err != nil {
+		return err
+	}
+
+	// Nothing to commit
+	if _, err := g.git("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+
+	_, err := g.git("commit", "--quiet", "-m", message)
+
+	return err
+}
+
+// SaveCmd writes the file of a Command and commits it
+func (g *GitLibrary) SaveCmd(cmd Command, message string) error {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err := g.write(cmd); err != nil {
+		return err
+	}
+
+	return g.commit(message)
+}
+
+// DeleteCmd removes the file of a Command and commits it
+func (g *GitLibrary) DeleteCmd(cmd Command, message string) error {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if err := os.Remove(filepath.Join(g.Dir, libraryPath(cmd.ID))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return g.commit(message)
+}
+
+// commands reads the Commands in the checkout. Files that are not Commands are ignored.
+// The caller must hold the mutex.
+func (g *GitLibrary) commands() ([]LibraryCommand, error) {
+
+	cmds := []LibraryCommand{}
+
+	files, err := ioutil.ReadDir(filepath.Join(g.Dir, libraryCommandsDir))
+
+	// git removes the directory when the last Command is deleted
+	if os.IsNotExist(err) {
+		return cmds, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), ".json")
+
+		if !validUUID(id) || file.Name() != id+".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(g.Dir, libraryCommandsDir, file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		var lc LibraryCommand
+
+		if err := json.Unmarshal(data, &lc); err != nil {
+			return nil, fmt.Errorf("%v: %v", file.Name(), err)
+		}
+
+		// Every Command in the repository is in the team library
+		lc.ID = id
+		lc.Shared = true
+		cmds = append(cmds, lc)
+	}
+
+	return cmds, nil
+}
+
+// stage returns the version of a Command in a stage of a conflicted merge, or nil if the
+// Command was deleted on that side. The caller must hold the mutex.
+func (g *GitLibrary) stage(stage int, path string) *LibraryCommand {
+
+	out, err := g.git("show", fmt.Sprintf(":%v:%v", stage, path))
+
+	if err != nil {
+		return nil
+	}
+
+	var lc LibraryCommand
+
+	if json.Unmarshal([]byte(out), &lc) != nil {
+		return nil
+	}
+
+	return &lc
+}
+
+// pull fetches the remote branch and merges it. Conflicts are settled with resolve, or
+// if resolve is empty the merge is aborted and a SyncConflictError is returned. The caller
+// must hold the mutex.
+func (g *GitLibrary) pull(resolve string) error {
+
+	if _, err := g.git("fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+
+	// Nothing has been pushed yet
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+g.Branch); err != nil {
+		return nil
+	}
+
+	// Nothing has been committed locally yet
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		_, err = g.git("reset", "--quiet", "--hard", "origin/"+g.Branch)
+		return err
+	}
+
+	_, mergeErr := g.git("merge", "--quiet", "--no-edit", "--allow-unrelated-histories", "origin/"+g.Branch)
+
+	if mergeErr == nil {
+		return nil
+	}
+
+	out, err := g.git("diff", "--name-only", "--diff-filter=U")
+
+	if err != nil {
+		return err
+	}
+
+	paths := strings.Fields(out)
+
+	if len(paths) == 0 {
+		g.git("merge", "--abort")
+		return mergeErr
+	}
+
+	if resolve == "" {
+		conflicts := []SyncConflict{}
+
+		for _, path := range paths {
+			conflicts = append(conflicts, SyncConflict{
+				ID:     strings.TrimSuffix(filepath.Base(path), ".json"),
+				Ours:   g.stage(2, path),
+				Theirs: g.stage(3, path),
+			})
+		}
+
+		sort.Slice(conflicts, func(i, j int) bool {
+			return conflicts[i].ID < conflicts[j].ID
+		})
+
+		if _, err := g.git("merge", "--abort"); err != nil {
+			return err
+		}
+
+		return &SyncConflictError{Conflicts: conflicts}
+	}
+
+	stage := 2
+
+	if resolve == ResolveTheirs {
+		stage = 3
+	}
+
+	for _, path := range paths {
+		if out, err := g.git("show", fmt.Sprintf(":%v:%v", stage, path)); err == nil {
+			if err := ioutil.WriteFile(filepath.Join(g.Dir, path), []byte(out), os.FileMode(0644)); err != nil {
+				return err
+			}
+
+			_, err = g.git("add", path)
+
+			if err != nil {
+				return err
+			}
+		} else if _, err := g.git("rm", "--quiet", "--force", path); err != nil {
+			return err
+		}
+	}
+
+	_, err = g.git("commit", "--quiet", "--no-edit")
+
+	return err
+}
+
+// Sync commits the local Commands that are missing from the checkout, pulls the changes
+// made elsewhere and pushes the local changes. Only once the push succeeded are the
+// Commands in the library passed to apply, along with the IDs of the Commands whose files
+// were deleted, so that nothing changes locally if the remote can't be reached. See pull
+// for how conflicts are handled.
+func (g *GitLibrary) Sync(resolve string, local []Command, apply func(library []LibraryCommand, deleted map[string]bool) error) error {
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Remote == "" {
+		return ErrSyncDisabled
+	}
+
+	switch resolve {
+	case "", ResolveOurs, ResolveTheirs:
+	default:
+		return errors.New("invalid resolve: " + resolve)
+	}
+
+	if err := g.addMissing(local, "Add missing commands"); err != nil {
+		return err
+	}
+
+	if err := g.pull(resolve); err != nil {
+		return err
+	}
+
+	// An empty library has nothing to push
+	if _, err := g.git("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		if _, err := g.git("push", "--quiet", "origin", g.Branch); err != nil {
+			return err
+		}
+	}
+
+	cmds, err := g.commands()
+
+	if err != nil {
+		return err
+	}
+
+	deleted, err := g.deleted()
+
+	if err != nil {
+		return err
+	}
+
+	return apply(cmds, deleted)
+}
@@ -0,0 +1,241 @@
+package dmn
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncLibrary(t *testing.T) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := filepath.Join(t.TempDir(), "library.git")
+
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("Unable to create remote: %v: %s", err, out)
+	}
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	app.Settings.Sync.Remote = remote
+	app.InitLibrary()
+
+	var cmd1 Command
+	cmd1.Set("ls", "list files", ".")
+	cmd1.Shared = true
+
+	if !app.SaveCmd(cmd1) {
+		t.Fatalf("Unable to save command")
+	}
+
+	if _, err := app.SyncLibrary(""); err != nil {
+		t.Fatalf("Unable to push library: %v", err)
+	}
+
+	// A teammate's checkout of the library
+	var other GitLibrary
+	other.Dir = filepath.Join(t.TempDir(), "library")
+	other.Configure(SyncConfig{Remote: remote})
+
+	if err := other.Init(nil); err != nil {
+		t.Fatalf("Unable to clone library: %v", err)
+	}
+
+	var library []LibraryCommand
+
+	sync := func(resolve string) {
+		err := other.Sync(resolve, nil, func(cmds []LibraryCommand, deleted map[string]bool) error {
+			library = cmds
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("Unable to synchronise the other checkout: %v", err)
+		}
+	}
+
+	sync("")
+
+	if len(library) != 1 || library[0].ID != cmd1.ID {
+		t.Fatalf("Unexpected library: %v", library)
+	}
+
+	var cmd2 Command
+	cmd2.Set("pwd", "print working directory", ".")
+	cmd2.Shared = true
+
+	if err := other.SaveCmd(cmd2, "Add pwd"); err != nil {
+		t.Fatalf("Unable to commit command: %v", err)
+	}
+
+	sync("")
+
+	result, err := app.SyncLibrary("")
+
+	if err != nil || len(result.Added) != 1 || result.Added[0].ID != cmd2.ID {
+		t.Fatalf("Unexpected result: %+v: %v", result, err)
+	}
+
+	// Both sides change the same command
+	description := "list files locally"
+
+	if _, err := app.UpdateCmd(cmd1.CmdHash, CommandUpdate{Description: &description}); err != nil {
+		t.Fatalf("Unable to update command: %v", err)
+	}
+
+	cmd1.Description = "list files remotely"
+
+	if err := other.SaveCmd(cmd1, "Update ls"); err != nil {
+		t.Fatalf("Unable to commit command: %v", err)
+	}
+
+	sync("")
+
+	_, err = app.SyncLibrary("")
+
+	var conflict *SyncConflictError
+
+	if !errors.As(err, &conflict) || len(conflict.Conflicts) != 1 {
+		t.Fatalf("Expected a conflict but got %v", err)
+	}
+
+	if c := conflict.Conflicts[0]; c.ID != cmd1.ID || c.Ours.Description != description || c.Theirs.Description != cmd1.Description {
+		t.Errorf("Unexpected conflict: %+v", c)
+	}
+
+	result, err = app.SyncLibrary(ResolveTheirs)
+
+	if err != nil || len(result.Updated) != 1 || result.Updated[0].Description != cmd1.Description {
+		t.Fatalf("Unexpected result when taking their changes: %+v: %v", result, err)
+	}
+
+	// Deleting a command removes it from the other checkout
+	if _, err := app.DeleteCmd(cmd2.CmdHash); err != nil {
+		t.Fatalf("Unable to delete command: %v", err)
+	}
+
+	if _, err := app.SyncLibrary(""); err != nil {
+		t.Fatalf("Unable to push library: %v", err)
+	}
+
+	sync("")
+
+	if len(library) != 1 || library[0].Description != cmd1.Description {
+		t.Errorf("Unexpected library after deleting a command: %v", library)
+	}
+
+	// A command that never made it into the library is pushed instead of being deleted
+	var cmd3 Command
+	cmd3.Set("uptime", "show uptime", ".")
+	cmd3.Shared = true
+	cmd3.ID = newUUID()
+	cmd3.CmdHash = hashFromID(cmd3.ID)
+
+	cmds, _ := app.History.ReadCmds()
+
+	if !app.History.OverwriteCmdHistoryFile(append(cmds, cmd3)) {
+		t.Fatalf("Unable to write history file")
+	}
+
+	result, err = app.SyncLibrary("")
+
+	if err != nil || len(result.Deleted) != 0 {
+		t.Fatalf("Unexpected result with a missing command: %+v: %v", result, err)
+	}
+
+	sync("")
+
+	if len(library) != 2 {
+		t.Errorf("The missing command was not pushed: %v", library)
+	}
+
+	// If the push fails, the history file is left alone
+	if err := other.DeleteCmd(cmd3, "Delete uptime"); err != nil {
+		t.Fatalf("Unable to commit deletion: %v", err)
+	}
+
+	sync("")
+
+	hook := filepath.Join(remote, "hooks", "pre-receive")
+
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Unable to write hook: %v", err)
+	}
+
+	description = "list all files"
+
+	if _, err := app.UpdateCmd(cmd1.CmdHash, CommandUpdate{Description: &description}); err != nil {
+		t.Fatalf("Unable to update command: %v", err)
+	}
+
+	if _, err := app.SyncLibrary(""); err == nil {
+		t.Fatalf("Expected the push to fail")
+	}
+
+	if cmds, _ := app.History.ReadCmds(); len(cmds) != 2 {
+		t.Errorf("Expected the history file to be unchanged but it has %v commands", len(cmds))
+	}
+
+	os.Remove(hook)
+
+	result, err = app.SyncLibrary("")
+
+	if err != nil || len(result.Deleted) != 1 || result.Deleted[0].ID != cmd3.ID {
+		t.Errorf("Unexpected result after the remote deleted a command: %+v: %v", result, err)
+	}
+
+	// Commands that are not shared are never pushed, and are kept when synchronising
+	var private Command
+	private.Set("whoami", "print the user name", ".")
+
+	if !app.SaveCmd(private) {
+		t.Fatalf("Unable to save command")
+	}
+
+	result, err = app.SyncLibrary("")
+
+	if err != nil || len(result.Deleted) != 0 {
+		t.Fatalf("Unexpected result with a private command: %+v: %v", result, err)
+	}
+
+	sync("")
+
+	if len(library) != 1 || library[0].ID != cmd1.ID || !library[0].Shared {
+		t.Errorf("Unexpected library with a private command: %v", library)
+	}
+
+	// A command that is no longer shared is removed from the library, but not locally
+	shared := false
+
+	if _, err := app.UpdateCmd(cmd1.CmdHash, CommandUpdate{Shared: &shared}); err != nil {
+		t.Fatalf("Unable to update command: %v", err)
+	}
+
+	if result, err := app.SyncLibrary(""); err != nil || len(result.Deleted) != 0 {
+		t.Fatalf("Unexpected result after making a command private: %+v: %v", result, err)
+	}
+
+	sync("")
+
+	if cmds, _ := app.History.ReadCmds(); len(library) != 0 || len(cmds) != 2 {
+		t.Errorf("Unexpected library %v and commands %v after making a command private", library, cmds)
+	}
+
+	app.Settings.Sync.Remote = ""
+	app.InitLibrary()
+
+	if _, err := app.SyncLibrary(""); err != ErrSyncDisabled {
+		t.Errorf("Expected ErrSyncDisabled but got %v", err)
+	}
+}
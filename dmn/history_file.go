@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
 const (
@@ -16,6 +18,14 @@ const (
 // HistoryFile represents the file containing the history
 type HistoryFile struct {
 	Path string
+
+	// Reading and writing the history file is serialised so that commands that are run or
+	// changed at the same time don't undo each other's changes
+	mutex sync.Mutex
+
+	// OnWrite is called with the Commands every time they are written to the history file,
+	// while the history file is still locked
+	OnWrite func([]Command)
 }
 
 // Set sets the path to the history file
@@ -41,6 +51,9 @@ func (h *HistoryFile) Create() {
 // ReadCmdHistoryFile reads historyFile and generates a list of Command structs
 func (h *HistoryFile) ReadCmdHistoryFile() ([]Command, error) {
 
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
 	var (
 		historyData []byte    // Data representing our history file
 		cmds        []Command // List of dmn.Commands produced after unmarshalling historyData
@@ -66,16 +79,86 @@ func (h *HistoryFile) ReadCmdHistoryFile() ([]Command, error) {
 
 }
 
+// ReadCmds reads the Commands in the history file like ReadCmdHistoryFile, except that
+// an empty history file has no Commands instead of being an error
+func (h *HistoryFile) ReadCmds() ([]Command, error) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.readCmds()
+}
+
+// readCmds reads the Commands in the history file without locking it
+func (h *HistoryFile) readCmds() ([]Command, error) {
+
+	cmds := []Command{}
+
+	data, err := ioutil.ReadFile(h.Path)
+
+	if err != nil || len(data) == 0 {
+		return cmds, err
+	}
+
+	err = json.Unmarshal(data, &cmds)
+
+	return cmds, err
+}
+
 // OverwriteCmdHistoryFile overwrites the history file with []dmn.Command passed in as a parameter
 func (h *HistoryFile) OverwriteCmdHistoryFile(cmds []Command) bool {
 
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.write(cmds) == nil
+}
+
+// write writes the Commands to the history file without locking it
+func (h *HistoryFile) write(cmds []Command) error {
+
 	mode := int(0644)
 
-	updatedData, _ := json.MarshalIndent(cmds, "", "\t")
+	updatedData, err := json.MarshalIndent(cmds, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(h.Path, updatedData, os.FileMode(mode)); err != nil {
+		return err
+	}
+
+	if h.OnWrite != nil {
+		h.OnWrite(cmds)
+	}
+
+	return nil
+}
+
+// Modify reads the Commands in the history file, passes them to modify and writes the
+// Commands that it returns, all while the history file is locked. A missing history file
+// has no Commands. Nothing is written if modify returns an error, which is returned.
+func (h *HistoryFile) Modify(modify func([]Command) ([]Command, error)) error {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	cmds, err := h.readCmds()
+
+	if os.IsNotExist(err) {
+		cmds, err = []Command{}, nil
+	}
 
-	error := ioutil.WriteFile(h.Path, updatedData, os.FileMode(mode))
+	if err != nil {
+		return err
+	}
+
+	if cmds, err = modify(cmds); err != nil {
+		return err
+	}
 
-	return error == nil
+	return h.write(cmds)
 }
 
 // WriteHistoryToFile creates an empty history file
@@ -100,3 +183,95 @@ func (h *HistoryFile) WriteHistoryToFile() error {
 	}
 	return nil
 }
+
+// Migrate fills in the fields of Commands that were saved by older versions. Commands
+// without an ID are given one, and keep their CmdHash so that hash prefixes that are
+// already in use keep working. Commands without metadata get no tags, the root folder,
+// the default owner, and the time of the migration as their creation time. It returns
+// the number of Commands that were migrated.
+func (h *HistoryFile) Migrate() (int, error) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	data, err := ioutil.ReadFile(h.Path)
+
+	if err != nil || len(data) == 0 {
+		return 0, err
+	}
+
+	var cmds []Command
+
+	if err := json.Unmarshal(data, &cmds); err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+
+	now := time.Now()
+
+	for index := range cmds {
+		cmd := &cmds[index]
+
+		if cmd.ID != "" && cmd.Tags != nil && cmd.Owner != "" && !cmd.CreatedAt.IsZero() {
+			continue
+		}
+
+		if cmd.ID == "" {
+			cmd.ID = newUUID()
+		}
+
+		if cmd.CmdHash == "" {
+			cmd.CmdHash = legacyHash(cmd.CmdString)
+		}
+
+		if cmd.Tags == nil {
+			cmd.Tags = []string{}
+		}
+
+		if cmd.Owner == "" {
+			cmd.Owner = defaultOwner()
+		}
+
+		if cmd.CreatedAt.IsZero() {
+			cmd.CreatedAt = now
+		}
+
+		if cmd.UpdatedAt.IsZero() {
+			cmd.UpdatedAt = cmd.CreatedAt
+		}
+
+		migrated++
+	}
+
+	if migrated > 0 {
+		if err := h.write(cmds); err != nil {
+			return 0, err
+		}
+	}
+
+	return migrated, nil
+}
+
+// UpdateCmd applies update to the Command with the given hash, sets the time it was
+// updated and writes the history file. The updated Command is returned.
+func (h *HistoryFile) UpdateCmd(cmdHash string, update func(*Command)) (Command, error) {
+
+	var updated Command
+
+	err := h.Modify(func(cmds []Command) ([]Command, error) {
+		for index := range cmds {
+			if cmds[index].CmdHash == cmdHash {
+				update(&cmds[index])
+				cmds[index].UpdatedAt = time.Now()
+				updated = cmds[index]
+
+				return cmds, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%w: %v", ErrCommandNotFound, cmdHash)
+	})
+
+	return updated, err
+}
@@ -0,0 +1,125 @@
+package dmn
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryMigrate(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	// A history file written before Commands had IDs
+	legacy := `[{"commandHash": "` + legacyHash("ls -ltr") + `", "commandString": "ls -ltr", "description": "list files", "duration": 5, "workingDirectory": ".", "status": "Idle"}]`
+
+	if err := ioutil.WriteFile(app.History.Path, []byte(legacy), os.FileMode(0644)); err != nil {
+		t.Fatalf("Unable to write history file: %v", err)
+	}
+
+	migrated, err := app.History.Migrate()
+
+	if err != nil || migrated != 1 {
+		t.Fatalf("Expected 1 command to be migrated but got %v: %v", migrated, err)
+	}
+
+	// The old hash prefix still resolves
+	cmd, err := app.SelectCmd(legacyHash("ls -ltr")[:6])
+
+	if err != nil || cmd.CmdString != "ls -ltr" || cmd.Duration != 5 {
+		t.Fatalf("Unable to select migrated command: %v", err)
+	}
+
+	if len(cmd.ID) != 36 {
+		t.Errorf("Migrated command was not given an ID: %v", cmd.ID)
+	}
+
+	if cmd.Tags == nil || cmd.Folder != "" || cmd.Owner != defaultOwner() || cmd.CreatedAt.IsZero() || cmd.UpdatedAt != cmd.CreatedAt {
+		t.Errorf("Migrated command did not get the default metadata: %v", cmd)
+	}
+
+	if migrated, _ := app.History.Migrate(); migrated != 0 {
+		t.Errorf("Migrated %v commands a second time", migrated)
+	}
+}
+
+func TestSameCommandInDifferentDirectories(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd1 Command
+	cmd1.Set("ls", "list files", ".")
+
+	var cmd2 Command
+	cmd2.Set("ls", "list test data", "testdata")
+
+	if app.SaveCmd(cmd1) != true || app.SaveCmd(cmd2) != true {
+		t.Fatalf("Unable to save the same command in two directories")
+	}
+
+	if cmd1.CmdHash == cmd2.CmdHash || !strings.HasPrefix(strings.Replace(cmd1.ID, "-", "", -1), cmd1.CmdHash) {
+		t.Errorf("Unexpected hashes %v and %v", cmd1.CmdHash, cmd2.CmdHash)
+	}
+
+	var duplicate Command
+	duplicate.Set("ls", "list files again", ".")
+
+	if app.SaveCmd(duplicate) {
+		t.Errorf("Saved the same command in the same directory twice")
+	}
+
+	selectedCmd, err := app.SelectCmd(cmd2.ID)
+
+	if err != nil || selectedCmd.WorkingDirectory != "testdata" {
+		t.Errorf("Unable to select command by its ID: %v", err)
+	}
+}
+
+func TestConcurrentHistoryUpdates(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if !app.SaveCmd(cmd) {
+		t.Fatalf("Unable to save command")
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.UpdateCommandDuration(cmd, time.Second)
+		}()
+	}
+
+	wg.Wait()
+
+	cmds, _ := app.History.ReadCmds()
+
+	if len(cmds) != 1 || cmds[0].RunCount != 20 {
+		t.Errorf("Expected 20 runs to be recorded but got %v", cmds)
+	}
+}
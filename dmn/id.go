@@ -0,0 +1,59 @@
+package dmn
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// newID returns a random identifier made of 16 hex characters
+func newID() string {
+
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	s := hex.EncodeToString(b)
+
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// validUUID returns true if id is a UUID written like the ones from newUUID
+func validUUID(id string) bool {
+
+	if len(id) != 36 {
+		return false
+	}
+
+	for i, c := range id {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdef", c) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
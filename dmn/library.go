@@ -0,0 +1,551 @@
+package dmn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LibraryFormat names the format of an exported library
+type LibraryFormat string
+
+const (
+	// JSONFormat is a JSON document. A plain list of Commands such as recmd_history.json
+	// can also be imported.
+	JSONFormat LibraryFormat = "json"
+
+	// YAMLFormat is a YAML document
+	YAMLFormat LibraryFormat = "yaml"
+
+	// ShellFormat is a shell script with a comment block describing each command
+	ShellFormat LibraryFormat = "shell"
+
+	// LibraryVersion is the version of the exported library format
+	LibraryVersion = 1
+)
+
+// ConflictStrategy decides what happens to an imported Command that is already saved,
+// either with the same ID or with the same command string and working directory
+type ConflictStrategy string
+
+const (
+	// SkipConflicts keeps the saved Command
+	SkipConflicts ConflictStrategy = "skip"
+
+	// OverwriteConflicts replaces the fields of the saved Command with the imported ones.
+	// The saved Command keeps its hash, settings and run history.
+	OverwriteConflicts ConflictStrategy = "overwrite"
+
+	// RenameConflicts saves the imported Command with a new ID. This only works when the
+	// conflict is on the ID, since the same command string can't be saved twice in one
+	// working directory.
+	RenameConflicts ConflictStrategy = "rename"
+)
+
+// LibraryCommand represents a Command in an exported library. Only the fields that make
+// sense on another machine are exported.
+type LibraryCommand struct {
+	ID               string   `json:"id,omitempty" yaml:"id,omitempty"`
+	CmdString        string   `json:"commandString" yaml:"commandString"`
+	Description      string   `json:"description" yaml:"description"`
+	WorkingDirectory string   `json:"workingDirectory" yaml:"workingDirectory"`
+	Tags             []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Folder           string   `json:"folder,omitempty" yaml:"folder,omitempty"`
+	Owner            string   `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Shared           bool     `json:"shared,omitempty" yaml:"shared,omitempty"`
+}
+
+// Library represents an exported list of Commands
+type Library struct {
+	Version  int              `json:"version" yaml:"version"`
+	Commands []LibraryCommand `json:"commands" yaml:"commands"`
+}
+
+// ImportOptions controls how a library is imported. Remap maps working directories in
+// the library to working directories on this machine.
+type ImportOptions struct {
+	DryRun   bool
+	Strategy ConflictStrategy
+	Remap    map[string]string
+}
+
+// ImportError represents an imported Command that could not be saved
+type ImportError struct {
+	CmdString string `json:"commandString"`
+	Error     string `json:"error"`
+}
+
+// ImportResult lists what happened, or would happen in a dry run, to each imported Command
+type ImportResult struct {
+	DryRun      bool          `json:"dryRun"`
+	Added       []Command     `json:"added"`
+	Overwritten []Command     `json:"overwritten"`
+	Renamed     []Command     `json:"renamed"`
+	Skipped     []Command     `json:"skipped"`
+	Errors      []ImportError `json:"errors"`
+}
+
+// ParseLibraryFormat checks that format is a supported library format
+func ParseLibraryFormat(format string) (LibraryFormat, error) {
+
+	switch LibraryFormat(format) {
+	case JSONFormat, YAMLFormat, ShellFormat:
+		return LibraryFormat(format), nil
+	}
+
+	return "", errors.New("invalid format: " + format)
+}
+
+// ParseImportOptions reads ImportOptions from the query parameters dryRun, strategy and
+// remap. remap is written as /old/path=/new/path and may be repeated.
+func ParseImportOptions(query url.Values) (ImportOptions, error) {
+
+	options := ImportOptions{Strategy: SkipConflicts, Remap: make(map[string]string)}
+
+	if dryRun := query.Get("dryRun"); dryRun != "" {
+		b, err := strconv.ParseBool(dryRun)
+
+		if err != nil {
+			return options, errors.New("invalid dryRun: " + dryRun)
+		}
+
+		options.DryRun = b
+	}
+
+	switch strategy := ConflictStrategy(query.Get("strategy")); strategy {
+	case "":
+	case SkipConflicts, OverwriteConflicts, RenameConflicts:
+		options.Strategy = strategy
+	default:
+		return options, errors.New("invalid strategy: " + string(strategy))
+	}
+
+	for _, remap := range query["remap"] {
+		parts := strings.SplitN(remap, "=", 2)
+
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return options, errors.New("invalid remap: " + remap)
+		}
+
+		options.Remap[filepath.Clean(parts[0])] = filepath.Clean(parts[1])
+	}
+
+	return options, nil
+}
+
+// remap returns the working directory on this machine. The longest matching directory
+// in Remap wins.
+func (o ImportOptions) remap(dir string) string {
+
+	dir = filepath.Clean(dir)
+
+	from := ""
+
+	for old := range o.Remap {
+		if (dir == old || strings.HasPrefix(dir, strings.TrimSuffix(old, "/")+"/")) && len(old) > len(from) {
+			from = old
+		}
+	}
+
+	if from == "" {
+		return dir
+	}
+
+	return filepath.Join(o.Remap[from], strings.TrimPrefix(dir, from))
+}
+
+// newLibraryCommand returns the exported fields of a Command
+func newLibraryCommand(cmd Command) LibraryCommand {
+	return LibraryCommand{
+		ID:               cmd.ID,
+		CmdString:        cmd.CmdString,
+		Description:      cmd.Description,
+		WorkingDirectory: cmd.WorkingDirectory,
+		Tags:             cmd.Tags,
+		Folder:           cmd.Folder,
+		Owner:            cmd.Owner,
+		Shared:           cmd.Shared,
+	}
+}
+
+// differsFrom returns true if the exported fields of the Command are not the same
+func (lc LibraryCommand) differsFrom(cmd Command) bool {
+	return lc.CmdString != cmd.CmdString || lc.Description != cmd.Description || lc.WorkingDirectory != cmd.WorkingDirectory ||
+		lc.Folder != cmd.Folder || lc.Owner != cmd.Owner || lc.Shared != cmd.Shared || strings.Join(lc.Tags, ",") != strings.Join(cmd.Tags, ",")
+}
+
+// applyTo copies the exported fields to a Command. The ID is left alone.
+func (lc LibraryCommand) applyTo(cmd *Command) {
+
+	cmd.CmdString = lc.CmdString
+	cmd.Description = lc.Description
+	cmd.WorkingDirectory = lc.WorkingDirectory
+	cmd.Tags = normalizeTags(lc.Tags)
+	cmd.Folder = lc.Folder
+	cmd.Owner = lc.Owner
+	cmd.Shared = lc.Shared
+}
+
+// ExportLibrary writes Commands in a library format
+func ExportLibrary(cmds []Command, format LibraryFormat) ([]byte, error) {
+
+	library := Library{Version: LibraryVersion, Commands: []LibraryCommand{}}
+
+	for _, cmd := range cmds {
+		library.Commands = append(library.Commands, newLibraryCommand(cmd))
+	}
+
+	switch format {
+	case JSONFormat:
+		return json.MarshalIndent(library, "", "\t")
+	case YAMLFormat:
+		return yaml.Marshal(library)
+	case ShellFormat:
+		return exportShell(library), nil
+	}
+
+	return nil, errors.New("invalid format: " + string(format))
+}
+
+// exportShell writes a library as a shell script. Each command is preceded by its
+// description as comments, and by its other fields as comments starting with @. Lines of
+// the description that start with @ or \ are escaped with a \. The last comment is @lines,
+// the number of lines of the command, so that blank lines and comments in the command
+// are read back as part of it.
+func exportShell(library Library) []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("#!/bin/sh\n# Exported from recmd-dmn\n")
+
+	for _, cmd := range library.Commands {
+		b.WriteString("\n")
+
+		if cmd.Description != "" {
+			for _, line := range strings.Split(cmd.Description, "\n") {
+				if strings.HasPrefix(line, "@") || strings.HasPrefix(line, "\\") {
+					line = "\\" + line
+				}
+
+				b.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+			}
+		}
+
+		if cmd.ID != "" {
+			fmt.Fprintf(&b, "# @id %v\n", cmd.ID)
+		}
+
+		fmt.Fprintf(&b, "# @dir %v\n", cmd.WorkingDirectory)
+
+		if len(cmd.Tags) > 0 {
+			fmt.Fprintf(&b, "# @tags %v\n", strings.Join(cmd.Tags, ", "))
+		}
+
+		if cmd.Folder != "" {
+			fmt.Fprintf(&b, "# @folder %v\n", cmd.Folder)
+		}
+
+		if cmd.Owner != "" {
+			fmt.Fprintf(&b, "# @owner %v\n", cmd.Owner)
+		}
+
+		if cmd.Shared {
+			b.WriteString("# @shared true\n")
+		}
+
+		fmt.Fprintf(&b, "# @lines %v\n", strings.Count(cmd.CmdString, "\n")+1)
+
+		b.WriteString(cmd.CmdString + "\n")
+	}
+
+	return b.Bytes()
+}
+
+// ParseLibrary reads the Commands of a library
+func ParseLibrary(data []byte, format LibraryFormat) ([]LibraryCommand, error) {
+
+	var library Library
+
+	switch format {
+	case JSONFormat:
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			err := json.Unmarshal(trimmed, &library.Commands)
+			return library.Commands, err
+		}
+
+		if err := json.Unmarshal(data, &library); err != nil {
+			return nil, err
+		}
+	case YAMLFormat:
+		if err := yaml.Unmarshal(data, &library); err != nil {
+			return nil, err
+		}
+	case ShellFormat:
+		return parseShell(data)
+	default:
+		return nil, errors.New("invalid format: " + string(format))
+	}
+
+	if library.Version > LibraryVersion {
+		return nil, fmt.Errorf("unsupported library version %v", library.Version)
+	}
+
+	return library.Commands, nil
+}
+
+// parseShell reads a library written by exportShell. A command is made of the number of
+// lines given by @lines, or without it, of the lines up to the next blank line or comment.
+// The comments before it describe it. Commands without a @dir comment run in the home
+// directory.
+func parseShell(data []byte) ([]LibraryCommand, error) {
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		home = "/"
+	}
+
+	var (
+		cmds        []LibraryCommand
+		cmd         LibraryCommand
+		description []string
+		lines       []string
+		remaining   int
+	)
+
+	reset := func() {
+		cmd = LibraryCommand{WorkingDirectory: home}
+		description = nil
+		lines = nil
+	}
+
+	flush := func() {
+		if len(lines) > 0 {
+			cmd.CmdString = strings.Join(lines, "\n")
+			cmd.Description = strings.Join(description, "\n")
+			cmds = append(cmds, cmd)
+			reset()
+		}
+	}
+
+	reset()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if remaining > 0 {
+			lines = append(lines, line)
+
+			if remaining--; remaining == 0 {
+				flush()
+			}
+
+			continue
+		}
+
+		switch {
+		case number == 1 && strings.HasPrefix(trimmed, "#!"):
+		case trimmed == "":
+			flush()
+			reset()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+
+			if !strings.HasPrefix(comment, "@") {
+				description = append(description, strings.TrimPrefix(comment, "\\"))
+				continue
+			}
+
+			parts := strings.SplitN(comment[1:]+" ", " ", 2)
+			value := strings.TrimSpace(parts[1])
+
+			switch parts[0] {
+			case "id":
+				cmd.ID = value
+			case "dir":
+				cmd.WorkingDirectory = value
+			case "tags":
+				cmd.Tags = strings.Split(value, ",")
+			case "folder":
+				cmd.Folder = value
+			case "owner":
+				cmd.Owner = value
+			case "shared":
+				if cmd.Shared, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("line %v: invalid value for @shared %q", number, value)
+				}
+			case "lines":
+				if remaining, err = strconv.Atoi(value); err != nil || remaining < 1 {
+					return nil, fmt.Errorf("line %v: invalid number of lines %q", number, value)
+				}
+			default:
+				return nil, fmt.Errorf("line %v: unknown field @%v", number, parts[0])
+			}
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if remaining > 0 {
+		return nil, fmt.Errorf("missing %v lines of the last command", remaining)
+	}
+
+	flush()
+
+	return cmds, nil
+}
+
+// indexOfSame returns the index of a Command other than the one at except that duplicates
+// cmd, or -1 if there is none
+func indexOfSame(cmds []Command, cmd Command, except int) int {
+
+	for index, c := range cmds {
+		if index != except && cmd.duplicates(c) {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// ImportLibrary adds imported Commands to cmds according to the options. It returns the
+// updated list of Commands and what happened to each imported Command. cmds is not
+// modified, so nothing needs to be undone in a dry run.
+func ImportLibrary(cmds []Command, imported []LibraryCommand, options ImportOptions) ([]Command, ImportResult) {
+
+	cmds = append([]Command{}, cmds...)
+
+	result := ImportResult{
+		DryRun:      options.DryRun,
+		Added:       []Command{},
+		Overwritten: []Command{},
+		Renamed:     []Command{},
+		Skipped:     []Command{},
+		Errors:      []ImportError{},
+	}
+
+	now := time.Now()
+
+	for _, lc := range imported {
+		fail := func(err string) {
+			result.Errors = append(result.Errors, ImportError{CmdString: lc.CmdString, Error: err})
+		}
+
+		if strings.TrimSpace(lc.CmdString) == "" {
+			fail("command string must not be empty")
+			continue
+		}
+
+		folder, err := normalizeFolder(lc.Folder)
+
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+
+		var cmd Command
+		cmd.Set(lc.CmdString, lc.Description, options.remap(lc.WorkingDirectory))
+		cmd.Tags = normalizeTags(lc.Tags)
+		cmd.Folder = folder
+		cmd.CreatedAt = now
+		cmd.UpdatedAt = now
+
+		if lc.Owner != "" {
+			cmd.Owner = lc.Owner
+		}
+
+		cmd.Shared = lc.Shared
+
+		if lc.ID != "" && !validUUID(lc.ID) {
+			fail("invalid id: " + lc.ID)
+			continue
+		}
+
+		if lc.ID != "" {
+			cmd.ID = lc.ID
+			cmd.CmdHash = hashFromID(lc.ID)
+		}
+
+		if info, err := os.Stat(cmd.WorkingDirectory); err != nil || !info.IsDir() {
+			fail("invalid working directory: " + cmd.WorkingDirectory)
+			continue
+		}
+
+		conflict := -1
+		sameID := false
+
+		for index, c := range cmds {
+			if c.ID == cmd.ID || c.CmdHash == cmd.CmdHash {
+				conflict, sameID = index, true
+				break
+			}
+
+			if cmd.duplicates(c) {
+				conflict = index
+			}
+		}
+
+		if conflict < 0 {
+			cmds = append(cmds, cmd)
+			result.Added = append(result.Added, cmd)
+			continue
+		}
+
+		switch options.Strategy {
+		case OverwriteConflicts:
+			if indexOfSame(cmds, cmd, conflict) >= 0 {
+				fail(ErrDuplicateCommand.Error())
+				continue
+			}
+
+			existing := &cmds[conflict]
+			existing.CmdString = cmd.CmdString
+			existing.Description = cmd.Description
+			existing.WorkingDirectory = cmd.WorkingDirectory
+			existing.Tags = cmd.Tags
+			existing.Folder = cmd.Folder
+			existing.Owner = cmd.Owner
+			existing.Shared = cmd.Shared
+			existing.UpdatedAt = now
+
+			result.Overwritten = append(result.Overwritten, *existing)
+
+		case RenameConflicts:
+			if !sameID || indexOfSame(cmds, cmd, -1) >= 0 {
+				fail("unable to rename, the command is already saved in " + cmd.WorkingDirectory)
+				continue
+			}
+
+			cmd.ID = newUUID()
+			cmd.CmdHash = hashFromID(cmd.ID)
+
+			cmds = append(cmds, cmd)
+			result.Renamed = append(result.Renamed, cmd)
+
+		default:
+			result.Skipped = append(result.Skipped, cmds[conflict])
+		}
+	}
+
+	return cmds, result
+}
@@ -0,0 +1,207 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxImportSize is the largest library that can be imported, in bytes
+const MaxImportSize = 10 << 20
+
+// libraryContentTypes are the content types of the library formats
+var libraryContentTypes = map[LibraryFormat]string{
+	JSONFormat:  "application/json",
+	YAMLFormat:  "application/yaml",
+	ShellFormat: "text/x-shellscript",
+}
+
+// HandleExport exports the Commands in a library format. The Commands can be filtered
+// like in HandleList.
+func (a *App) HandleExport(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
+		return
+	}
+
+	format, err := ParseLibraryFormat(variables.Format)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid library format", err)
+		return
+	}
+
+	filter, _, err := ParseCommandFilter(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid filter", err)
+		return
+	}
+
+	out, err := a.ExportCmds(format, filter, user)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to export commands", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", libraryContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// HandleImport imports the library in the body of the request. The query parameters
+// dryRun, strategy and remap are described in ParseImportOptions. Commands that could not
+// be imported are listed in the errors of the result and do not fail the request. Only
+// admins can import, since imported Commands keep the owner given in the library, which
+// puts them in the library of any user, and a conflict can overwrite a Command in any
+// library.
+func (a *App) HandleImport(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in belongs to an admin, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	format, err := ParseLibraryFormat(variables.Format)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid library format", err)
+		return
+	}
+
+	options, err := ParseImportOptions(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid import options", err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxImportSize+1))
+
+	if err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to read library", err)
+		return
+	}
+
+	if len(data) > MaxImportSize {
+		a.DmnLogFile.Log.Println("Library is too large to import")
+		writeError(w, http.StatusRequestEntityTooLarge, "library is too large to import", nil)
+		return
+	}
+
+	result, err := a.ImportCmds(data, format, options)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to import library", err)
+		return
+	}
+
+	// A dry run doesn't change the library
+	if !result.DryRun {
+		a.audit(r, user, AuditEntry{Action: AuditImport, Detail: fmt.Sprintf("%v library: %v added, %v overwritten, %v renamed", format, len(result.Added), len(result.Overwritten), len(result.Renamed))})
+	}
+
+	out, err := json.Marshal(result)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// ExportCmds returns the Commands that the user can see and pass the filter in a library format
+func (a *App) ExportCmds(format LibraryFormat, filter CommandFilter, user User) ([]byte, error) {
+
+	cmds, err := a.History.ReadCmds()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ExportLibrary(filter.Apply(user.Visible(cmds)), format)
+}
+
+// ImportCmds imports a library into the history file, see ImportLibrary. In a dry run the
+// history file is not changed.
+func (a *App) ImportCmds(data []byte, format LibraryFormat, options ImportOptions) (ImportResult, error) {
+
+	imported, err := ParseLibrary(data, format)
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	var result ImportResult
+
+	// errDryRun stops the history file from being written in a dry run
+	errDryRun := errors.New("dry run")
+
+	err = a.History.Modify(func(cmds []Command) ([]Command, error) {
+
+		cmds, result = ImportLibrary(cmds, imported, options)
+
+		if options.DryRun {
+			return nil, errDryRun
+		}
+
+		return cmds, nil
+	})
+
+	if err != nil && err != errDryRun {
+		return ImportResult{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Importing %v commands: %v added, %v overwritten, %v renamed, %v skipped, %v failed (dry run: %v)\n",
+		len(imported), len(result.Added), len(result.Overwritten), len(result.Renamed), len(result.Skipped), len(result.Errors), options.DryRun)
+
+	if options.DryRun {
+		return result, nil
+	}
+
+	for _, changed := range [][]Command{result.Added, result.Overwritten, result.Renamed} {
+		for _, cmd := range changed {
+			a.syncCmd(cmd, "Import")
+		}
+	}
+
+	return result, nil
+}
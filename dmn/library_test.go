@@ -0,0 +1,161 @@
+package dmn
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryFormats(t *testing.T) {
+
+	var cmd1 Command
+	cmd1.Set("ls -ltr", "list files\nnewest last", "/")
+	cmd1.Tags = []string{"files", "ops"}
+	cmd1.Folder = "ops/fs"
+	cmd1.Shared = true
+
+	var cmd2 Command
+	cmd2.Set("for f in *; do\n  echo $f\ndone", "", "/tmp")
+
+	// Descriptions that look like fields, and commands with blank lines and comments
+	var cmd3 Command
+	cmd3.Set("cat <<EOF\na\n\n# b\nEOF", "@daily backup\n\n\\n is a newline", "/tmp")
+
+	cmds := []Command{cmd1, cmd2, cmd3}
+
+	for _, format := range []LibraryFormat{JSONFormat, YAMLFormat, ShellFormat} {
+		data, err := ExportLibrary(cmds, format)
+
+		if err != nil {
+			t.Fatalf("Unable to export %v: %v", format, err)
+		}
+
+		imported, err := ParseLibrary(data, format)
+
+		if err != nil || len(imported) != len(cmds) {
+			t.Fatalf("Unable to parse %v: %v: %s", format, err, data)
+		}
+
+		for index, cmd := range cmds {
+			lc := imported[index]
+
+			if lc.ID != cmd.ID || lc.CmdString != cmd.CmdString || lc.Description != cmd.Description || lc.WorkingDirectory != cmd.WorkingDirectory || lc.Folder != cmd.Folder || lc.Shared != cmd.Shared || len(lc.Tags) != len(cmd.Tags) {
+				t.Errorf("%v did not round trip %v: %v", format, cmd, lc)
+			}
+		}
+	}
+
+	// A shell script that was not exported, with commands in the home directory
+	imported, err := ParseLibrary([]byte("# show the date\ndate\n\nuptime\n# @dir /tmp\n"), ShellFormat)
+
+	if err != nil || len(imported) != 2 || imported[0].Description != "show the date" || imported[1].Description != "" {
+		t.Fatalf("Unexpected commands: %v: %v", imported, err)
+	}
+
+	if _, err := ParseLibrary([]byte("# @color red\nls\n"), ShellFormat); err == nil {
+		t.Errorf("Accepted an unknown field")
+	}
+
+	if _, err := ParseLibrary([]byte("# @lines 2\nls\n"), ShellFormat); err == nil {
+		t.Errorf("Accepted a command with missing lines")
+	}
+
+	// recmd_history.json can be imported as is
+	if imported, err := ParseLibrary([]byte(`[{"commandString": "ls", "workingDirectory": "/"}]`), JSONFormat); err != nil || len(imported) != 1 {
+		t.Errorf("Unable to parse a list of commands: %v", err)
+	}
+}
+
+func TestImportLibrary(t *testing.T) {
+
+	dir, err := filepath.Abs(".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved Command
+	saved.Set("ls", "list files", dir)
+
+	imported := []LibraryCommand{
+		{CmdString: "ls", Description: "list the files", WorkingDirectory: "/home/teammate/checkout"},
+		{CmdString: "pwd", Description: "print the directory", WorkingDirectory: "/home/teammate/checkout/testdata"},
+		{ID: saved.ID, CmdString: "ls -a", WorkingDirectory: dir},
+		{CmdString: "true", WorkingDirectory: "/does/not/exist"},
+		{ID: "abc", CmdString: "false", WorkingDirectory: dir},
+	}
+
+	options, err := ParseImportOptions(url.Values{"remap": {"/home/teammate/checkout=" + dir}})
+
+	if err != nil {
+		t.Fatalf("Unable to parse options: %v", err)
+	}
+
+	cmds, result := ImportLibrary([]Command{saved}, imported, options)
+
+	if len(cmds) != 2 || len(result.Added) != 1 || len(result.Skipped) != 2 || len(result.Errors) != 2 {
+		t.Fatalf("Unexpected result when skipping conflicts: %+v", result)
+	}
+
+	if result.Added[0].WorkingDirectory != filepath.Join(dir, "testdata") {
+		t.Errorf("Working directory was not remapped: %v", result.Added[0].WorkingDirectory)
+	}
+
+	options.Strategy = OverwriteConflicts
+
+	cmds, result = ImportLibrary([]Command{saved}, imported[:3], options)
+
+	if len(cmds) != 2 || len(result.Overwritten) != 2 || cmds[0].CmdHash != saved.CmdHash || cmds[0].CmdString != "ls -a" {
+		t.Errorf("Unexpected result when overwriting conflicts: %+v", result)
+	}
+
+	options.Strategy = RenameConflicts
+
+	cmds, result = ImportLibrary([]Command{saved}, imported[:3], options)
+
+	if len(cmds) != 3 || len(result.Renamed) != 1 || result.Renamed[0].ID == saved.ID || len(result.Errors) != 1 {
+		t.Errorf("Unexpected result when renaming conflicts: %+v", result)
+	}
+
+	for _, query := range []string{"strategy=merge", "dryRun=maybe", "remap=/a"} {
+		values, _ := url.ParseQuery(query)
+
+		if _, err := ParseImportOptions(values); err == nil {
+			t.Errorf("Accepted invalid options %q", query)
+		}
+	}
+}
+
+func TestImportCmdsDryRun(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	wd, _ := os.Getwd()
+
+	library := []byte("# list files\n# @dir " + wd + "\nls\n")
+
+	result, err := app.ImportCmds(library, ShellFormat, ImportOptions{DryRun: true})
+
+	if err != nil || len(result.Added) != 1 {
+		t.Fatalf("Unexpected dry run result: %+v: %v", result, err)
+	}
+
+	if cmds, _ := app.ListCmd(); len(cmds) != 0 {
+		t.Errorf("Dry run saved %v commands", len(cmds))
+	}
+
+	if _, err := app.ImportCmds(library, ShellFormat, ImportOptions{}); err != nil {
+		t.Fatalf("Unable to import: %v", err)
+	}
+
+	if cmds := app.SearchCmd("list files"); len(cmds) != 1 {
+		t.Errorf("Imported command was not found")
+	}
+}
@@ -0,0 +1,223 @@
+package dmn
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sweepInterval is how often clients that have not made requests for a while are forgotten
+const sweepInterval = time.Minute
+
+// ErrTooManyRuns is returned when a run is scheduled by a user who already has the
+// maximum number of concurrent runs
+var ErrTooManyRuns = errors.New("too many concurrent runs")
+
+// bucket holds the requests that a client can still make. It refills at the rate limit.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps track of the requests and the runs of each client. The zero value
+// is ready to use.
+type RateLimiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	runs      map[string]int
+	lastSweep time.Time
+}
+
+// Allow takes a request of a client from its bucket. If the bucket is empty it returns
+// false and how long the client must wait before the next request.
+func (l *RateLimiter) Allow(key string, limits LimitsConfig, now time.Time) (bool, time.Duration) {
+
+	if limits.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+
+	burst := math.Max(float64(limits.Burst), 1)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+
+	l.sweep(burst, limits.RequestsPerSecond, now)
+
+	b, ok := l.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limits.RequestsPerSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / limits.RequestsPerSecond
+		return false, time.Duration(wait * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// sweep forgets the clients whose buckets have refilled, so that clients making a few
+// requests with made up secrets don't fill up the map. The caller must hold the mutex.
+func (l *RateLimiter) sweep(burst float64, rate float64, now time.Time) {
+
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// StartRun counts a run of a client. It returns false if the client already has max runs.
+func (l *RateLimiter) StartRun(key string, max int) bool {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.runs == nil {
+		l.runs = map[string]int{}
+	}
+
+	if max > 0 && l.runs[key] >= max {
+		return false
+	}
+
+	l.runs[key]++
+
+	return true
+}
+
+// FinishRun stops counting a run of a client
+func (l *RateLimiter) FinishRun(key string) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.runs[key]--; l.runs[key] <= 0 {
+		delete(l.runs, key)
+	}
+}
+
+// clientKey returns what a client is told apart by. The client is not authenticated
+// before its request is admitted: requests with a token are told apart by the hash of the
+// token, and the others by their address without the port, so that made up secrets or
+// new connections don't get a limit of their own.
+func clientKey(r *http.Request) string {
+
+	secret, err := base64.StdEncoding.DecodeString(mux.Vars(r)["secret"])
+
+	if err == nil && strings.HasPrefix(string(secret), tokenPrefix) {
+		return "token:" + hashToken(string(secret))
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = remoteAddr(r)
+	}
+
+	return "addr:" + host
+}
+
+// pendingRunKey returns the key that the pending runs scheduled by runBy are counted under
+func pendingRunKey(runBy string) string {
+	return "user:" + runBy
+}
+
+// tooManyRequests writes status 429 telling the client to retry after a number of seconds
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, reason string) {
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, http.StatusTooManyRequests, reason, nil)
+}
+
+// LimitRequests is a middleware that rejects requests with status 414 if their path is
+// too long, 413 if their body is larger than MaxImportSize, and 429 if the client made
+// too many requests.
+func (a *App) LimitRequests(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		limits := a.Settings.Limits
+
+		if limits.MaxPathLength > 0 && len(r.URL.RequestURI()) > limits.MaxPathLength {
+			a.DmnLogFile.Log.Printf("Rejecting %v from %v: path is too long\n", routeTemplate(r), remoteAddr(r))
+			writeError(w, http.StatusRequestURITooLong, "path is too long", nil)
+			return
+		}
+
+		if limits.MaxSegmentLength > 0 {
+			for _, segment := range strings.Split(r.URL.EscapedPath(), "/") {
+				if len(segment) > limits.MaxSegmentLength {
+					a.DmnLogFile.Log.Printf("Rejecting %v from %v: path segment is too long\n", routeTemplate(r), remoteAddr(r))
+					writeError(w, http.StatusRequestURITooLong, "path segment is too long", nil)
+					return
+				}
+			}
+		}
+
+		if r.ContentLength > MaxImportSize {
+			a.DmnLogFile.Log.Printf("Rejecting %v from %v: body is too large\n", routeTemplate(r), remoteAddr(r))
+			writeError(w, http.StatusRequestEntityTooLarge, "request body is too large", nil)
+			return
+		}
+
+		if ok, wait := a.Limiter.Allow(clientKey(r), limits, time.Now()); !ok {
+			a.DmnLogFile.Log.Printf("Rate limiting %v from %v\n", routeTemplate(r), remoteAddr(r))
+			tooManyRequests(w, wait, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitRuns wraps a handler that waits for runs so that a client cannot wait for more
+// than the maximum number of concurrent runs. Further runs are rejected with status 429.
+func (a *App) limitRuns(handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		key := clientKey(r)
+
+		if !a.Limiter.StartRun(key, a.Settings.Limits.MaxConcurrentRuns) {
+			a.DmnLogFile.Log.Printf("Too many concurrent runs for %v from %v\n", routeTemplate(r), remoteAddr(r))
+			tooManyRequests(w, time.Second, "too many concurrent runs")
+			return
+		}
+
+		defer a.Limiter.FinishRun(key)
+
+		handler(w, r)
+	}
+}
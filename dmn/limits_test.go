@@ -0,0 +1,126 @@
+package dmn
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	var limiter RateLimiter
+
+	limits := LimitsConfig{RequestsPerSecond: 2, Burst: 3}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("alice", limits, now); !ok {
+			t.Fatalf("Expected request %v to be allowed", i+1)
+		}
+	}
+
+	ok, wait := limiter.Allow("alice", limits, now)
+
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms but got %v, %v", ok, wait)
+	}
+
+	if ok, _ := limiter.Allow("bob", limits, now); !ok {
+		t.Errorf("Expected other clients not to be limited")
+	}
+
+	if ok, _ := limiter.Allow("alice", limits, now.Add(500*time.Millisecond)); !ok {
+		t.Errorf("Expected the bucket to refill")
+	}
+
+	if ok, _ := limiter.Allow("alice", LimitsConfig{}, now); !ok {
+		t.Errorf("Expected no limit without a rate")
+	}
+
+	// Clients whose buckets have refilled are forgotten
+	limiter.Allow("carol", limits, now.Add(time.Hour))
+
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected 1 bucket after the sweep but got %v", len(limiter.buckets))
+	}
+
+	if !limiter.StartRun("alice", 1) || limiter.StartRun("alice", 1) {
+		t.Errorf("Expected a single run to be allowed")
+	}
+
+	limiter.FinishRun("alice")
+
+	if !limiter.StartRun("alice", 1) {
+		t.Errorf("Expected a run to be allowed after the last one finished")
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	app.Settings.Limits = LimitsConfig{RequestsPerSecond: 0.1, Burst: 2, MaxPathLength: 300, MaxSegmentLength: 100}
+
+	router := mux.NewRouter()
+	router.Use(app.LimitRequests)
+	router.HandleFunc("/secret/{secret}/select/cmdHash/{cmdHash}", func(w http.ResponseWriter, r *http.Request) {})
+
+	port := 1000
+
+	request := func(secret string, cmdHash string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/secret/"+secret+"/select/cmdHash/"+cmdHash, nil)
+		port++
+		req.RemoteAddr = "192.0.2.1:" + strconv.Itoa(port)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if code := request("YQ==", strings.Repeat("a", 101)).Code; code != http.StatusRequestURITooLong {
+		t.Errorf("Expected a long segment to be rejected with 414 but got %v", code)
+	}
+
+	if code := request("YQ==", "YQ==?q="+strings.Repeat("a", 300)).Code; code != http.StatusRequestURITooLong {
+		t.Errorf("Expected a long path to be rejected with 414 but got %v", code)
+	}
+
+	secret := base64.StdEncoding.EncodeToString([]byte(app.Secret.Value))
+
+	request(secret, "YQ==")
+	request(secret, "YQ==")
+
+	response := request(secret, "YQ==")
+
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected status 429 with Retry-After 10 but got %v, %v", response.Code, response.Header().Get("Retry-After"))
+	}
+
+	// The secret is not checked, so made up secrets share the limit of the address,
+	// whatever the port
+	if code := request("Yg==", "YQ==").Code; code != http.StatusTooManyRequests {
+		t.Errorf("Expected made up secrets to share the limit of the address but got %v", code)
+	}
+
+	// Tokens are told apart by their hash
+	token := base64.StdEncoding.EncodeToString([]byte(tokenPrefix + "abc"))
+
+	request(token, "YQ==")
+
+	if code := request(token, "YQ==").Code; code != http.StatusOK {
+		t.Errorf("Expected the token not to be limited by the address but got %v", code)
+	}
+
+	if code := request(token, "YQ==").Code; code != http.StatusTooManyRequests {
+		t.Errorf("Expected the token to be limited but got %v", code)
+	}
+}
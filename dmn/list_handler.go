@@ -1,14 +1,15 @@
 package dmn
 
 import (
-	"encoding/json"
-	"io"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-// HandleList lists Commands
+// HandleList lists Commands. The Commands can be filtered by the query parameters tag,
+// folder and owner, and grouped by tag, folder or owner with the groupBy query parameter.
+// They can also be filtered, sorted and paged with the query parameters in ListOptions,
+// in which case the groups are made from the Commands in the page.
 func (a *App) HandleList(w http.ResponseWriter, r *http.Request) {
 
 	a.DmnLogFile.Log.Printf("Handling list")
@@ -21,39 +22,63 @@ func (a *App) HandleList(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Printf("Bad secret! Expected %v but got t%v\n", a.Secret.GetSecret(), variables.Secret)
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
 		return
 	}
 
 	cmds, err := a.ListCmd()
 
 	if err != nil {
-		a.DmnLogFile.Log.Println("Unable to read history file")
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read history file", err)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	cmds = user.Visible(cmds)
+
+	filter, groupBy, err := ParseCommandFilter(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid filter", err)
+		return
+	}
 
-	out, err := json.Marshal(cmds)
+	options, err := ParseListOptions(r.URL.Query())
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid list options", err)
 		return
 	}
 
-	io.WriteString(w, string(out))
+	page, total, next, err := options.Apply(filter.Apply(cmds), func(cmd Command) string {
+		return cmd.CmdHash
+	})
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to page commands", err)
+		return
+	}
+
+	var ret interface{} = page
+
+	if groupBy != "" {
+		ret = GroupCmds(page, groupBy)
+	}
+
+	writePage(w, r, ret, total, next)
 }
 
 // ListCmd lists Commands
 func (a *App) ListCmd() ([]Command, error) {
 
-	ret, err := a.History.ReadCmdHistoryFile()
+	ret, err := a.History.ReadCmds()
 
 	return ret, err
 }
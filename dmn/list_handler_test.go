@@ -1,6 +1,7 @@
 package dmn
 
 import (
+	"io/ioutil"
 	"testing"
 )
 
@@ -33,4 +34,13 @@ func TestListHandler(t *testing.T) {
 	if len(cmds) != 1 {
 		t.Errorf("No commands to list")
 	}
+
+	// A history file that can't be read is an error
+	if err := ioutil.WriteFile(app.History.Path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.ListCmd(); err == nil {
+		t.Errorf("Expected an error for a history file that is not valid")
+	}
 }
@@ -0,0 +1,216 @@
+package dmn
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"strings"
+)
+
+// GroupBy names the field that listed Commands are grouped by
+type GroupBy string
+
+const (
+	// GroupByTag puts a Command in a group for each of its tags
+	GroupByTag GroupBy = "tag"
+
+	// GroupByFolder groups Commands by their folder
+	GroupByFolder GroupBy = "folder"
+
+	// GroupByOwner groups Commands by their owner
+	GroupByOwner GroupBy = "owner"
+)
+
+// CommandGroup represents the Commands that share a tag, folder or owner
+type CommandGroup struct {
+	Key      string    `json:"key"`
+	Commands []Command `json:"commands"`
+}
+
+// CommandFilter selects Commands by their metadata. A Command must have every tag in Tags
+// and be in Folder or one of its subfolders. Empty fields match every Command.
+type CommandFilter struct {
+	Tags   []string
+	Folder string
+	Owner  string
+}
+
+// defaultOwner returns the owner of Commands that don't have one, which is the user
+// running the daemon
+func defaultOwner() string {
+
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// normalizeTags trims the tags, makes them lowercase and removes empty and duplicate tags
+func normalizeTags(tags []string) []string {
+
+	normalized := []string{}
+	seen := make(map[string]bool)
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// normalizeFolder cleans a folder path such as /ops//db/ into ops/db. The root folder is
+// the empty string.
+func normalizeFolder(folder string) (string, error) {
+
+	for _, part := range strings.Split(folder, "/") {
+		if part == "." || part == ".." {
+			return "", errors.New("invalid folder: " + folder)
+		}
+	}
+
+	return strings.Trim(path.Clean("/"+strings.TrimSpace(folder)), "/"), nil
+}
+
+// inFolder returns true if folder is parent or one of its subfolders
+func inFolder(folder string, parent string) bool {
+	return parent == "" || folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+// ParseCommandFilter reads a CommandFilter and how to group the Commands from the query
+// parameters tag, folder, owner and groupBy. tag may be repeated.
+func ParseCommandFilter(query url.Values) (CommandFilter, GroupBy, error) {
+
+	var filter CommandFilter
+
+	filter.Tags = normalizeTags(query["tag"])
+	filter.Owner = query.Get("owner")
+
+	folder, err := normalizeFolder(query.Get("folder"))
+
+	if err != nil {
+		return filter, "", err
+	}
+
+	filter.Folder = folder
+
+	groupBy := GroupBy(query.Get("groupBy"))
+
+	switch groupBy {
+	case "", GroupByTag, GroupByFolder, GroupByOwner:
+	default:
+		return filter, "", errors.New("invalid groupBy: " + string(groupBy))
+	}
+
+	return filter, groupBy, nil
+}
+
+// Match returns true if the Command passes the filter
+func (f CommandFilter) Match(cmd Command) bool {
+
+	if f.Owner != "" && cmd.Owner != f.Owner {
+		return false
+	}
+
+	if !inFolder(cmd.Folder, f.Folder) {
+		return false
+	}
+
+	for _, tag := range f.Tags {
+		if !cmd.hasTag(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply returns the Commands that pass the filter
+func (f CommandFilter) Apply(cmds []Command) []Command {
+
+	ret := []Command{}
+
+	for _, cmd := range cmds {
+		if f.Match(cmd) {
+			ret = append(ret, cmd)
+		}
+	}
+
+	return ret
+}
+
+// hasTag returns true if the Command has the tag
+func (cmd Command) hasTag(tag string) bool {
+
+	for _, t := range cmd.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GroupCmds groups Commands by a tag, folder or owner. The groups are sorted by key and
+// Commands without a tag are in the group with the empty key.
+func GroupCmds(cmds []Command, groupBy GroupBy) []CommandGroup {
+
+	groups := make(map[string][]Command)
+
+	for _, cmd := range cmds {
+		switch groupBy {
+		case GroupByTag:
+			if len(cmd.Tags) == 0 {
+				groups[""] = append(groups[""], cmd)
+			}
+			for _, tag := range cmd.Tags {
+				groups[tag] = append(groups[tag], cmd)
+			}
+		case GroupByFolder:
+			groups[cmd.Folder] = append(groups[cmd.Folder], cmd)
+		case GroupByOwner:
+			groups[cmd.Owner] = append(groups[cmd.Owner], cmd)
+		}
+	}
+
+	ret := []CommandGroup{}
+
+	for key, group := range groups {
+		ret = append(ret, CommandGroup{Key: key, Commands: group})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+
+	return ret
+}
+
+// filterAndGroup applies the filter in the query parameters of a request to Commands and
+// groups them if groupBy was passed in. It returns either the Commands or the groups.
+func filterAndGroup(query url.Values, cmds []Command) (interface{}, error) {
+
+	filter, groupBy, err := ParseCommandFilter(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cmds = filter.Apply(cmds)
+
+	if groupBy != "" {
+		return GroupCmds(cmds, groupBy), nil
+	}
+
+	return cmds, nil
+}
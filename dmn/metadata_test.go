@@ -0,0 +1,81 @@
+package dmn
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCommandMetadata(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	add := func(cmdString string, folder string, tags ...string) Command {
+		var cmd Command
+		cmd.Set(cmdString, cmdString, ".")
+
+		if app.SaveCmd(cmd) != true {
+			t.Fatalf("Unable to save command")
+		}
+
+		updatedCmd, err := app.UpdateCmd(cmd.CmdHash, CommandUpdate{Folder: &folder, Tags: &tags})
+
+		if err != nil {
+			t.Fatalf("Unable to update command: %v", err)
+		}
+
+		if !updatedCmd.UpdatedAt.After(cmd.CreatedAt) {
+			t.Errorf("Updated time was not set")
+		}
+
+		return updatedCmd
+	}
+
+	backup := add("pg_dump", "/ops//db/", "Backup", "db", "backup")
+	add("psql", "ops/db", "db")
+	add("df -h", "ops", "disk")
+
+	if backup.Folder != "ops/db" || len(backup.Tags) != 2 || backup.Tags[0] != "backup" {
+		t.Errorf("Metadata was not normalized: %v %v", backup.Folder, backup.Tags)
+	}
+
+	cmds, _ := app.ListCmd()
+
+	filter, _, err := ParseCommandFilter(url.Values{"folder": {"ops/db"}, "tag": {"db"}})
+
+	if err != nil {
+		t.Fatalf("Unable to parse filter: %v", err)
+	}
+
+	if filtered := filter.Apply(cmds); len(filtered) != 2 {
+		t.Errorf("Expected 2 commands in ops/db but got %v", len(filtered))
+	}
+
+	// ops includes its subfolders
+	filter, _, _ = ParseCommandFilter(url.Values{"folder": {"ops"}})
+
+	if filtered := filter.Apply(cmds); len(filtered) != 3 {
+		t.Errorf("Expected 3 commands in ops but got %v", len(filtered))
+	}
+
+	groups := GroupCmds(cmds, GroupByTag)
+
+	if len(groups) != 3 || groups[0].Key != "backup" || len(groups[1].Commands) != 2 {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+
+	if _, _, err := ParseCommandFilter(url.Values{"groupBy": {"color"}}); err == nil {
+		t.Errorf("Accepted an invalid groupBy")
+	}
+
+	folder := "../etc"
+
+	if _, err := app.UpdateCmd(backup.CmdHash, CommandUpdate{Folder: &folder}); err == nil {
+		t.Errorf("Accepted an invalid folder")
+	}
+}
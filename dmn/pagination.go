@@ -0,0 +1,328 @@
+package dmn
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortKey names the field that listed Commands are sorted by
+type SortKey string
+
+const (
+	// SortByDescription sorts Commands by their description, ignoring case
+	SortByDescription SortKey = "description"
+
+	// SortByLastRun sorts Commands by the time they last ran. Commands that never ran come first.
+	SortByLastRun SortKey = "lastRun"
+
+	// SortByDuration sorts Commands by how long they took the last time they ran
+	SortByDuration SortKey = "duration"
+
+	// SortByUsage sorts Commands by the number of times they ran
+	SortByUsage SortKey = "usage"
+
+	// MaxPageSize is the largest number of Commands that can be asked for at once
+	MaxPageSize = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor cannot be decoded or was made for a
+	// different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrStaleCursor is returned when the Command a cursor points at is gone and the
+	// Commands are not sorted, so the position of the cursor is unknown
+	ErrStaleCursor = errors.New("the cursor points at a command that no longer exists")
+)
+
+// pageKey is the position of a Command in a sorted list. Text is used when sorting by
+// description and Number for the other sort keys. ID breaks ties.
+type pageKey struct {
+	Text   string `json:"t,omitempty"`
+	Number int64  `json:"n,omitempty"`
+	ID     string `json:"id"`
+}
+
+// pageCursor points at the last Command of a page
+type pageCursor struct {
+	Sort       SortKey `json:"sort,omitempty"`
+	Descending bool    `json:"desc,omitempty"`
+	Key        pageKey `json:"key"`
+}
+
+// ListOptions selects, orders and pages listed Commands. Empty fields select every
+// Command in the order they were listed, and a Limit of 0 returns all of them.
+type ListOptions struct {
+	Sort             SortKey
+	Descending       bool
+	Statuses         []CommandStatus
+	WorkingDirectory string
+	Limit            int
+	Cursor           *pageCursor
+}
+
+// ParseListOptions reads ListOptions from the query parameters sort, status, dir, limit and
+// cursor. A sort key with a leading - sorts in descending order. status may be repeated.
+func ParseListOptions(query url.Values) (ListOptions, error) {
+
+	var options ListOptions
+
+	sortKey := query.Get("sort")
+
+	if strings.HasPrefix(sortKey, "-") {
+		options.Descending = true
+		sortKey = sortKey[1:]
+	}
+
+	options.Sort = SortKey(sortKey)
+
+	switch options.Sort {
+	case "", SortByDescription, SortByLastRun, SortByDuration, SortByUsage:
+	default:
+		return options, errors.New("invalid sort: " + sortKey)
+	}
+
+	if options.Sort == "" && options.Descending {
+		return options, errors.New("invalid sort: -")
+	}
+
+	for _, status := range query["status"] {
+		switch CommandStatus(status) {
+		case Idle, Running, Completed, Scheduled, Failed, Cancelled:
+			options.Statuses = append(options.Statuses, CommandStatus(status))
+		default:
+			return options, errors.New("invalid status: " + status)
+		}
+	}
+
+	if dir := query.Get("dir"); dir != "" {
+		options.WorkingDirectory = filepath.Clean(dir)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+
+		if err != nil || n < 1 || n > MaxPageSize {
+			return options, fmt.Errorf("limit must be between 1 and %v", MaxPageSize)
+		}
+
+		options.Limit = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+
+		if err != nil || c.Sort != options.Sort || c.Descending != options.Descending {
+			return options, ErrInvalidCursor
+		}
+
+		options.Cursor = &c
+	}
+
+	return options, nil
+}
+
+// encodeCursor returns the cursor as an opaque string
+func encodeCursor(c pageCursor) string {
+
+	data, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor made by encodeCursor
+func decodeCursor(s string) (pageCursor, error) {
+
+	var c pageCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(data, &c)
+
+	return c, err
+}
+
+// match returns true if the Command has one of the statuses and is in the working
+// directory or one of its subdirectories
+func (o ListOptions) match(cmd Command) bool {
+
+	if o.WorkingDirectory != "" {
+		dir := filepath.Clean(cmd.WorkingDirectory)
+
+		if dir != o.WorkingDirectory && !strings.HasPrefix(dir, strings.TrimSuffix(o.WorkingDirectory, "/")+"/") {
+			return false
+		}
+	}
+
+	if len(o.Statuses) == 0 {
+		return true
+	}
+
+	for _, status := range o.Statuses {
+		if cmd.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// key returns the position of the Command in the sort order
+func (o ListOptions) key(cmd Command, id string) pageKey {
+
+	key := pageKey{ID: id}
+
+	switch o.Sort {
+	case SortByDescription:
+		key.Text = strings.ToLower(cmd.Description)
+	case SortByLastRun:
+		if cmd.LastRunAt != nil {
+			key.Number = cmd.LastRunAt.UnixNano()
+		}
+	case SortByDuration:
+		key.Number = int64(cmd.Duration)
+	case SortByUsage:
+		key.Number = int64(cmd.RunCount)
+	}
+
+	return key
+}
+
+// less returns true if a comes before b in the sort order
+func (o ListOptions) less(a pageKey, b pageKey) bool {
+
+	c := strings.Compare(a.Text, b.Text)
+
+	if c == 0 && a.Number != b.Number {
+		c = 1
+
+		if a.Number < b.Number {
+			c = -1
+		}
+	}
+
+	if o.Descending {
+		c = -c
+	}
+
+	if c != 0 {
+		return c < 0
+	}
+
+	return a.ID < b.ID
+}
+
+// Apply filters, sorts and pages Commands. id returns what identifies a Command in the
+// list, such as its hash or its run ID. It returns the page, the number of Commands that
+// passed the filter, and the cursor of the next page, which is empty on the last page.
+func (o ListOptions) Apply(cmds []Command, id func(Command) string) ([]Command, int, string, error) {
+
+	type entry struct {
+		cmd Command
+		key pageKey
+	}
+
+	entries := []entry{}
+
+	for _, cmd := range cmds {
+		if o.match(cmd) {
+			entries = append(entries, entry{cmd: cmd, key: o.key(cmd, id(cmd))})
+		}
+	}
+
+	if o.Sort != "" {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return o.less(entries[i].key, entries[j].key)
+		})
+	}
+
+	start := 0
+
+	if o.Cursor != nil {
+		if o.Sort == "" {
+			start = -1
+
+			for index, e := range entries {
+				if e.key.ID == o.Cursor.Key.ID {
+					start = index + 1
+					break
+				}
+			}
+
+			if start < 0 {
+				return nil, 0, "", ErrStaleCursor
+			}
+		} else {
+			start = sort.Search(len(entries), func(i int) bool {
+				return o.less(o.Cursor.Key, entries[i].key)
+			})
+		}
+	}
+
+	end := len(entries)
+	next := ""
+
+	if o.Limit > 0 && start+o.Limit < end {
+		end = start + o.Limit
+		next = encodeCursor(pageCursor{Sort: o.Sort, Descending: o.Descending, Key: entries[end-1].key})
+	}
+
+	page := []Command{}
+
+	for _, e := range entries[start:end] {
+		page = append(page, e.cmd)
+	}
+
+	return page, len(entries), next, nil
+}
+
+// writePage writes a page of a list with the total number of items in the X-Total-Count
+// header and the cursor of the next page in the X-Next-Cursor header. The ETag header is a
+// hash of the response, and if the client already has it status 304 is returned without
+// a body.
+func writePage(w http.ResponseWriter, r *http.Request, v interface{}, total int, next string) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	out, err := json.Marshal(v)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Unable to encode response: "+err.Error(), nil)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(out))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(out))
+}
@@ -0,0 +1,107 @@
+package dmn
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestListOptions(t *testing.T) {
+
+	lastRun := time.Now()
+
+	cmds := []Command{
+		{CmdHash: "a", Description: "Backup", WorkingDirectory: "/srv/db", Status: Idle, RunCount: 5},
+		{CmdHash: "b", Description: "archive logs", WorkingDirectory: "/var/log", Status: Failed, RunCount: 1, LastRunAt: &lastRun},
+		{CmdHash: "c", Description: "check disk", WorkingDirectory: "/srv", Status: Idle, RunCount: 5},
+		{CmdHash: "d", Description: "deploy", WorkingDirectory: "/srv/app", Status: Idle},
+	}
+
+	id := func(cmd Command) string {
+		return cmd.CmdHash
+	}
+
+	// pages returns the hashes of every page
+	pages := func(query string) []string {
+		values, _ := url.ParseQuery(query)
+
+		var ret []string
+
+		for {
+			options, err := ParseListOptions(values)
+
+			if err != nil {
+				t.Fatalf("Unable to parse %q: %v", query, err)
+			}
+
+			page, total, next, err := options.Apply(cmds, id)
+
+			if err != nil {
+				t.Fatalf("Unable to apply %q: %v", query, err)
+			}
+
+			hashes := ""
+
+			for _, cmd := range page {
+				hashes += cmd.CmdHash
+			}
+
+			ret = append(ret, hashes+"/"+string(rune('0'+total)))
+
+			if next == "" {
+				return ret
+			}
+
+			values.Set("cursor", next)
+		}
+	}
+
+	expect := func(query string, expected ...string) {
+		actual := pages(query)
+
+		if len(actual) != len(expected) {
+			t.Errorf("%q returned %v, expected %v", query, actual, expected)
+			return
+		}
+
+		for index := range expected {
+			if actual[index] != expected[index] {
+				t.Errorf("%q returned %v, expected %v", query, actual, expected)
+				return
+			}
+		}
+	}
+
+	expect("", "abcd/4")
+	expect("limit=3", "abc/4", "d/4")
+	expect("sort=description&limit=2", "ba/4", "cd/4")
+	expect("sort=-usage&limit=1", "a/4", "c/4", "b/4", "d/4")
+	expect("sort=-lastRun", "bacd/4")
+	expect("status=Idle&dir=/srv&limit=2", "ac/3", "d/3")
+	expect("status=Failed&status=Cancelled", "b/1")
+
+	for _, query := range []string{"sort=name", "sort=-", "status=Done", "limit=0", "limit=1001", "cursor=abc"} {
+		values, _ := url.ParseQuery(query)
+
+		if _, err := ParseListOptions(values); err == nil {
+			t.Errorf("Accepted invalid options %q", query)
+		}
+	}
+
+	// A cursor is only valid for the sort order it was made for
+	options, _ := ParseListOptions(url.Values{"sort": {"usage"}, "limit": {"1"}})
+	_, _, next, _ := options.Apply(cmds, id)
+
+	if _, err := ParseListOptions(url.Values{"sort": {"duration"}, "cursor": {next}}); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor but got %v", err)
+	}
+
+	// Without a sort order the cursor needs the Command it points at
+	options, _ = ParseListOptions(url.Values{"limit": {"1"}})
+	_, _, next, _ = options.Apply(cmds, id)
+	options, _ = ParseListOptions(url.Values{"cursor": {next}})
+
+	if _, _, _, err := options.Apply(cmds[1:], id); err != ErrStaleCursor {
+		t.Errorf("Expected ErrStaleCursor but got %v", err)
+	}
+}
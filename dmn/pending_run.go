@@ -0,0 +1,249 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// The pending runs file
+	recmdPendingRunsFile = "recmd_pending_runs.json"
+)
+
+// ErrRunNotFound is returned when there is no waiting run with an ID
+var ErrRunNotFound = errors.New("run not found")
+
+// PendingRun represents a one-shot run of a Command at a later time. If Priority is set
+// it overrides the priority of the Command. RunBy is the user who asked for the run.
+type PendingRun struct {
+	ID        string    `json:"id"`
+	CmdHash   string    `json:"commandHash"`
+	RunAt     time.Time `json:"runAt"`
+	RunBy     string    `json:"runBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Priority  *int      `json:"priority,omitempty"`
+}
+
+// ParseRunAt parses the time a pending run should start. It accepts RFC 3339 timestamps,
+// or a time of day such as 02:00 which means the next time the clock shows that time.
+func ParseRunAt(value string, now time.Time) (time.Time, error) {
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		clock, err := time.ParseInLocation(layout, value, now.Location())
+		if err != nil {
+			continue
+		}
+
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// PendingRunFile represents the file containing the pending runs. Pending runs are
+// persisted so that they survive a restart of the daemon.
+type PendingRunFile struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Set sets the path to the pending runs file
+func (f *PendingRunFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdPendingRunsFile)
+}
+
+// WritePendingRunsToFile creates an empty pending runs file if it doesn't exist
+func (f *PendingRunFile) WritePendingRunsToFile() error {
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		return ioutil.WriteFile(f.Path, []byte(nil), os.FileMode(0644))
+	}
+
+	return nil
+}
+
+// ReadPendingRuns reads the pending runs file
+func (f *PendingRunFile) ReadPendingRuns() ([]PendingRun, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.read()
+}
+
+func (f *PendingRunFile) read() ([]PendingRun, error) {
+
+	var runs []PendingRun
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return runs, err
+	}
+
+	if len(data) == 0 {
+		return runs, nil
+	}
+
+	err = json.Unmarshal(data, &runs)
+
+	return runs, err
+}
+
+func (f *PendingRunFile) write(runs []PendingRun) error {
+
+	data, err := json.MarshalIndent(runs, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.Path, data, os.FileMode(0644))
+}
+
+// AddPendingRun appends a pending run to the file
+func (f *PendingRunFile) AddPendingRun(run PendingRun) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	runs, err := f.read()
+
+	if err != nil {
+		return err
+	}
+
+	return f.write(append(runs, run))
+}
+
+// RemovePendingRun removes the pending run with the given ID and returns it
+func (f *PendingRunFile) RemovePendingRun(id string) (PendingRun, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	runs, err := f.read()
+
+	if err != nil {
+		return PendingRun{}, err
+	}
+
+	for index, run := range runs {
+		if run.ID == id {
+			runs = append(runs[:index], runs[index+1:]...)
+			return run, f.write(runs)
+		}
+	}
+
+	return PendingRun{}, fmt.Errorf("%w: %v", ErrRunNotFound, id)
+}
+
+// UpdatePendingRunPriority sets the priority of the pending run with the given ID
+func (f *PendingRunFile) UpdatePendingRunPriority(id string, priority int) (PendingRun, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	runs, err := f.read()
+
+	if err != nil {
+		return PendingRun{}, err
+	}
+
+	for index := range runs {
+		if runs[index].ID == id {
+			runs[index].Priority = &priority
+			return runs[index], f.write(runs)
+		}
+	}
+
+	return PendingRun{}, fmt.Errorf("%w: %v", ErrRunNotFound, id)
+}
+
+// RestorePendingRuns starts the timers for the pending runs in the file. Runs that
+// should have started while the daemon was down start immediately. The runs count
+// against the maximum number of concurrent runs of the users who scheduled them, even
+// if they are more than the maximum.
+func (a *App) RestorePendingRuns() {
+
+	runs, err := a.PendingRuns.ReadPendingRuns()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read pending runs: %v\n", err)
+		return
+	}
+
+	for _, run := range runs {
+		a.DmnLogFile.Log.Printf("Restoring pending run %v for %v at %v\n", run.ID, run.CmdHash, run.RunAt)
+		a.Limiter.StartRun(pendingRunKey(run.RunBy), 0)
+		a.startPendingRunTimer(run)
+	}
+}
+
+// startPendingRunTimer runs the pending run when it is due
+func (a *App) startPendingRunTimer(run PendingRun) {
+
+	timer := time.AfterFunc(time.Until(run.RunAt), func() {
+		a.firePendingRun(run.ID)
+	})
+
+	a.CommandScheduler.pendingMutex.Lock()
+	defer a.CommandScheduler.pendingMutex.Unlock()
+
+	a.CommandScheduler.pendingTimers[run.ID] = timer
+}
+
+// firePendingRun removes the pending run from the file and runs its Command
+func (a *App) firePendingRun(id string) {
+
+	a.CommandScheduler.pendingMutex.Lock()
+	delete(a.CommandScheduler.pendingTimers, id)
+	a.CommandScheduler.pendingMutex.Unlock()
+
+	run, err := a.PendingRuns.RemovePendingRun(id)
+
+	if err != nil {
+		// The run was cancelled
+		a.DmnLogFile.Log.Printf("Unable to start pending run: %v\n", err)
+		return
+	}
+
+	a.Limiter.FinishRun(pendingRunKey(run.RunBy))
+
+	selectedCmd, err := a.SelectCmd(run.CmdHash)
+
+	if err != nil || selectedCmd.CmdHash == "" {
+		a.DmnLogFile.Log.Printf("Unable to select command %v for pending run %v\n", run.CmdHash, run.ID)
+		return
+	}
+
+	selectedCmd.RunID = run.ID
+	selectedCmd.RunBy = run.RunBy
+
+	if run.Priority != nil {
+		selectedCmd.Priority = *run.Priority
+	}
+
+	sc, err := a.RunCmd(selectedCmd)
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to start pending run %v: %v\n", run.ID, err)
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Pending run %v completed: %v\n", run.ID, sc.Status)
+}
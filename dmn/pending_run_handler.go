@@ -0,0 +1,237 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleRunLater schedules a one-shot run of a Command after a delay or at a given time.
+// Unlike HandleRun it returns the pending run right away instead of waiting for the
+// Command to complete.
+func (a *App) HandleRunLater(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, RunCommands)
+
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	var runAt time.Time
+
+	if variables.Delay != "" {
+		delay, err := time.ParseDuration(variables.Delay)
+
+		if err != nil || delay <= 0 {
+			a.DmnLogFile.Log.Printf("Invalid delay: %v\n", variables.Delay)
+			writeError(w, http.StatusUnprocessableEntity, "invalid delay: "+variables.Delay, nil)
+			return
+		}
+
+		runAt = now.Add(delay)
+	} else {
+		runAt, err = ParseRunAt(variables.RunAt, now)
+
+		if err != nil {
+			a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid run time", err)
+			return
+		}
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, RunCommands, selectedCmd) {
+		return
+	}
+
+	run, err := a.RunCmdAt(selectedCmd.CmdHash, runAt, user.Name)
+
+	if errors.Is(err, ErrTooManyRuns) {
+		a.DmnLogFile.Log.Printf("Too many concurrent runs for %v from %v\n", routeTemplate(r), remoteAddr(r))
+		tooManyRequests(w, time.Second, err.Error())
+		return
+	}
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to schedule run", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditRun, CmdHash: run.CmdHash, RunID: run.ID, Detail: "at " + run.RunAt.Format(time.RFC3339)})
+
+	out, err := json.Marshal(run)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleCancel cancels a pending run, or a run that is queued or running
+func (a *App) HandleCancel(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, RunCommands)
+
+	if !ok {
+		return
+	}
+
+	if !a.authorizeRun(w, r, user, RunCommands, variables.RunID) {
+		return
+	}
+
+	var cancelled interface{}
+
+	// The run is either pending or already on the queue
+	cancelled, err = a.CancelRun(variables.RunID)
+
+	if err != nil {
+		cancelled, err = a.CancelQueuedRun(variables.RunID)
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to cancel run", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditCancel, RunID: variables.RunID})
+
+	out, err := json.Marshal(cancelled)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// RunCmdAt creates a pending run of a Command that starts at runAt on behalf of runBy.
+// The run counts against the maximum number of concurrent runs of runBy until it starts
+// or is cancelled.
+func (a *App) RunCmdAt(cmdHash string, runAt time.Time, runBy string) (PendingRun, error) {
+
+	selectedCmd, err := a.SelectCmd(cmdHash)
+
+	if err != nil {
+		return PendingRun{}, err
+	}
+
+	if _, err := os.Stat(selectedCmd.WorkingDirectory); os.IsNotExist(err) {
+		return PendingRun{}, errors.New("invalid working directory: " + selectedCmd.WorkingDirectory)
+	}
+
+	run := PendingRun{
+		ID:        newID(),
+		CmdHash:   selectedCmd.CmdHash,
+		RunAt:     runAt,
+		RunBy:     runBy,
+		CreatedAt: time.Now(),
+	}
+
+	if !a.Limiter.StartRun(pendingRunKey(runBy), a.Settings.Limits.MaxConcurrentRuns) {
+		return PendingRun{}, ErrTooManyRuns
+	}
+
+	a.DmnLogFile.Log.Printf("Scheduling pending run %v for %v at %v\n", run.ID, run.CmdHash, run.RunAt)
+
+	if err := a.PendingRuns.AddPendingRun(run); err != nil {
+		a.Limiter.FinishRun(pendingRunKey(runBy))
+		return PendingRun{}, err
+	}
+
+	a.startPendingRunTimer(run)
+
+	return run, nil
+}
+
+// CancelRun cancels a pending run and returns it
+func (a *App) CancelRun(id string) (PendingRun, error) {
+
+	a.DmnLogFile.Log.Printf("Cancelling pending run %v\n", id)
+
+	a.CommandScheduler.pendingMutex.Lock()
+	if timer, ok := a.CommandScheduler.pendingTimers[id]; ok {
+		timer.Stop()
+		delete(a.CommandScheduler.pendingTimers, id)
+	}
+	a.CommandScheduler.pendingMutex.Unlock()
+
+	run, err := a.PendingRuns.RemovePendingRun(id)
+
+	if err == nil {
+		a.Limiter.FinishRun(pendingRunKey(run.RunBy))
+	}
+
+	return run, err
+}
+
+// CancelQueuedRun cancels a run that is queued or running and returns its Command. A run
+// that has not started is skipped by the scheduler, while a running one is killed.
+func (a *App) CancelQueuedRun(id string) (Command, error) {
+
+	a.DmnLogFile.Log.Printf("Cancelling queued run %v\n", id)
+
+	scheduler := &a.CommandScheduler
+
+	scheduler.queueMutex.Lock()
+	defer scheduler.queueMutex.Unlock()
+
+	if cmd, ok := scheduler.Runs.Find(id); ok && scheduler.cancelRun(id) {
+		return cmd, nil
+	}
+
+	return Command{}, fmt.Errorf("%w: %v is not queued or running", ErrRunNotFound, id)
+}
@@ -0,0 +1,116 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRunAt(t *testing.T) {
+
+	now := time.Date(2020, time.November, 1, 10, 30, 0, 0, time.Local)
+
+	runAt, err := ParseRunAt("02:00", now)
+
+	if err != nil || !runAt.Equal(time.Date(2020, time.November, 2, 2, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected run time for 02:00: %v %v", runAt, err)
+	}
+
+	runAt, err = ParseRunAt("11:15", now)
+
+	if err != nil || !runAt.Equal(time.Date(2020, time.November, 1, 11, 15, 0, 0, time.Local)) {
+		t.Errorf("Unexpected run time for 11:15: %v %v", runAt, err)
+	}
+
+	if _, err := ParseRunAt("tonight", now); err == nil {
+		t.Errorf("Accepted invalid run time")
+	}
+}
+
+func TestPendingRun(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if app.SaveCmd(cmd) != true {
+		t.Errorf("Unable to save command")
+	}
+
+	app.CreateScheduler()
+
+	run, err := app.RunCmdAt(cmd.CmdHash, time.Now().Add(time.Hour), "")
+
+	if err != nil {
+		t.Fatalf("Unable to schedule run: %v", err)
+	}
+
+	queued := app.QueueCmd()
+
+	if len(queued) != 1 || queued[0].RunID != run.ID || queued[0].Status != Scheduled {
+		t.Errorf("Pending run is not in the queue: %v", queued)
+	}
+
+	if _, err := app.CancelRun(run.ID); err != nil {
+		t.Errorf("Unable to cancel run: %v", err)
+	}
+
+	if queued := app.QueueCmd(); len(queued) != 0 {
+		t.Errorf("Cancelled run is still in the queue: %v", queued)
+	}
+
+	if len(app.Limiter.runs) != 0 {
+		t.Errorf("Cancelled run still counts against the limit: %v", app.Limiter.runs)
+	}
+}
+
+func TestRestorePendingRuns(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if app.SaveCmd(cmd) != true {
+		t.Errorf("Unable to save command")
+	}
+
+	app.CreateScheduler()
+	go app.RunScheduler()
+	go app.QueuedCommandsCleanup()
+
+	// Simulate a run that was due while the daemon was down
+	run := PendingRun{ID: newID(), CmdHash: cmd.CmdHash, RunAt: time.Now().Add(-time.Minute)}
+
+	if err := app.PendingRuns.AddPendingRun(run); err != nil {
+		t.Fatalf("Unable to add pending run: %v", err)
+	}
+
+	app.RestorePendingRuns()
+
+	for i := 0; i < 50; i++ {
+		selectedCmd, _ := app.SelectCmd(cmd.CmdHash)
+		runs, _ := app.PendingRuns.ReadPendingRuns()
+		if selectedCmd.Duration != -1 && len(runs) == 0 {
+			if !app.Limiter.StartRun(pendingRunKey(""), 1) {
+				t.Errorf("Restored run still counts against the limit after it started")
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Errorf("Restored pending run did not run")
+}
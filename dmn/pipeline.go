@@ -0,0 +1,326 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// The pipelines file
+	recmdPipelinesFile = "recmd_pipelines.json"
+)
+
+// ErrPipelineNotFound is returned when there is no pipeline with an ID
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+// StepCondition decides whether a step runs based on the steps it depends on
+type StepCondition string
+
+const (
+	// OnSuccess runs the step if all of its dependencies completed
+	OnSuccess StepCondition = "onSuccess"
+
+	// OnFailure runs the step if any of its dependencies failed
+	OnFailure StepCondition = "onFailure"
+
+	// Always runs the step once its dependencies are done, whatever their status
+	Always StepCondition = "always"
+)
+
+// FailurePolicy decides what a pipeline does after a step fails
+type FailurePolicy string
+
+const (
+	// StopOnFailure skips the remaining steps, except the ones that run on failure or always
+	StopOnFailure FailurePolicy = "stop"
+
+	// ContinueOnFailure keeps running the steps whose conditions are met
+	ContinueOnFailure FailurePolicy = "continue"
+)
+
+// PipelineStep represents a saved Command in a pipeline
+type PipelineStep struct {
+	Name      string        `json:"name"`
+	CmdHash   string        `json:"commandHash"`
+	DependsOn []string      `json:"dependsOn"`
+	Condition StepCondition `json:"condition"`
+}
+
+// Pipeline represents a DAG of saved Commands
+type Pipeline struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Steps         []PipelineStep `json:"steps"`
+	FailurePolicy FailurePolicy  `json:"failurePolicy"`
+}
+
+// PipelineStepResult represents the outcome of a single step. Result is not set if the
+// step was skipped.
+type PipelineStepResult struct {
+	Name    string            `json:"name"`
+	CmdHash string            `json:"commandHash"`
+	Status  CommandStatus     `json:"status"`
+	Skipped bool              `json:"skipped"`
+	Result  *ScheduledCommand `json:"result,omitempty"`
+}
+
+// PipelineRun represents the outcome of running a pipeline
+type PipelineRun struct {
+	PipelineID string               `json:"pipelineId"`
+	RunBy      string               `json:"runBy,omitempty"`
+	Status     CommandStatus        `json:"status"`
+	StartTime  time.Time            `json:"startTime"`
+	EndTime    time.Time            `json:"endTime"`
+	Steps      []PipelineStepResult `json:"steps"`
+}
+
+// Validate checks the steps and returns them in the order they should run
+func (p Pipeline) Validate() ([]PipelineStep, error) {
+
+	if len(p.Steps) == 0 {
+		return nil, errors.New("pipeline has no steps")
+	}
+
+	switch p.FailurePolicy {
+	case StopOnFailure, ContinueOnFailure:
+	default:
+		return nil, fmt.Errorf("invalid failure policy %q", p.FailurePolicy)
+	}
+
+	steps := make(map[string]PipelineStep)
+
+	for _, step := range p.Steps {
+		if step.Name == "" {
+			return nil, errors.New("step has no name")
+		}
+		if _, ok := steps[step.Name]; ok {
+			return nil, fmt.Errorf("duplicate step %q", step.Name)
+		}
+		switch step.Condition {
+		case OnSuccess, OnFailure, Always:
+		default:
+			return nil, fmt.Errorf("invalid condition %q for step %q", step.Condition, step.Name)
+		}
+		steps[step.Name] = step
+	}
+
+	for _, step := range p.Steps {
+		for _, dependency := range step.DependsOn {
+			if _, ok := steps[dependency]; !ok {
+				return nil, fmt.Errorf("step %q depends on unknown step %q", step.Name, dependency)
+			}
+		}
+	}
+
+	// Sort the steps topologically, keeping the order of definition where possible
+	var ordered []PipelineStep
+
+	done := make(map[string]bool)
+
+	for len(ordered) < len(p.Steps) {
+
+		progress := false
+
+		for _, step := range p.Steps {
+			if done[step.Name] {
+				continue
+			}
+
+			ready := true
+			for _, dependency := range step.DependsOn {
+				if !done[dependency] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				ordered = append(ordered, step)
+				done[step.Name] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			return nil, errors.New("pipeline contains a cycle")
+		}
+	}
+
+	return ordered, nil
+}
+
+// shouldRun decides whether a step runs given the results of the steps before it
+func (p Pipeline) shouldRun(step PipelineStep, results map[string]PipelineStepResult, failed bool) bool {
+
+	if failed && p.FailurePolicy == StopOnFailure && step.Condition == OnSuccess {
+		return false
+	}
+
+	allCompleted := true
+	anyFailed := false
+
+	for _, dependency := range step.DependsOn {
+		switch results[dependency].Status {
+		case Completed:
+		case Failed:
+			allCompleted = false
+			anyFailed = true
+		default:
+			allCompleted = false
+		}
+	}
+
+	switch step.Condition {
+	case OnSuccess:
+		return allCompleted
+	case OnFailure:
+		return anyFailed
+	}
+
+	return true
+}
+
+// cmdHashes returns the hashes of the Commands of the steps
+func (p Pipeline) cmdHashes() []string {
+
+	hashes := []string{}
+
+	for _, step := range p.Steps {
+		hashes = append(hashes, step.CmdHash)
+	}
+
+	return hashes
+}
+
+// uses returns true if one of the steps is one of the Commands in cmdHashes
+func (p Pipeline) uses(cmdHashes map[string]bool) bool {
+
+	for _, step := range p.Steps {
+		if cmdHashes[step.CmdHash] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PipelineFile represents the file containing the pipelines
+type PipelineFile struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Set sets the path to the pipelines file
+func (f *PipelineFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdPipelinesFile)
+}
+
+// WritePipelinesToFile creates an empty pipelines file if it doesn't exist
+func (f *PipelineFile) WritePipelinesToFile() error {
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		return ioutil.WriteFile(f.Path, []byte(nil), os.FileMode(0644))
+	}
+
+	return nil
+}
+
+// ReadPipelines reads the pipelines file
+func (f *PipelineFile) ReadPipelines() ([]Pipeline, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.read()
+}
+
+func (f *PipelineFile) read() ([]Pipeline, error) {
+
+	var pipelines []Pipeline
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return pipelines, err
+	}
+
+	if len(data) == 0 {
+		return pipelines, nil
+	}
+
+	err = json.Unmarshal(data, &pipelines)
+
+	return pipelines, err
+}
+
+func (f *PipelineFile) write(pipelines []Pipeline) error {
+
+	data, err := json.MarshalIndent(pipelines, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.Path, data, os.FileMode(0644))
+}
+
+// AddPipeline appends a pipeline to the file
+func (f *PipelineFile) AddPipeline(p Pipeline) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	pipelines, err := f.read()
+
+	if err != nil {
+		return err
+	}
+
+	return f.write(append(pipelines, p))
+}
+
+// GetPipeline returns the pipeline with the given ID
+func (f *PipelineFile) GetPipeline(id string) (Pipeline, error) {
+
+	pipelines, err := f.ReadPipelines()
+
+	if err != nil {
+		return Pipeline{}, err
+	}
+
+	for _, p := range pipelines {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+
+	return Pipeline{}, fmt.Errorf("%w: %v", ErrPipelineNotFound, id)
+}
+
+// DeletePipeline removes the pipeline with the given ID and returns it
+func (f *PipelineFile) DeletePipeline(id string) (Pipeline, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	pipelines, err := f.read()
+
+	if err != nil {
+		return Pipeline{}, err
+	}
+
+	for index, p := range pipelines {
+		if p.ID == id {
+			pipelines = append(pipelines[:index], pipelines[index+1:]...)
+			return p, f.write(pipelines)
+		}
+	}
+
+	return Pipeline{}, fmt.Errorf("%w: %v", ErrPipelineNotFound, id)
+}
@@ -0,0 +1,358 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandlePipelines lists the pipelines whose steps are all Commands that the user can see
+func (a *App) HandlePipelines(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
+		return
+	}
+
+	pipelines, err := a.Pipelines.ReadPipelines()
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read pipelines", err)
+		return
+	}
+
+	// Pipelines with a step in the library of another user are left out
+	hidden, err := a.hiddenCmds(user)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read history file", err)
+		return
+	}
+
+	visible := []Pipeline{}
+
+	for _, p := range pipelines {
+		if !p.uses(hidden) {
+			visible = append(visible, p)
+		}
+	}
+
+	out, err := json.Marshal(visible)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleAddPipeline adds a pipeline. The pipeline is passed in as base64 encoded JSON.
+func (a *App) HandleAddPipeline(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	var p Pipeline
+
+	if err := json.Unmarshal([]byte(variables.Pipeline), &p); err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to parse pipeline", err)
+		return
+	}
+
+	// Commands in the libraries of other users are not found
+	for _, step := range p.Steps {
+		cmd, err := a.SelectUserCmd(user, step.CmdHash)
+
+		if err != nil {
+			message := fmt.Sprintf("Unable to add pipeline: step %v: %v", step.Name, err)
+			a.DmnLogFile.Log.Println(message)
+			writeError(w, http.StatusUnprocessableEntity, message, nil)
+			return
+		}
+
+		if !a.authorizeCmd(w, r, user, EditCommands, cmd) {
+			return
+		}
+	}
+
+	p, err = a.AddPipeline(p)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to add pipeline", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditPipeline, Detail: "add " + p.ID})
+
+	out, err := json.Marshal(p)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleDeletePipeline deletes a pipeline. Pipelines with a step in the library of another
+// user are not found.
+func (a *App) HandleDeletePipeline(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	p, err := a.Pipelines.GetPipeline(variables.PipelineID)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to delete pipeline", err)
+		return
+	}
+
+	if !a.authorizeCmds(w, r, user, EditCommands, p.cmdHashes(), fmt.Errorf("%w: %v", ErrPipelineNotFound, p.ID)) {
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Deleting pipeline %v\n", variables.PipelineID)
+
+	p, err = a.Pipelines.DeletePipeline(variables.PipelineID)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to delete pipeline", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditPipeline, Detail: "delete " + p.ID})
+
+	out, err := json.Marshal(p)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleRunPipeline runs a pipeline and returns the result of every step. Like HandleRun,
+// status 200 is returned whether or not the steps were successful.
+func (a *App) HandleRunPipeline(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, RunCommands)
+
+	if !ok {
+		return
+	}
+
+	// Every step must be a Command that the user may run
+	if p, err := a.Pipelines.GetPipeline(variables.PipelineID); err == nil {
+		for _, step := range p.Steps {
+			cmd, err := a.SelectUserCmd(user, step.CmdHash)
+
+			if err != nil {
+				message := fmt.Sprintf("Unable to run pipeline: step %v: %v", step.Name, err)
+				a.DmnLogFile.Log.Println(message)
+				writeError(w, http.StatusUnprocessableEntity, message, nil)
+				return
+			}
+
+			if !a.authorizeCmd(w, r, user, RunCommands, cmd) {
+				return
+			}
+		}
+	}
+
+	pipelineRun, err := a.RunPipeline(variables.PipelineID, user.Name)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to run pipeline", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditPipeline, Detail: fmt.Sprintf("run %v: %v", variables.PipelineID, pipelineRun.Status)})
+
+	out, err := json.Marshal(pipelineRun)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// AddPipeline validates a pipeline and saves it. Hash prefixes in the steps are resolved
+// to the full hash of the Command.
+func (a *App) AddPipeline(p Pipeline) (Pipeline, error) {
+
+	if p.FailurePolicy == "" {
+		p.FailurePolicy = StopOnFailure
+	}
+
+	for index := range p.Steps {
+		if p.Steps[index].Condition == "" {
+			p.Steps[index].Condition = OnSuccess
+		}
+
+		selectedCmd, err := a.SelectCmd(p.Steps[index].CmdHash)
+
+		if err != nil {
+			return Pipeline{}, err
+		}
+
+		if p.Steps[index].CmdHash == "" || selectedCmd.CmdHash == "" {
+			return Pipeline{}, errors.New("command hash not found for step " + p.Steps[index].Name)
+		}
+
+		p.Steps[index].CmdHash = selectedCmd.CmdHash
+	}
+
+	if _, err := p.Validate(); err != nil {
+		return Pipeline{}, err
+	}
+
+	p.ID = newID()
+
+	a.DmnLogFile.Log.Printf("Adding pipeline %v: %v\n", p.ID, p.Name)
+
+	return p, a.Pipelines.AddPipeline(p)
+}
+
+// RunPipeline runs the steps of a pipeline one at a time through the scheduler on behalf
+// of runBy
+func (a *App) RunPipeline(id string, runBy string) (PipelineRun, error) {
+
+	p, err := a.Pipelines.GetPipeline(id)
+
+	if err != nil {
+		return PipelineRun{}, err
+	}
+
+	steps, err := p.Validate()
+
+	if err != nil {
+		return PipelineRun{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Running pipeline %v\n", p.ID)
+
+	pipelineRun := PipelineRun{PipelineID: p.ID, RunBy: runBy, Status: Completed, StartTime: time.Now()}
+
+	results := make(map[string]PipelineStepResult)
+
+	failed := false
+
+	for _, step := range steps {
+
+		result := PipelineStepResult{Name: step.Name, CmdHash: step.CmdHash, Status: Idle, Skipped: true}
+
+		if p.shouldRun(step, results, failed) {
+
+			selectedCmd, err := a.SelectCmd(step.CmdHash)
+			selectedCmd.RunBy = runBy
+
+			var sc ScheduledCommand
+
+			if err != nil || selectedCmd.CmdHash == "" {
+				sc.CmdHash = step.CmdHash
+				sc.Status = Failed
+				sc.Coutput = "Unable to select hash: " + step.CmdHash
+			} else if _, err := os.Stat(selectedCmd.WorkingDirectory); os.IsNotExist(err) {
+				sc.Command = selectedCmd
+				sc.Status = Failed
+				sc.Coutput = "Invalid working directory: " + selectedCmd.WorkingDirectory
+			} else if sc, err = a.RunCmd(selectedCmd); err != nil {
+				sc.Command = selectedCmd
+				sc.Status = Failed
+				sc.Coutput = err.Error()
+			}
+
+			result.Skipped = false
+			result.Status = sc.Status
+			result.Result = &sc
+
+			if sc.Status != Completed {
+				failed = true
+				pipelineRun.Status = Failed
+			}
+		}
+
+		a.DmnLogFile.Log.Printf("Pipeline %v step %v: %v\n", p.ID, step.Name, result.Status)
+
+		results[step.Name] = result
+		pipelineRun.Steps = append(pipelineRun.Steps, result)
+	}
+
+	pipelineRun.EndTime = time.Now()
+
+	return pipelineRun, nil
+}
@@ -0,0 +1,98 @@
+package dmn
+
+import (
+	"testing"
+)
+
+func TestPipelineValidate(t *testing.T) {
+
+	p := Pipeline{
+		FailurePolicy: StopOnFailure,
+		Steps: []PipelineStep{
+			{Name: "deploy", DependsOn: []string{"test"}, Condition: OnSuccess},
+			{Name: "build", DependsOn: []string{"fetch"}, Condition: OnSuccess},
+			{Name: "test", DependsOn: []string{"build"}, Condition: OnSuccess},
+			{Name: "fetch", Condition: OnSuccess},
+		},
+	}
+
+	steps, err := p.Validate()
+
+	if err != nil {
+		t.Fatalf("Unable to validate pipeline: %v", err)
+	}
+
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+
+	if len(names) != 4 || names[0] != "fetch" || names[1] != "build" || names[2] != "test" || names[3] != "deploy" {
+		t.Errorf("Steps are in the wrong order: %v", names)
+	}
+
+	p.Steps[3].DependsOn = []string{"deploy"}
+
+	if _, err := p.Validate(); err == nil {
+		t.Errorf("Accepted pipeline with a cycle")
+	}
+}
+
+func TestPipelineHandler(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	app.CreateScheduler()
+	go app.RunScheduler()
+	go app.QueuedCommandsCleanup()
+
+	var ok, fail, notify, deploy Command
+	ok.Set("true", "succeed", ".")
+	fail.Set("false", "fail", ".")
+	notify.Set("echo notify", "notify", ".")
+	deploy.Set("echo deploy", "deploy", ".")
+
+	for _, cmd := range []Command{ok, fail, notify, deploy} {
+		if app.SaveCmd(cmd) != true {
+			t.Errorf("Unable to save command")
+		}
+	}
+
+	p, err := app.AddPipeline(Pipeline{
+		Name: "release",
+		Steps: []PipelineStep{
+			{Name: "build", CmdHash: ok.CmdHash},
+			{Name: "test", CmdHash: fail.CmdHash, DependsOn: []string{"build"}},
+			{Name: "deploy", CmdHash: deploy.CmdHash, DependsOn: []string{"test"}},
+			{Name: "notify", CmdHash: notify.CmdHash, DependsOn: []string{"test"}, Condition: OnFailure},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("Unable to add pipeline: %v", err)
+	}
+
+	pipelineRun, err := app.RunPipeline(p.ID, "")
+
+	if err != nil {
+		t.Fatalf("Unable to run pipeline: %v", err)
+	}
+
+	if pipelineRun.Status != Failed {
+		t.Errorf("Pipeline should have failed")
+	}
+
+	expected := map[string]CommandStatus{"build": Completed, "test": Failed, "deploy": Idle, "notify": Completed}
+
+	for _, step := range pipelineRun.Steps {
+		if step.Status != expected[step.Name] {
+			t.Errorf("Step %v was %v, expected %v", step.Name, step.Status, expected[step.Name])
+		}
+	}
+}
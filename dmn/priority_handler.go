@@ -0,0 +1,176 @@
+package dmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandlePriority sets the priority of a Command
+func (a *App) HandlePriority(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	priority, err := ParsePriority(variables.Priority)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to parse priority", err)
+		return
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	updatedCmd, err := a.UpdateCommandPriority(selectedCmd.CmdHash, priority)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to update priority", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, CmdHash: updatedCmd.CmdHash, Detail: "priority", Before: &selectedCmd, After: &updatedCmd})
+
+	out, err := json.Marshal(updatedCmd)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleReprioritize changes the priority of a run that has not started yet, either
+// because it is waiting for the scheduler or because it is a pending run
+func (a *App) HandleReprioritize(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, RunCommands)
+
+	if !ok {
+		return
+	}
+
+	if !a.authorizeRun(w, r, user, RunCommands, variables.RunID) {
+		return
+	}
+
+	priority, err := ParsePriority(variables.Priority)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to parse priority", err)
+		return
+	}
+
+	run, err := a.Reprioritize(variables.RunID, priority)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to change priority of run", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, RunID: variables.RunID, Detail: fmt.Sprintf("priority %v", priority)})
+
+	out, err := json.Marshal(run)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// UpdateCommandPriority stores the priority with the Command
+func (a *App) UpdateCommandPriority(value string, priority int) (Command, error) {
+
+	selectedCmd, err := a.SelectCmd(value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Updating priority for %v to %v\n", selectedCmd.CmdHash, priority)
+
+	return a.History.UpdateCmd(selectedCmd.CmdHash, func(cmd *Command) {
+		cmd.Priority = priority
+	})
+}
+
+// Reprioritize changes the priority of a run that is waiting for the scheduler or of a
+// pending run. It returns the queued Command or the PendingRun.
+func (a *App) Reprioritize(runID string, priority int) (interface{}, error) {
+
+	a.DmnLogFile.Log.Printf("Changing priority of run %v to %v\n", runID, priority)
+
+	scheduler := &a.CommandScheduler
+
+	scheduler.queueMutex.Lock()
+	found := scheduler.reprioritize(runID, priority)
+	scheduler.queueMutex.Unlock()
+
+	if found {
+		if cmd, ok := scheduler.Runs.Find(runID); ok {
+			return cmd, nil
+		}
+	}
+
+	run, err := a.PendingRuns.UpdatePendingRunPriority(runID, priority)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v is not waiting", ErrRunNotFound, runID)
+	}
+
+	return run, nil
+}
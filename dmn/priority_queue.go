@@ -0,0 +1,185 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AgingInterval is how long a run waits before it is treated as one priority level
+// higher. This keeps low priority runs from waiting forever behind high priority ones.
+var AgingInterval = 30 * time.Second
+
+const (
+	// MinPriority is the lowest priority a run can have
+	MinPriority = -100
+
+	// MaxPriority is the highest priority a run can have
+	MaxPriority = 100
+)
+
+// queuedRun is a run waiting for the scheduler. If done is nil the result is put on the
+// CompletedQueue, otherwise it is sent to done. A run that is waiting to be retried has
+// the attempts that failed so far.
+type queuedRun struct {
+	cmd        Command
+	enqueuedAt time.Time
+	seq        uint64
+	done       chan ScheduledCommand
+	attempts   []ScheduledCommand
+}
+
+// before returns true if r should run before other. A run gains one priority level for
+// every AgingInterval it has waited. Since every run ages at the same rate the order
+// only depends on the priority and the time the runs were queued. Runs that are still
+// tied run in the order they were queued.
+func (r queuedRun) before(other queuedRun) bool {
+
+	lead := time.Duration(clampPriority(r.cmd.Priority)-clampPriority(other.cmd.Priority))*AgingInterval + other.enqueuedAt.Sub(r.enqueuedAt)
+
+	if lead != 0 {
+		return lead > 0
+	}
+
+	return r.seq < other.seq
+}
+
+// ParsePriority parses a priority. Higher values run first and the default is 0.
+// Priorities range from MinPriority to MaxPriority.
+func ParsePriority(value string) (int, error) {
+
+	priority, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, errors.New("invalid priority: " + value)
+	}
+
+	if priority < MinPriority || priority > MaxPriority {
+		return 0, fmt.Errorf("priority must be between %v and %v: %v", MinPriority, MaxPriority, value)
+	}
+
+	return priority, nil
+}
+
+// clampPriority limits a priority to the range that ParsePriority accepts, for Commands
+// whose priority was saved before the range was enforced. This keeps the lead of one
+// run over another from overflowing.
+func clampPriority(priority int) int {
+
+	if priority < MinPriority {
+		return MinPriority
+	}
+
+	if priority > MaxPriority {
+		return MaxPriority
+	}
+
+	return priority
+}
+
+// createWaiting initializes the list of waiting runs
+func (s *Scheduler) createWaiting() {
+	s.waitingCond = sync.NewCond(&s.queueMutex)
+}
+
+// push adds a run to the waiting runs. The caller must hold queueMutex.
+func (s *Scheduler) push(cmd Command, done chan ScheduledCommand) {
+	s.requeue(queuedRun{cmd: cmd, done: done})
+}
+
+// requeue adds a run to the back of the waiting runs. The caller must hold queueMutex.
+func (s *Scheduler) requeue(run queuedRun) {
+
+	s.seq++
+	run.enqueuedAt = time.Now()
+	run.seq = s.seq
+	s.waiting = append(s.waiting, run)
+	s.waitingCond.Signal()
+}
+
+// next blocks until there is a waiting run and removes the one that should run first
+func (s *Scheduler) next() queuedRun {
+
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	for len(s.waiting) == 0 {
+		s.waitingCond.Wait()
+	}
+
+	first := 0
+
+	for index := range s.waiting {
+		if s.waiting[index].before(s.waiting[first]) {
+			first = index
+		}
+	}
+
+	run := s.waiting[first]
+	s.waiting = append(s.waiting[:first], s.waiting[first+1:]...)
+
+	return run
+}
+
+// complete delivers the result of a run
+func (s *Scheduler) complete(run queuedRun, sc ScheduledCommand) {
+
+	if run.done != nil {
+		run.done <- sc
+		return
+	}
+
+	s.CompletedQueue <- sc
+}
+
+// feedCommandQueue adds the Commands put on the CommandQueue to the waiting runs
+func (s *Scheduler) feedCommandQueue() {
+
+	for cmd := range s.CommandQueue {
+		s.queueMutex.Lock()
+		s.push(cmd, nil)
+		s.queueMutex.Unlock()
+	}
+}
+
+// positions returns the position of every waiting run by run ID, starting at 1 for the
+// run that will start next. The caller must hold queueMutex.
+func (s *Scheduler) positions() map[string]int {
+
+	ordered := append([]queuedRun{}, s.waiting...)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].before(ordered[j])
+	})
+
+	positions := make(map[string]int)
+
+	for index, run := range ordered {
+		positions[run.cmd.RunID] = index + 1
+	}
+
+	return positions
+}
+
+// reprioritize changes the priority of a waiting run. It returns false if the run is not
+// waiting. The caller must hold queueMutex.
+func (s *Scheduler) reprioritize(runID string, priority int) bool {
+
+	found := false
+
+	for index := range s.waiting {
+		if s.waiting[index].cmd.RunID == runID {
+			s.waiting[index].cmd.Priority = priority
+			found = true
+		}
+	}
+
+	if found {
+		s.Runs.SetPriority(runID, priority)
+	}
+
+	return found
+}
@@ -0,0 +1,116 @@
+package dmn
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQueuedRunAging(t *testing.T) {
+
+	now := time.Now()
+
+	low := queuedRun{cmd: Command{Priority: 0}, enqueuedAt: now.Add(-2 * AgingInterval), seq: 1}
+	high := queuedRun{cmd: Command{Priority: 1}, enqueuedAt: now, seq: 2}
+
+	if !low.before(high) {
+		t.Errorf("Low priority run that waited for two aging intervals should run first")
+	}
+
+	low.enqueuedAt = now.Add(-AgingInterval / 2)
+
+	if low.before(high) {
+		t.Errorf("High priority run should run first")
+	}
+
+	tied := queuedRun{cmd: Command{Priority: 1}, enqueuedAt: now, seq: 3}
+
+	if !high.before(tied) || tied.before(high) {
+		t.Errorf("Tied runs should run in the order they were queued")
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+
+	if priority, err := ParsePriority("-100"); err != nil || priority != MinPriority {
+		t.Errorf("Expected the lowest priority but got %v: %v", priority, err)
+	}
+
+	for _, value := range []string{"101", "-101", "9223372036854775807", "high"} {
+		if _, err := ParsePriority(value); err == nil {
+			t.Errorf("Expected priority %v to be rejected", value)
+		}
+	}
+
+	// Saved priorities outside of the range don't overflow the ordering
+	now := time.Now()
+
+	huge := queuedRun{cmd: Command{Priority: math.MaxInt32}, enqueuedAt: now, seq: 1}
+	low := queuedRun{cmd: Command{Priority: math.MinInt32}, enqueuedAt: now, seq: 2}
+
+	if !huge.before(low) || low.before(huge) {
+		t.Errorf("Expected the highest priority to run first")
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	// Keep the scheduler busy so that the next runs wait
+	var busy Command
+	busy.Set("sleep 1", "busy", ".")
+
+	go app.RunCmd(busy)
+
+	waitForQueuedStatus(t, app, busy.CmdHash, Running)
+
+	var low Command
+	low.Set("echo low", "low", ".")
+	low.RunID = newID()
+
+	var high Command
+	high.Set("echo high", "high", ".")
+	high.RunID = newID()
+
+	finished := make(chan string, 2)
+
+	for _, cmd := range []Command{low, high} {
+		cmd := cmd
+		go func() {
+			sc, _ := app.RunCmd(cmd)
+			finished <- sc.CmdHash
+		}()
+		waitForQueuedStatus(t, app, cmd.CmdHash, Scheduled)
+	}
+
+	queue := app.QueueCmd()
+
+	for _, cmd := range queue {
+		if cmd.RunID == high.RunID && cmd.Position != 2 {
+			t.Errorf("Expected the run that was queued last at position 2 but got %v", cmd.Position)
+		}
+	}
+
+	if _, err := app.Reprioritize(high.RunID, 5); err != nil {
+		t.Fatalf("Unable to reprioritize run: %v", err)
+	}
+
+	queue = app.QueueCmd()
+
+	for _, cmd := range queue {
+		if cmd.RunID == high.RunID && (cmd.Position != 1 || cmd.Priority != 5) {
+			t.Errorf("Expected reprioritized run at position 1 but got %v", cmd.Position)
+		}
+	}
+
+	if first := <-finished; first != high.CmdHash {
+		t.Errorf("Expected the high priority run to finish first")
+	}
+
+	<-finished
+
+	if _, err := app.Reprioritize(high.RunID, 1); err == nil {
+		t.Errorf("Reprioritized a run that already finished")
+	}
+}
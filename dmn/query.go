@@ -0,0 +1,652 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Fields that a query term can be restricted to
+const (
+	fieldDescription = "description"
+	fieldCommand     = "command"
+	fieldDirectory   = "dir"
+	fieldTag         = "tag"
+)
+
+// queryFields maps the field names accepted in a query to the fields of a Command
+var queryFields = map[string]string{
+	"description":      fieldDescription,
+	"desc":             fieldDescription,
+	"command":          fieldCommand,
+	"cmd":              fieldCommand,
+	"dir":              fieldDirectory,
+	"workingdirectory": fieldDirectory,
+	"tag":              fieldTag,
+	"tags":             fieldTag,
+}
+
+// fieldWeights makes a match in the description count more than a match in the
+// working directory
+var fieldWeights = map[string]float64{
+	fieldDescription: 3,
+	fieldCommand:     2,
+	fieldTag:         2,
+	fieldDirectory:   1,
+}
+
+// Highlight represents the part of a field that matched a query. Start and End are byte
+// offsets into the field. For tags, Index is the position of the tag.
+type Highlight struct {
+	Field string `json:"field"`
+	Index int    `json:"index,omitempty"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// SearchResult represents a Command that matched a query
+type SearchResult struct {
+	Command    Command     `json:"command"`
+	Score      float64     `json:"score"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Query represents a parsed search query
+type Query struct {
+	root queryNode
+}
+
+// fieldValue is a value of a Command that terms are matched against
+type fieldValue struct {
+	field string
+	index int
+	value string
+}
+
+// queryMatch is the result of evaluating a node against a Command
+type queryMatch struct {
+	matched    bool
+	score      float64
+	highlights []Highlight
+}
+
+type queryNode interface {
+	eval(values []fieldValue) queryMatch
+}
+
+type andNode struct{ children []queryNode }
+type orNode struct{ children []queryNode }
+type notNode struct{ child queryNode }
+
+// termNode matches a word, a phrase or a regular expression
+type termNode struct {
+	field   string
+	text    string
+	pattern *regexp.Regexp
+	regex   bool
+	fuzzy   bool
+}
+
+func (n andNode) eval(values []fieldValue) queryMatch {
+
+	ret := queryMatch{matched: true}
+
+	for _, child := range n.children {
+		m := child.eval(values)
+
+		if !m.matched {
+			return queryMatch{}
+		}
+
+		ret.score += m.score
+		ret.highlights = append(ret.highlights, m.highlights...)
+	}
+
+	return ret
+}
+
+func (n orNode) eval(values []fieldValue) queryMatch {
+
+	var ret queryMatch
+
+	for _, child := range n.children {
+		m := child.eval(values)
+
+		if m.matched {
+			ret.matched = true
+			ret.score += m.score
+			ret.highlights = append(ret.highlights, m.highlights...)
+		}
+	}
+
+	return ret
+}
+
+func (n notNode) eval(values []fieldValue) queryMatch {
+	return queryMatch{matched: !n.child.eval(values).matched}
+}
+
+func (n termNode) eval(values []fieldValue) queryMatch {
+
+	var ret queryMatch
+
+	for _, v := range values {
+		if n.field != "" && n.field != v.field {
+			continue
+		}
+
+		loc := n.pattern.FindStringIndex(v.value)
+
+		if loc == nil || loc[0] == loc[1] {
+			continue
+		}
+
+		score := fieldWeights[v.field]
+
+		// Whole words and whole tags count double
+		if isWordBoundary(v.value, loc[0]) && isWordBoundary(v.value, loc[1]) {
+			score *= 2
+		}
+
+		ret.matched = true
+		ret.score += score
+		ret.highlights = append(ret.highlights, Highlight{Field: v.field, Index: v.index, Start: loc[0], End: loc[1]})
+	}
+
+	if ret.matched || !n.fuzzy {
+		return ret
+	}
+
+	// Fall back to words that are a small number of edits away, at half the score
+	maxEdits := n.maxEdits()
+
+	for _, v := range values {
+		if n.field != "" && n.field != v.field {
+			continue
+		}
+
+		for _, w := range words(v.value) {
+			if levenshtein(strings.ToLower(v.value[w[0]:w[1]]), strings.ToLower(n.text)) <= maxEdits {
+				ret.matched = true
+				ret.score += fieldWeights[v.field] / 2
+				ret.highlights = append(ret.highlights, Highlight{Field: v.field, Index: v.index, Start: w[0], End: w[1]})
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// maxEdits returns the number of edits that a word can be away from a fuzzy term
+func (n termNode) maxEdits() int {
+
+	if len(n.text) >= 8 {
+		return 2
+	}
+
+	return 1
+}
+
+// isWordBoundary returns true if offset is at the start or end of a word in s
+func isWordBoundary(s string, offset int) bool {
+
+	if offset == 0 || offset == len(s) {
+		return true
+	}
+
+	isWord := func(r byte) bool {
+		return r == '_' || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r))
+	}
+
+	return isWord(s[offset-1]) != isWord(s[offset])
+}
+
+// words returns the start and end offsets of the words in s
+func words(s string) [][2]int {
+
+	var ret [][2]int
+
+	start := -1
+
+	for i, r := range s {
+		isWord := r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			ret = append(ret, [2]int{start, i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		ret = append(ret, [2]int{start, len(s)})
+	}
+
+	return ret
+}
+
+// levenshtein returns the number of single character edits needed to turn a into b
+func levenshtein(a string, b string) int {
+
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ParseQuery parses a search query. A query is made of terms that must all match. Terms
+// can be combined with OR, negated with NOT or a leading -, and grouped with parentheses.
+// A term is a word, a "quoted phrase" or a /regular expression/, and can be restricted to
+// a field with a prefix such as desc:, cmd:, dir: or tag:. Words and phrases are case
+// insensitive, and words of at least 4 characters also match words with a typo.
+func ParseQuery(query string) (Query, error) {
+
+	tokens, err := tokenizeQuery(query)
+
+	if err != nil {
+		return Query{}, err
+	}
+
+	if len(tokens) == 0 {
+		return Query{}, errors.New("empty query")
+	}
+
+	p := queryParser{tokens: tokens}
+
+	root, err := p.parseOr()
+
+	if err != nil {
+		return Query{}, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return Query{}, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return Query{root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	term termNode
+}
+
+// tokenizeQuery splits a query into operators, parentheses and terms
+func tokenizeQuery(query string) ([]queryToken, error) {
+
+	var tokens []queryToken
+
+	i := 0
+
+	for i < len(query) {
+		c := query[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "("})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")"})
+			i++
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] != ' ':
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-"})
+			i++
+			continue
+		}
+
+		// An optional field prefix
+		field := ""
+		j := i
+
+		for j < len(query) && unicode.IsLetter(rune(query[j])) {
+			j++
+		}
+
+		if j < len(query) && query[j] == ':' {
+			name, ok := queryFields[strings.ToLower(query[i:j])]
+
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", query[i:j])
+			}
+
+			field = name
+			i = j + 1
+		}
+
+		start := i
+		term := termNode{field: field}
+
+		switch {
+		case i < len(query) && query[i] == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+
+			if end < 0 {
+				return nil, errors.New("unterminated phrase")
+			}
+
+			term.text = query[i+1 : i+1+end]
+			term.pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(term.text))
+			i += end + 2
+
+		case i < len(query) && query[i] == '/' && regexEnd(query, i) > 0:
+			end := regexEnd(query, i)
+
+			term.text = strings.Replace(query[i+1:end], `\/`, "/", -1)
+
+			pattern, err := regexp.Compile(term.text)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression: %v", err)
+			}
+
+			term.pattern = pattern
+			term.regex = true
+			i = end + 1
+
+		default:
+			for i < len(query) && !strings.ContainsRune(" \t()", rune(query[i])) {
+				i++
+			}
+
+			term.text = query[start:i]
+
+			if field == "" {
+				switch term.text {
+				case "AND":
+					tokens = append(tokens, queryToken{kind: tokenAnd, text: term.text})
+					continue
+				case "OR":
+					tokens = append(tokens, queryToken{kind: tokenOr, text: term.text})
+					continue
+				case "NOT":
+					tokens = append(tokens, queryToken{kind: tokenNot, text: term.text})
+					continue
+				}
+			}
+
+			if term.text == "" {
+				return nil, errors.New("missing value for field " + field)
+			}
+
+			term.pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(term.text))
+			term.fuzzy = len(term.text) >= 4
+		}
+
+		tokens = append(tokens, queryToken{kind: tokenTerm, text: query[start:i], term: term})
+	}
+
+	return tokens, nil
+}
+
+// regexEnd returns the offset of the slash that closes the regular expression starting
+// at start, or -1 if there is none. The closing slash must be at the end of the term,
+// so that a path such as /srv/db is not mistaken for a regular expression.
+func regexEnd(query string, start int) int {
+
+	for end := start + 1; end < len(query); end++ {
+		switch query[end] {
+		case '\\':
+			end++
+		case '/':
+			if end+1 == len(query) || strings.ContainsRune(" \t)", rune(query[end+1])) {
+				return end
+			}
+		}
+	}
+
+	return -1
+}
+
+// queryParser is a recursive descent parser for the tokens of a query
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+
+	first, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{first}
+
+	for {
+		token, ok := p.peek()
+
+		if !ok || token.kind != tokenOr {
+			break
+		}
+
+		p.pos++
+
+		child, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+
+	return orNode{children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+
+	var children []queryNode
+
+	for {
+		token, ok := p.peek()
+
+		if !ok || token.kind == tokenOr || token.kind == tokenClose {
+			break
+		}
+
+		if token.kind == tokenAnd {
+			p.pos++
+			continue
+		}
+
+		child, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		children = append(children, child)
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, errors.New("missing search term")
+	case 1:
+		return children[0], nil
+	}
+
+	return andNode{children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+
+	token, ok := p.peek()
+
+	if !ok {
+		return nil, errors.New("missing search term")
+	}
+
+	p.pos++
+
+	switch token.kind {
+	case tokenNot:
+		child, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{child: child}, nil
+
+	case tokenOpen:
+		child, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, errors.New("missing )")
+		}
+
+		p.pos++
+
+		return child, nil
+
+	case tokenTerm:
+		return token.term, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// fieldValues returns the values of a Command that queries are matched against
+func fieldValues(cmd Command) []fieldValue {
+
+	values := []fieldValue{
+		{field: fieldDescription, value: cmd.Description},
+		{field: fieldCommand, value: cmd.CmdString},
+		{field: fieldDirectory, value: cmd.WorkingDirectory},
+	}
+
+	for index, tag := range cmd.Tags {
+		values = append(values, fieldValue{field: fieldTag, index: index, value: tag})
+	}
+
+	return values
+}
+
+// recencyBoost adds up to 1 to the score of a Command that was run recently. The boost
+// halves every week since the last run.
+func recencyBoost(cmd Command, now time.Time) float64 {
+
+	if cmd.LastRunAt == nil {
+		return 0
+	}
+
+	weeks := now.Sub(*cmd.LastRunAt).Hours() / (24 * 7)
+
+	if weeks < 0 {
+		weeks = 0
+	}
+
+	return math.Pow(0.5, weeks)
+}
+
+// Search returns the Commands that match the query, best match first. The score of a
+// Command depends on which fields matched and how recently the Command was run.
+func (q Query) Search(cmds []Command, now time.Time) []SearchResult {
+
+	results := []SearchResult{}
+
+	for _, cmd := range cmds {
+		m := q.root.eval(fieldValues(cmd))
+
+		if !m.matched {
+			continue
+		}
+
+		sort.SliceStable(m.highlights, func(i, j int) bool {
+			a, b := m.highlights[i], m.highlights[j]
+			if a.Field != b.Field {
+				return a.Field < b.Field
+			}
+			if a.Index != b.Index {
+				return a.Index < b.Index
+			}
+			return a.Start < b.Start
+		})
+
+		if m.highlights == nil {
+			m.highlights = []Highlight{}
+		}
+
+		results = append(results, SearchResult{
+			Command:    cmd,
+			Score:      m.score + recencyBoost(cmd, now),
+			Highlights: m.highlights,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results
+}
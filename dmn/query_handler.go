@@ -0,0 +1,82 @@
+package dmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleQuery searches the Commands with a query, see ParseQuery. The results are ranked
+// and can be filtered like in HandleList.
+func (a *App) HandleQuery(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
+		return
+	}
+
+	filter, _, err := ParseCommandFilter(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid filter", err)
+		return
+	}
+
+	results, err := a.QueryCmd(variables.Query, filter)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to search", err)
+		return
+	}
+
+	visible := []SearchResult{}
+
+	for _, result := range results {
+		if user.CanSee(result.Command) {
+			visible = append(visible, result)
+		}
+	}
+
+	results = visible
+
+	out, err := json.Marshal(results)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// QueryCmd returns the Commands that pass the filter and match the query, best match first
+func (a *App) QueryCmd(query string, filter CommandFilter) ([]SearchResult, error) {
+
+	a.DmnLogFile.Log.Println("Querying " + query)
+
+	q, err := ParseQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Search(filter.Apply(a.Index.QueryCmds(q)), time.Now()), nil
+}
@@ -0,0 +1,88 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+
+	now := time.Now()
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+
+	cmds := []Command{
+		{CmdHash: "backup", Description: "Back up the database", CmdString: "pg_dump app > app.sql", WorkingDirectory: "/srv/db", Tags: []string{"db", "backup"}},
+		{CmdHash: "restore", Description: "Restore the database", CmdString: "psql app < app.sql", WorkingDirectory: "/srv/db", Tags: []string{"db"}, LastRunAt: &lastWeek},
+		{CmdHash: "disk", Description: "Check disk space", CmdString: "df -h", WorkingDirectory: "/", Tags: []string{"ops"}},
+	}
+
+	search := func(query string) []string {
+		q, err := ParseQuery(query)
+
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", query, err)
+		}
+
+		var hashes []string
+
+		for _, result := range q.Search(cmds, now) {
+			hashes = append(hashes, result.Command.CmdHash)
+		}
+
+		return hashes
+	}
+
+	expect := func(query string, expected ...string) {
+		actual := search(query)
+
+		if len(actual) != len(expected) {
+			t.Errorf("%q matched %v, expected %v", query, actual, expected)
+			return
+		}
+
+		for index := range expected {
+			if actual[index] != expected[index] {
+				t.Errorf("%q matched %v, expected %v", query, actual, expected)
+				return
+			}
+		}
+	}
+
+	expect("database", "restore", "backup")
+	expect("database -tag:backup", "restore")
+	expect("database NOT restore", "backup")
+	expect("disk OR cmd:pg_dump", "disk", "backup")
+	expect("(disk OR restore) dir:/srv", "restore")
+	expect(`cmd:/^p\w+ app/`, "restore", "backup")
+	expect(`"up the"`, "backup")
+	expect("databsae", "restore", "backup")
+	expect("tag:ops AND space", "disk")
+
+	q, _ := ParseQuery("disk")
+	results := q.Search(cmds, now)
+
+	if len(results) != 1 || len(results[0].Highlights) != 1 {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+
+	if h := results[0].Highlights[0]; h.Field != fieldDescription || cmds[2].Description[h.Start:h.End] != "disk" {
+		t.Errorf("Unexpected highlight: %v", h)
+	}
+
+	for _, query := range []string{"", "(disk", "disk)", `"disk`, "/[/", "desc:", "color:red", "OR disk"} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Accepted invalid query %q", query)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+
+	if d := levenshtein("database", "databsae"); d != 2 {
+		t.Errorf("Expected distance 2 but got %v", d)
+	}
+
+	if d := levenshtein("", "abc"); d != 3 {
+		t.Errorf("Expected distance 3 but got %v", d)
+	}
+}
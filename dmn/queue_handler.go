@@ -1,15 +1,14 @@
 package dmn
 
 import (
-	"encoding/json"
-	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
-// HandleQueue lists the commands in the queue
+// HandleQueue lists the commands in the queue. The runs can be filtered, sorted and paged
+// with the query parameters in ListOptions.
 func (a *App) HandleQueue(w http.ResponseWriter, r *http.Request) {
 
 	a.DmnLogFile.Log.Println("Handling queue")
@@ -19,31 +18,80 @@ func (a *App) HandleQueue(w http.ResponseWriter, r *http.Request) {
 	var variables RequestVariable
 	err := variables.GetVariablesFromRequestVars(vars)
 
+	w.Header().Set("Content-Type", "application/json")
+
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Printf("Bad secret! Expected %v but got t%v\n", a.Secret.GetSecret(), variables.Secret)
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
 		return
 	}
 
-	scs := a.QueueCmd()
+	options, err := ParseListOptions(r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid list options", err)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	page, total, next, err := options.Apply(user.Visible(a.QueueCmd()), func(cmd Command) string {
+		return cmd.RunID
+	})
 
-	out, _ := json.Marshal(scs)
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to page runs", err)
+		return
+	}
 
-	io.WriteString(w, string(out))
+	writePage(w, r, page, total, next)
 }
 
-// QueueCmd returns a list of queued commands
+// QueueCmd returns a list of queued commands. Runs that are waiting for the scheduler
+// have their position in the queue, starting at 1 for the run that will start next.
+// Pending runs that will start later are included with the Scheduled status.
 func (a *App) QueueCmd() []Command {
 
-	cmds := a.CommandScheduler.QueuedCommands
+	a.CommandScheduler.queueMutex.Lock()
+
+	cmds := a.CommandScheduler.Runs.Snapshot()
+	positions := a.CommandScheduler.positions()
+
+	a.CommandScheduler.queueMutex.Unlock()
+
+	for index := range cmds {
+		cmds[index].Position = positions[cmds[index].RunID]
+	}
+
+	runs, err := a.PendingRuns.ReadPendingRuns()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read pending runs: %v\n", err)
+	}
+
+	for _, run := range runs {
+		selectedCmd, err := a.SelectCmd(run.CmdHash)
+
+		if err != nil || selectedCmd.CmdHash == "" {
+			continue
+		}
+
+		runAt := run.RunAt
+		selectedCmd.RunID = run.ID
+		selectedCmd.RunAt = &runAt
+		selectedCmd.Status = Scheduled
+
+		if run.Priority != nil {
+			selectedCmd.Priority = *run.Priority
+		}
+
+		cmds = append(cmds, selectedCmd)
+	}
 
 	a.DmnLogFile.Log.Println("Total queued: " + strconv.Itoa(len(cmds)))
 
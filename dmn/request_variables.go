@@ -6,48 +6,79 @@ import (
 
 // RequestVariable represents variables passed into the request
 type RequestVariable struct {
-	Secret           string
-	Description      string
-	CmdHash          string
-	Command          string
-	WorkingDirectory string
+	Secret            string
+	Description       string
+	CmdHash           string
+	Command           string
+	WorkingDirectory  string
+	ExecSettings      string
+	Sandbox           string
+	RetryPolicy       string
+	ConcurrencyPolicy string
+	ScheduleID        string
+	Expression        string
+	MissedRunPolicy   string
+	OverlapPolicy     string
+	Delay             string
+	RunAt             string
+	RunID             string
+	Pipeline          string
+	PipelineID        string
+	Priority          string
+	Update            string
+	Query             string
+	Output            string
+	Format            string
+	Shell             string
+	Name              string
+	TokenID           string
+	Role              string
 }
 
-// GetVariablesFromRequestVars gets variables from the request
+// GetVariablesFromRequestVars gets variables from the request. Every variable is base64
+// encoded; variables that are not part of the route are left empty.
 func (variables *RequestVariable) GetVariablesFromRequestVars(vars map[string]string) error {
 
-	secret, err := base64.StdEncoding.DecodeString(vars["secret"])
-
-	if err != nil {
-		return err
+	fields := map[string]*string{
+		"secret":            &variables.Secret,
+		"cmdHash":           &variables.CmdHash,
+		"description":       &variables.Description,
+		"command":           &variables.Command,
+		"workingDirectory":  &variables.WorkingDirectory,
+		"execSettings":      &variables.ExecSettings,
+		"sandbox":           &variables.Sandbox,
+		"retryPolicy":       &variables.RetryPolicy,
+		"concurrencyPolicy": &variables.ConcurrencyPolicy,
+		"scheduleID":        &variables.ScheduleID,
+		"expression":        &variables.Expression,
+		"missedRunPolicy":   &variables.MissedRunPolicy,
+		"overlapPolicy":     &variables.OverlapPolicy,
+		"delay":             &variables.Delay,
+		"runAt":             &variables.RunAt,
+		"runID":             &variables.RunID,
+		"pipeline":          &variables.Pipeline,
+		"pipelineID":        &variables.PipelineID,
+		"priority":          &variables.Priority,
+		"update":            &variables.Update,
+		"query":             &variables.Query,
+		"output":            &variables.Output,
+		"format":            &variables.Format,
+		"shell":             &variables.Shell,
+		"name":              &variables.Name,
+		"tokenID":           &variables.TokenID,
+		"role":              &variables.Role,
 	}
 
-	cmdHash, err := base64.StdEncoding.DecodeString(vars["cmdHash"])
-
-	if err != nil {
-		return err
-	}
+	for key, field := range fields {
 
-	description, err := base64.StdEncoding.DecodeString(vars["description"])
-	if err != nil {
-		return err
-	}
+		value, err := base64.StdEncoding.DecodeString(vars[key])
 
-	command, err := base64.StdEncoding.DecodeString(vars["command"])
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
 
-	workingDirectory, err := base64.StdEncoding.DecodeString(vars["workingDirectory"])
-	if err != nil {
-		return err
+		*field = string(value)
 	}
 
-	variables.Secret = string(secret)
-	variables.CmdHash = string(cmdHash)
-	variables.Description = string(description)
-	variables.Command = string(command)
-	variables.WorkingDirectory = string(workingDirectory)
-
 	return nil
 }
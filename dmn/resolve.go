@@ -0,0 +1,106 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MinPrefixLength is the shortest prefix of a hash or ID that selects a Command. A full
+// hash or ID is always accepted.
+const MinPrefixLength = 4
+
+var (
+	// ErrCommandNotFound is returned when no Command matches a hash or ID
+	ErrCommandNotFound = errors.New("command not found")
+
+	// ErrPrefixTooShort is returned when a prefix is shorter than MinPrefixLength
+	ErrPrefixTooShort = fmt.Errorf("prefix must be at least %v characters", MinPrefixLength)
+)
+
+// AmbiguousPrefixError is returned when a prefix matches more than one Command
+type AmbiguousPrefixError struct {
+	Prefix     string
+	Candidates []Command
+}
+
+func (e *AmbiguousPrefixError) Error() string {
+
+	hashes := make([]string, 0, len(e.Candidates))
+
+	for _, cmd := range e.Candidates {
+		hashes = append(hashes, cmd.CmdHash)
+	}
+
+	return fmt.Sprintf("prefix %q matches %v commands: %v", e.Prefix, len(e.Candidates), strings.Join(hashes, ", "))
+}
+
+// resolveCmd returns the index of the Command in cmds that value refers to. value is
+// either the full hash or ID of a Command, or a prefix of one that matches exactly one
+// Command.
+func resolveCmd(cmds []Command, value string) (int, error) {
+
+	for index, cmd := range cmds {
+		if cmd.CmdHash == value || (cmd.ID != "" && cmd.ID == value) {
+			return index, nil
+		}
+	}
+
+	if len(value) < MinPrefixLength {
+		return -1, ErrPrefixTooShort
+	}
+
+	var matches []int
+
+	for index, cmd := range cmds {
+		if cmd.matches(value) {
+			matches = append(matches, index)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return -1, ErrCommandNotFound
+	case 1:
+		return matches[0], nil
+	}
+
+	ambiguous := &AmbiguousPrefixError{Prefix: value}
+
+	for _, index := range matches {
+		ambiguous.Candidates = append(ambiguous.Candidates, cmds[index])
+	}
+
+	return -1, ambiguous
+}
+
+// ambiguousDetails are the details of the error returned when a prefix matches more than
+// one Command
+type ambiguousDetails struct {
+	Candidates []Command `json:"candidates"`
+}
+
+// writeResolveError writes the response for an error returned while resolving a Command:
+// status 404 if no Command matched, status 409 with the candidates if more than one did,
+// or status 422 if the prefix was too short. It returns false for any other error so
+// that the caller can handle it.
+func (a *App) writeResolveError(w http.ResponseWriter, err error) bool {
+
+	var ambiguous *AmbiguousPrefixError
+
+	switch {
+	case errors.Is(err, ErrCommandNotFound):
+		writeError(w, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrPrefixTooShort):
+		writeError(w, http.StatusUnprocessableEntity, err.Error(), nil)
+	case errors.As(err, &ambiguous):
+		writeError(w, http.StatusConflict, err.Error(), ambiguousDetails{Candidates: ambiguous.Candidates})
+	default:
+		return false
+	}
+
+	a.DmnLogFile.Log.Printf("Unable to resolve command: %v\n", err)
+
+	return true
+}
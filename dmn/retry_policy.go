@@ -0,0 +1,116 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxBackoffDoublings keeps exponential delays from overflowing when there is no MaxDelay
+const maxBackoffDoublings = 30
+
+// BackoffStrategy decides how the delay between attempts grows
+type BackoffStrategy string
+
+const (
+	// ConstantBackoff waits InitialDelay between every attempt
+	ConstantBackoff BackoffStrategy = "constant"
+
+	// LinearBackoff waits InitialDelay times the number of failed attempts
+	LinearBackoff BackoffStrategy = "linear"
+
+	// ExponentialBackoff doubles the delay after every failed attempt
+	ExponentialBackoff BackoffStrategy = "exponential"
+)
+
+// RetryPolicy controls whether a failed run of a Command is retried. The zero value
+// never retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts  int             `json:"maxAttempts"`
+	Backoff      BackoffStrategy `json:"backoff"`
+	InitialDelay time.Duration   `json:"initialDelay"`
+	MaxDelay     time.Duration   `json:"maxDelay"`
+
+	// Jitter randomizes each delay by up to this fraction of it, from 0 to 1
+	Jitter float64 `json:"jitter"`
+
+	// RetryOnExitCodes limits retries to these exit statuses. If it is empty any failure is retried.
+	RetryOnExitCodes []int `json:"retryOnExitCodes"`
+}
+
+// Validate checks that the policy is within range
+func (p RetryPolicy) Validate() error {
+
+	if p.MaxAttempts < 0 {
+		return errors.New("maxAttempts must not be negative")
+	}
+
+	switch p.Backoff {
+	case "", ConstantBackoff, LinearBackoff, ExponentialBackoff:
+	default:
+		return fmt.Errorf("invalid backoff strategy %q", p.Backoff)
+	}
+
+	if p.InitialDelay < 0 || p.MaxDelay < 0 {
+		return errors.New("delays must not be negative")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// shouldRetry returns true if the given attempt failed and another one is allowed
+func (p RetryPolicy) shouldRetry(sc ScheduledCommand, attempt int) bool {
+
+	if sc.Status != Failed || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if len(p.RetryOnExitCodes) == 0 {
+		return true
+	}
+
+	for _, code := range p.RetryOnExitCodes {
+		if code == sc.ExitStatus {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns how long to wait after the given failed attempt. random returns a
+// number in [0, 1) and is used for the jitter.
+func (p RetryPolicy) delay(attempt int, random func() float64) time.Duration {
+
+	delay := p.InitialDelay
+
+	switch p.Backoff {
+	case LinearBackoff:
+		delay = p.InitialDelay * time.Duration(attempt)
+	case ExponentialBackoff:
+		for i := 1; i < attempt && i <= maxBackoffDoublings && (p.MaxDelay == 0 || delay < p.MaxDelay); i++ {
+			delay *= 2
+		}
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		// Spread the delay evenly over [delay - jitter, delay + jitter]
+		jitter := float64(delay) * p.Jitter
+		delay += time.Duration(jitter * (2*random() - 1))
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
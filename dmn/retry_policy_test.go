@@ -0,0 +1,154 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+
+	policy := RetryPolicy{Backoff: ExponentialBackoff, InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	noJitter := func() float64 { return 0.5 }
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+
+	for index, delay := range expected {
+		if actual := policy.delay(index+1, noJitter); actual != delay {
+			t.Errorf("Delay after attempt %v was %v, expected %v", index+1, actual, delay)
+		}
+	}
+
+	policy = RetryPolicy{Backoff: LinearBackoff, InitialDelay: time.Second, Jitter: 0.5}
+
+	if actual := policy.delay(2, func() float64 { return 0 }); actual != time.Second {
+		t.Errorf("Jitter was not applied: %v", actual)
+	}
+}
+
+func TestRunWithRetries(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	app.CreateScheduler()
+
+	go app.RunScheduler()
+
+	var cmd Command
+	cmd.Set("exit 3", "flaky", ".")
+	cmd.RunID = newID()
+	cmd.Retry = RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, RetryOnExitCodes: []int{3}}
+
+	app.CommandScheduler.CommandQueue <- cmd
+
+	sc := <-app.CommandScheduler.CompletedQueue
+
+	if sc.Status != Failed || sc.ExitStatus != 3 {
+		t.Errorf("Unexpected final status: %v %v", sc.Status, sc.ExitStatus)
+	}
+
+	if len(sc.Attempts) != 3 || sc.RunID != cmd.RunID {
+		t.Fatalf("Expected 3 attempts of run %v but got %v", cmd.RunID, len(sc.Attempts))
+	}
+
+	for index, attempt := range sc.Attempts[1:] {
+		if attempt.Attempt != index+2 || attempt.ParentRunID != cmd.RunID || attempt.RunID == cmd.RunID {
+			t.Errorf("Attempt %v is not linked to the original run", attempt.Attempt)
+		}
+	}
+
+	// The retries are recorded in the run registry
+	for _, attempt := range sc.Attempts[1:] {
+		run, ok := app.CommandScheduler.Runs.Find(attempt.RunID)
+
+		if !ok || run.ParentRunID != cmd.RunID || run.Status != Failed {
+			t.Errorf("Attempt %v is not in the run registry: %v", attempt.Attempt, run)
+		}
+	}
+
+	// Exit codes that are not listed are not retried
+	cmd.CmdString = "exit 4"
+
+	app.CommandScheduler.CommandQueue <- cmd
+
+	sc = <-app.CommandScheduler.CompletedQueue
+
+	if sc.ExitStatus != 4 || len(sc.Attempts) != 0 {
+		t.Errorf("Exit status 4 should not have been retried: %v", len(sc.Attempts))
+	}
+}
+
+func TestRetryDoesNotHoldUpQueue(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	app.CreateScheduler()
+
+	go app.RunScheduler()
+
+	var flaky Command
+	flaky.Set("exit 3", "flaky", ".")
+	flaky.RunID = newID()
+	flaky.Status = Scheduled
+	flaky.Retry = RetryPolicy{MaxAttempts: 3, InitialDelay: time.Hour}
+
+	app.CommandScheduler.Runs.Add(flaky)
+	app.CommandScheduler.CommandQueue <- flaky
+
+	var other Command
+	other.Set("true", "other", ".")
+	other.RunID = newID()
+
+	app.CommandScheduler.CommandQueue <- other
+
+	select {
+	case sc := <-app.CommandScheduler.CompletedQueue:
+		if sc.RunID != other.RunID || sc.Status != Completed {
+			t.Fatalf("Expected the other command to complete but got %v %v", sc.RunID, sc.Status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("The queue was held up by a retry")
+	}
+
+	retrying := func() bool {
+		app.CommandScheduler.queueMutex.Lock()
+		defer app.CommandScheduler.queueMutex.Unlock()
+		_, ok := app.CommandScheduler.retrying[flaky.RunID]
+		return ok
+	}
+
+	// Wait for the first attempt to fail
+	for deadline := time.Now().Add(10 * time.Second); !retrying(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("The first attempt did not fail")
+		}
+	}
+
+	if run, _ := app.CommandScheduler.Runs.Find(flaky.RunID); run.Status != Scheduled {
+		t.Errorf("Expected the run to be scheduled while it waits to be retried but got %v", run.Status)
+	}
+
+	// Cancelling a run that waits to be retried ends it right away
+	app.CommandScheduler.queueMutex.Lock()
+	app.CommandScheduler.cancelRun(flaky.RunID)
+	app.CommandScheduler.queueMutex.Unlock()
+
+	select {
+	case sc := <-app.CommandScheduler.CompletedQueue:
+		if sc.RunID != flaky.RunID || sc.Status != Cancelled || sc.ExitStatus != 3 {
+			t.Errorf("Expected the retried run to be cancelled but got %v %v", sc.Status, sc.ExitStatus)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("The cancelled run waited for its retry")
+	}
+}
@@ -0,0 +1,266 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role decides what a user is allowed to do with the Commands they can see
+type Role string
+
+const (
+	// Viewer can list, search and show Commands
+	Viewer Role = "viewer"
+
+	// Operator can also run Commands
+	Operator Role = "operator"
+
+	// Editor can also add, update and delete Commands and their settings. Users without
+	// a role are editors.
+	Editor Role = "editor"
+)
+
+// Permission names an action on Commands
+type Permission string
+
+const (
+	// ViewCommands allows listing, searching and showing Commands, runs, schedules and pipelines
+	ViewCommands Permission = "view"
+
+	// RunCommands allows running, cancelling and reprioritizing Commands and pipelines
+	RunCommands Permission = "run"
+
+	// EditCommands allows adding, updating and deleting Commands, their settings,
+	// schedules and pipelines
+	EditCommands Permission = "edit"
+
+	// ManageUsers allows managing users and changing the whole library. Only admins have it.
+	ManageUsers Permission = "admin"
+)
+
+// rolePermissions lists the permissions of each role
+var rolePermissions = map[Role][]Permission{
+	Viewer:   {ViewCommands},
+	Operator: {ViewCommands, RunCommands},
+	Editor:   {ViewCommands, RunCommands, EditCommands},
+}
+
+// ParseRole checks that role is a valid role
+func ParseRole(role string) (Role, error) {
+
+	if _, ok := rolePermissions[Role(role)]; !ok {
+		return "", errors.New("invalid role: " + role)
+	}
+
+	return Role(role), nil
+}
+
+// PermissionError is returned when a user is not allowed to do something. CmdHash is set
+// if the user has the permission but the Command is outside of their scopes.
+type PermissionError struct {
+	User       string     `json:"user"`
+	Role       Role       `json:"role"`
+	Permission Permission `json:"permission"`
+	CmdHash    string     `json:"commandHash,omitempty"`
+}
+
+func (e *PermissionError) Error() string {
+
+	if e.CmdHash != "" {
+		return fmt.Sprintf("user %v may not %v command %v since it has none of the tags in their scopes", e.User, e.Permission, e.CmdHash)
+	}
+
+	if e.Permission == ManageUsers {
+		return fmt.Sprintf("user %v is not an admin", e.User)
+	}
+
+	return fmt.Sprintf("user %v with role %v may not %v commands", e.User, e.Role, e.Permission)
+}
+
+// EffectiveRole returns the role of the user, which is Editor if none is set
+func (u User) EffectiveRole() Role {
+
+	if u.Role == "" {
+		return Editor
+	}
+
+	return u.Role
+}
+
+// Can returns true if the user has a permission. Admins have every permission.
+func (u User) Can(permission Permission) bool {
+
+	if u.Admin {
+		return true
+	}
+
+	for _, p := range rolePermissions[u.EffectiveRole()] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InScope returns true if the user has no scopes or the Command has one of the tags in them
+func (u User) InScope(cmd Command) bool {
+
+	if u.Admin || len(u.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range u.Scopes {
+		for _, tag := range cmd.Tags {
+			if tag == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Check returns a PermissionError if the user does not have a permission, or if cmd is
+// not nil and the Command is outside of the user's scopes
+func (u User) Check(permission Permission, cmd *Command) *PermissionError {
+
+	if !u.Can(permission) {
+		return &PermissionError{User: u.Name, Role: u.EffectiveRole(), Permission: permission}
+	}
+
+	if cmd != nil && permission != ViewCommands && !u.InScope(*cmd) {
+		return &PermissionError{User: u.Name, Role: u.EffectiveRole(), Permission: permission, CmdHash: cmd.CmdHash}
+	}
+
+	return nil
+}
+
+// remoteAddr returns the address that a request came from
+func remoteAddr(r *http.Request) string {
+
+	if host := r.RemoteAddr; host != "" {
+		return host
+	}
+
+	return "unknown"
+}
+
+// unauthorized writes status 401 for a secret, token or client certificate that is not valid
+func (a *App) unauthorized(w http.ResponseWriter) {
+
+	a.DmnLogFile.Log.Println("Bad secret!")
+
+	writeError(w, http.StatusUnauthorized, "invalid secret or token", nil)
+}
+
+// deny writes status 403 with the reason in the body and records the attempt in the audit log
+func (a *App) deny(w http.ResponseWriter, r *http.Request, err *PermissionError) {
+
+	a.DmnLogFile.Log.Printf("Denied %v from %v: %v\n", routeTemplate(r), remoteAddr(r), err)
+
+	a.audit(r, User{Name: err.User}, AuditEntry{Action: AuditDenied, CmdHash: err.CmdHash, Detail: err.Error()})
+
+	writeError(w, http.StatusForbidden, err.Error(), err)
+}
+
+// authorize checks the secret or token in the request and that its user has a permission.
+// It writes status 401 for a bad secret or 403 if the permission is missing.
+func (a *App) authorize(w http.ResponseWriter, r *http.Request, variables RequestVariable, permission Permission) (User, bool) {
+
+	user, ok := a.authenticateRequest(r, variables.Secret)
+
+	if !ok {
+		a.unauthorized(w)
+		return user, false
+	}
+
+	if err := user.Check(permission, nil); err != nil {
+		a.deny(w, r, err)
+		return user, false
+	}
+
+	return user, true
+}
+
+// authorizeCmd checks that the Command is in the scopes of the user. It writes status 403
+// if it isn't.
+func (a *App) authorizeCmd(w http.ResponseWriter, r *http.Request, user User, permission Permission, cmd Command) bool {
+
+	if err := user.Check(permission, &cmd); err != nil {
+		a.deny(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// authorizeRun checks that the Command of a run in the queue is one that the user can see
+// and is in their scopes. A run of a Command that the user cannot see is reported like a
+// run that doesn't exist, with status 404. Runs that are not in the queue are left to the
+// caller.
+func (a *App) authorizeRun(w http.ResponseWriter, r *http.Request, user User, permission Permission, runID string) bool {
+
+	for _, cmd := range a.QueueCmd() {
+		if cmd.RunID != runID {
+			continue
+		}
+
+		if !user.CanSee(cmd) {
+			a.DmnLogFile.Log.Printf("Run %v not found\n", runID)
+			writeError(w, http.StatusNotFound, "run not found: "+runID, nil)
+			return false
+		}
+
+		return a.authorizeCmd(w, r, user, permission, cmd)
+	}
+
+	return true
+}
+
+// authorizeCmds checks that the user may act on every Command that a schedule or pipeline
+// uses. If one of them is in the library of another user, notFound is written with status
+// 404, as if the schedule or pipeline didn't exist. Commands that were deleted are left
+// out, so that schedules and pipelines that use them can still be cleaned up.
+func (a *App) authorizeCmds(w http.ResponseWriter, r *http.Request, user User, permission Permission, cmdHashes []string, notFound error) bool {
+
+	for _, cmdHash := range cmdHashes {
+		cmd, err := a.SelectUserCmd(user, cmdHash)
+
+		if errors.Is(err, ErrCommandNotFound) {
+			if _, err := a.SelectCmd(cmdHash); errors.Is(err, ErrCommandNotFound) {
+				continue
+			}
+
+			a.DmnLogFile.Log.Println(notFound)
+			writeError(w, http.StatusNotFound, notFound.Error(), nil)
+			return false
+		}
+
+		if err != nil {
+			a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+			return false
+		}
+
+		if !a.authorizeCmd(w, r, user, permission, cmd) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseScopes returns the tags in the scope query parameters. A parameter can hold
+// several tags separated by commas.
+func parseScopes(values []string) []string {
+
+	var tags []string
+
+	for _, value := range values {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+
+	return normalizeTags(tags)
+}
@@ -0,0 +1,67 @@
+package dmn
+
+import (
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+
+	tests := []struct {
+		user       User
+		permission Permission
+		expected   bool
+	}{
+		{User{Name: "v", Role: Viewer}, ViewCommands, true},
+		{User{Name: "v", Role: Viewer}, RunCommands, false},
+		{User{Name: "o", Role: Operator}, RunCommands, true},
+		{User{Name: "o", Role: Operator}, EditCommands, false},
+		{User{Name: "e", Role: Editor}, EditCommands, true},
+		{User{Name: "e"}, EditCommands, true},
+		{User{Name: "e", Role: Editor}, ManageUsers, false},
+		{User{Name: "a", Role: Viewer, Admin: true}, ManageUsers, true},
+	}
+
+	for _, test := range tests {
+		if actual := test.user.Can(test.permission); actual != test.expected {
+			t.Errorf("Expected %v of %v to be %v but got %v", test.permission, test.user.Role, test.expected, actual)
+		}
+	}
+
+	if _, err := ParseRole("owner"); err == nil {
+		t.Errorf("Expected an invalid role to be rejected")
+	}
+}
+
+func TestRoleScopes(t *testing.T) {
+
+	user := User{Name: "alice", Role: Operator, Scopes: parseScopes([]string{"DB, ops", "db"})}
+
+	if len(user.Scopes) != 2 {
+		t.Fatalf("Expected 2 scopes but got %v", user.Scopes)
+	}
+
+	var db, web Command
+	db.Set("pg_dump", "back up the database", ".")
+	db.Tags = []string{"db"}
+	web.Set("nginx -s reload", "reload nginx", ".")
+	web.Tags = []string{"web"}
+
+	if err := user.Check(RunCommands, &db); err != nil {
+		t.Errorf("Expected alice to run a db command: %v", err)
+	}
+
+	err := user.Check(RunCommands, &web)
+
+	if err == nil || err.CmdHash != web.CmdHash {
+		t.Errorf("Expected alice not to run a web command but got %v", err)
+	}
+
+	// Scopes don't limit what can be seen
+	if err := user.Check(ViewCommands, &web); err != nil {
+		t.Errorf("Expected alice to view a web command: %v", err)
+	}
+
+	if err := user.Check(EditCommands, &db); err == nil || err.CmdHash != "" {
+		t.Errorf("Expected alice not to edit commands but got %v", err)
+	}
+}
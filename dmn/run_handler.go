@@ -2,9 +2,7 @@ package dmn
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"time"
@@ -26,33 +24,36 @@ func (a *App) HandleRun(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, RunCommands)
+
+	if !ok {
 		return
 	}
 
-	abortcmd := func(reason string) {
+	abortcmd := func(status int, reason string) {
 		a.DmnLogFile.Log.Println(reason)
-
-		w.WriteHeader(http.StatusBadRequest)
-		var sc ScheduledCommand
-		sc.Status = Failed
-		sc.Coutput = reason
-		out, _ := json.Marshal(sc)
-		io.WriteString(w, string(out))
+		writeError(w, status, reason, nil)
 	}
 
-	// Select the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 400
-	selectedCmd, cerr := a.SelectCmd(variables.CmdHash)
+	// Select the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 404
+	selectedCmd, cerr := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, cerr) {
+		return
+	}
 
 	if cerr != nil {
-		abortcmd("Unable to select hash: " + variables.CmdHash)
+		abortcmd(http.StatusInternalServerError, "Unable to select hash: "+variables.CmdHash)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, RunCommands, selectedCmd) {
 		return
 	}
 
@@ -63,120 +64,148 @@ func (a *App) HandleRun(w http.ResponseWriter, r *http.Request) {
 
 	_, err = os.Stat(selectedCmd.WorkingDirectory)
 	if os.IsNotExist(err) {
-		abortcmd("Invalid working directory: " + selectedCmd.WorkingDirectory)
+		abortcmd(http.StatusUnprocessableEntity, "Invalid working directory: "+selectedCmd.WorkingDirectory)
 		return
 	}
 
-	a.DmnLogFile.Log.Printf("Scheduling command %v: %v\n", selectedCmd.CmdHash, selectedCmd.Status)
-	selectedCmd.Status = Scheduled
-	a.CommandScheduler.QueuedCommands = append(a.CommandScheduler.QueuedCommands, selectedCmd)
-	a.CommandScheduler.CommandQueue <- selectedCmd
+	// The priority of this run overrides the priority of the Command
+	if variables.Priority != "" {
+		priority, err := ParsePriority(variables.Priority)
 
-	a.DmnLogFile.Log.Printf("Completed command %v: %v\n", selectedCmd.CmdHash, selectedCmd.Status)
+		if err != nil {
+			abortcmd(http.StatusUnprocessableEntity, err.Error())
+			return
+		}
 
-	completedCommand := <-a.CommandScheduler.CompletedQueue
+		selectedCmd.Priority = priority
+	}
 
-	a.DmnLogFile.Log.Printf("Command received from CompletedQueue: %v: %v\n", completedCommand.CmdHash, selectedCmd.Status)
+	selectedCmd.RunBy = user.Name
 
-	a.UpdateCommandDuration(selectedCmd, completedCommand.Duration)
+	completedCommand, err := a.RunCmd(selectedCmd)
 
-	for index, cmd := range a.CommandScheduler.QueuedCommands {
-		if cmd.CmdHash == selectedCmd.CmdHash {
-			a.DmnLogFile.Log.Printf("Updating status for %v: %v\n", cmd.CmdHash, Completed)
-			a.CommandScheduler.QueuedCommands[index].Status = Completed
-			break
-		}
+	if err == ErrAlreadyQueued {
+		abortcmd(http.StatusConflict, "Command is already queued or running: "+selectedCmd.CmdHash)
+		return
 	}
 
-	a.DmnLogFile.Log.Printf("Vacuuming command %v\n", selectedCmd.CmdHash)
-	a.CommandScheduler.VacuumQueue <- selectedCmd
+	a.audit(r, user, AuditEntry{Action: AuditRun, CmdHash: selectedCmd.CmdHash, RunID: completedCommand.RunID, Detail: string(completedCommand.Status)})
 
 	out, _ := json.Marshal(completedCommand)
 	io.WriteString(w, string(out))
 }
 
-// UpdateCommandDuration updates a Command with the same hash in the history file
-func (a *App) UpdateCommandDuration(cmd Command, duration time.Duration) bool {
+// RunCmd adds a Command to the waiting runs and waits until the scheduler has run it.
+// The duration of the Command is updated in the history file. A run ID is assigned
+// to the Command unless it already has one. If the Command is already queued or running
+// its ConcurrencyPolicy decides whether the run is rejected with ErrAlreadyQueued,
+// coalesced into a run that has not started yet, or replaces the existing runs. A run
+// that is coalesced into another raises its priority if necessary.
+func (a *App) RunCmd(selectedCmd Command) (ScheduledCommand, error) {
 
-	a.DmnLogFile.Log.Printf("Updating %v: ran in %v\n", cmd.CmdHash, duration)
-
-	// Check if the file does not exist. If not, then create it and add our first dmn.Command to it.
-	f, err := os.Open(a.History.Path)
-
-	// Immediately close the file since we plan to write to it
-	f.Close()
+	if selectedCmd.RunID == "" {
+		selectedCmd.RunID = newID()
+	}
 
-	// Check if the file doesn't exist and if so, then write it.
-	if err != nil {
+	a.DmnLogFile.Log.Printf("Scheduling command %v: %v\n", selectedCmd.CmdHash, selectedCmd.Status)
+	selectedCmd.Status = Scheduled
 
-		// The array of dmn.Commands
-		var cmds []Command
+	scheduler := &a.CommandScheduler
+
+	scheduler.queueMutex.Lock()
+
+	active := scheduler.activeRuns(selectedCmd.CmdHash)
+
+	if len(active) > 0 {
+		switch selectedCmd.Concurrency {
+		case ForbidConcurrent:
+			scheduler.queueMutex.Unlock()
+			a.DmnLogFile.Log.Printf("Rejecting run of %v since it is already queued\n", selectedCmd.CmdHash)
+			return ScheduledCommand{}, ErrAlreadyQueued
+
+		case CoalesceConcurrent:
+			for _, cmd := range active {
+				if cmd.Status == Scheduled {
+					done := make(chan ScheduledCommand, 1)
+					scheduler.waiters[cmd.RunID] = append(scheduler.waiters[cmd.RunID], done)
+					if selectedCmd.Priority > cmd.Priority {
+						scheduler.reprioritize(cmd.RunID, selectedCmd.Priority)
+					}
+					scheduler.queueMutex.Unlock()
+					a.DmnLogFile.Log.Printf("Coalescing run of %v into %v\n", selectedCmd.CmdHash, cmd.RunID)
+					return <-done, nil
+				}
+			}
+
+		case ReplaceConcurrent:
+			for _, cmd := range active {
+				a.DmnLogFile.Log.Printf("Replacing run %v of %v\n", cmd.RunID, cmd.CmdHash)
+				scheduler.cancelRun(cmd.RunID)
+			}
+		}
+	}
 
-		// Set the duration
-		cmd.Duration = duration
+	scheduler.Runs.Add(selectedCmd)
 
-		cmds = append(cmds, cmd)
+	done := make(chan ScheduledCommand, 1)
+	scheduler.push(selectedCmd, done)
 
-		mode := int(0644)
+	scheduler.queueMutex.Unlock()
 
-		updatedData, _ := json.MarshalIndent(cmds, "", "\t")
+	completedCommand := <-done
 
-		error := ioutil.WriteFile(a.History.Path, updatedData, os.FileMode(mode))
+	a.DmnLogFile.Log.Printf("Completed command %v: %v\n", completedCommand.CmdHash, completedCommand.Status)
 
-		return error == nil
+	if completedCommand.Status != Cancelled {
+		a.UpdateCommandDuration(selectedCmd, completedCommand.Duration)
 	}
 
-	// Update the dmn.Command in the history file
+	// Hand the result to the runs that were coalesced into this one
+	scheduler.queueMutex.Lock()
+	waiters := scheduler.waiters[selectedCmd.RunID]
+	delete(scheduler.waiters, selectedCmd.RunID)
+	scheduler.queueMutex.Unlock()
 
-	// The array of dmn.Commands
-	var cmds []Command
-
-	// Read history file
-	data, err := ioutil.ReadFile(a.History.Path)
-
-	// An error occured while reading historyFile.
-	if err != nil {
-		a.DmnLogFile.Log.Printf("An error occured while reading historyFile: %v\n", err)
-		return false
+	for _, done := range waiters {
+		done <- completedCommand
 	}
 
-	if err := json.Unmarshal(data, &cmds); err != nil {
-		a.DmnLogFile.Log.Printf("JSON unmarshalling failed: %s\n", err)
-		return false
-	}
+	a.updateStatusForQueuedCommand(selectedCmd, completedCommand.Status)
 
-	//fmt.Println("Updating duration")
+	return completedCommand, nil
+}
 
-	var found bool
-	var foundIndex int
+// UpdateCommandDuration updates the duration of a Command with the same hash in the history
+// file, and records when it was run and how many times
+func (a *App) UpdateCommandDuration(cmd Command, duration time.Duration) bool {
 
-	// Update the duration for the dmn.Command
-	for index, c := range cmds {
-		if c.CmdHash == cmd.CmdHash {
-			foundIndex = index
-			found = true
-			//c.Duration = cmd.Duration
-			//fmt.Fprintf(os.Stderr, "dmn.Command hash already exists: %s\n", cmd.CmdString)
-			break
-			//return false
+	a.DmnLogFile.Log.Printf("Updating %v: ran in %v\n", cmd.CmdHash, duration)
+
+	err := a.History.Modify(func(cmds []Command) ([]Command, error) {
+
+		// Update the duration for the dmn.Command
+		for index := range cmds {
+			if cmds[index].CmdHash == cmd.CmdHash {
+				now := time.Now()
+				cmds[index].Duration = duration
+				cmds[index].LastRunAt = &now
+				cmds[index].RunCount++
+				return cmds, nil
+			}
 		}
-	}
 
-	if found == true {
-		cmds[foundIndex].Duration = duration
-		//fmt.Println(cmds[foundIndex])
-	}
+		// The Command is added if the history file doesn't have it
+		if len(cmds) == 0 {
+			cmd.Duration = duration
+			cmds = append(cmds, cmd)
+		}
 
-	// Convert the struct to JSON
-	updatedData, updatedDataErr := json.MarshalIndent(cmds, "", "\t")
+		return cmds, nil
+	})
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", updatedDataErr)
+		a.DmnLogFile.Log.Printf("An error occured while updating historyFile: %v\n", err)
 	}
 
-	mode := int(0644)
-
-	error := ioutil.WriteFile(a.History.Path, updatedData, os.FileMode(mode))
-
-	return error == nil
+	return err == nil
 }
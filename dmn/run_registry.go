@@ -0,0 +1,161 @@
+package dmn
+
+import (
+	"sync"
+	"time"
+)
+
+// RunRegistry keeps track of the runs in the queue. It is safe for concurrent use and
+// every read returns a copy, so callers never see a run change underneath them. Finished
+// runs stay in the registry for the retention window so that clients can see how they
+// ended.
+type RunRegistry struct {
+	mutex     sync.Mutex
+	runs      []registeredRun
+	retention time.Duration
+}
+
+type registeredRun struct {
+	cmd        Command
+	finishedAt time.Time
+}
+
+// finished returns true if the run is no longer scheduled or running
+func finished(status CommandStatus) bool {
+	return status != Scheduled && status != Running
+}
+
+// SetRetention sets how long finished runs stay in the registry
+func (r *RunRegistry) SetRetention(retention time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retention = retention
+}
+
+// Add adds a run to the registry
+func (r *RunRegistry) Add(cmd Command) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.runs = append(r.runs, registeredRun{cmd: cmd})
+}
+
+// Snapshot returns a copy of the runs in the order they were added
+func (r *RunRegistry) Snapshot() []Command {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cmds := make([]Command, 0, len(r.runs))
+
+	for _, run := range r.runs {
+		cmds = append(cmds, run.cmd)
+	}
+
+	return cmds
+}
+
+// Len returns the number of runs in the registry
+func (r *RunRegistry) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.runs)
+}
+
+// Find returns the run with the given run ID
+func (r *RunRegistry) Find(runID string) (Command, bool) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, run := range r.runs {
+		if run.cmd.RunID == runID {
+			return run.cmd, true
+		}
+	}
+
+	return Command{}, false
+}
+
+// Active returns the runs of the Command with the given hash that are scheduled or running
+func (r *RunRegistry) Active(cmdHash string) []Command {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var active []Command
+
+	for _, run := range r.runs {
+		if run.cmd.CmdHash == cmdHash && !finished(run.cmd.Status) {
+			active = append(active, run.cmd)
+		}
+	}
+
+	return active
+}
+
+// SetStatus sets the status of the run with the same run ID and hash as cmd. It returns
+// false if the run is not in the registry.
+func (r *RunRegistry) SetStatus(cmd Command, status CommandStatus) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for index := range r.runs {
+		run := &r.runs[index]
+
+		if run.cmd.RunID == cmd.RunID && run.cmd.CmdHash == cmd.CmdHash {
+			run.cmd.Status = status
+
+			if finished(status) {
+				run.finishedAt = time.Now()
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetPriority sets the priority of the run with the given run ID
+func (r *RunRegistry) SetPriority(runID string, priority int) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for index := range r.runs {
+		if r.runs[index].cmd.RunID == runID {
+			r.runs[index].cmd.Priority = priority
+			return true
+		}
+	}
+
+	return false
+}
+
+// Prune removes the runs that finished longer than the retention window before now and
+// returns how many were removed
+func (r *RunRegistry) Prune(now time.Time) int {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	kept := r.runs[:0]
+
+	for _, run := range r.runs {
+		if finished(run.cmd.Status) && now.Sub(run.finishedAt) >= r.retention {
+			continue
+		}
+		kept = append(kept, run)
+	}
+
+	removed := len(r.runs) - len(kept)
+
+	// Clear the tail so the removed runs can be garbage collected
+	for index := len(kept); index < len(r.runs); index++ {
+		r.runs[index] = registeredRun{}
+	}
+
+	r.runs = kept
+
+	return removed
+}
@@ -0,0 +1,91 @@
+package dmn
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunRegistryRetention(t *testing.T) {
+
+	var registry RunRegistry
+	registry.SetRetention(time.Minute)
+
+	registry.Add(Command{CmdHash: "a", RunID: "1", Status: Scheduled})
+	registry.Add(Command{CmdHash: "b", RunID: "2", Status: Scheduled})
+
+	registry.SetStatus(Command{CmdHash: "a", RunID: "1"}, Completed)
+
+	if removed := registry.Prune(time.Now()); removed != 0 {
+		t.Errorf("Removed %v runs within the retention window", removed)
+	}
+
+	if removed := registry.Prune(time.Now().Add(2 * time.Minute)); removed != 1 {
+		t.Errorf("Expected 1 finished run to be removed but got %v", removed)
+	}
+
+	if _, ok := registry.Find("2"); !ok {
+		t.Errorf("Removed a run that has not finished")
+	}
+}
+
+func TestRunRegistryConcurrentAccess(t *testing.T) {
+
+	var registry RunRegistry
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				cmd := Command{CmdHash: "hash", RunID: strconv.Itoa(i*100 + j), Status: Scheduled}
+				registry.Add(cmd)
+				registry.SetStatus(cmd, Running)
+				registry.SetPriority(cmd.RunID, j)
+				registry.Active(cmd.CmdHash)
+				registry.SetStatus(cmd, Completed)
+				registry.Snapshot()
+				registry.Prune(time.Now())
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if registry.Len() != 0 {
+		t.Errorf("Expected every run to be removed but %v are left", registry.Len())
+	}
+}
+
+func TestConcurrentRunsAndQueue(t *testing.T) {
+
+	app := startTestScheduler(t)
+
+	var cmd Command
+	cmd.Set("echo race", "race", ".")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			app.RunCmd(cmd)
+		}()
+		go func() {
+			defer wg.Done()
+			app.QueueCmd()
+		}()
+	}
+
+	wg.Wait()
+
+	for _, queued := range app.QueueCmd() {
+		if queued.Status != Completed {
+			t.Errorf("Expected run %v to be completed but it is %v", queued.RunID, queued.Status)
+		}
+	}
+}
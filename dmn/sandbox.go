@@ -0,0 +1,75 @@
+package dmn
+
+import (
+	"errors"
+	"strings"
+)
+
+// SandboxSettings represents the opt-in sandbox a Command can run in. When enabled the
+// Command runs in its own user, mount and PID namespaces and only its working directory
+// is writable.
+type SandboxSettings struct {
+	Enabled        bool `json:"enabled"`
+	IsolateNetwork bool `json:"isolateNetwork"`
+
+	// Required fails the run if the sandbox cannot be set up. Otherwise the Command
+	// runs without the sandbox and ScheduledCommand.Sandboxed is false.
+	Required bool `json:"required"`
+}
+
+// Validate checks that the sandbox can be combined with the execution settings
+func (s SandboxSettings) Validate(settings ExecSettings) error {
+
+	if s.Enabled && settings.changesCredential() {
+		return errors.New("uid and gid cannot be changed when the sandbox is enabled")
+	}
+
+	return nil
+}
+
+// quoteShell quotes value so that it can be used as a single shell word
+func quoteShell(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+const (
+	// sandboxFailure starts the output of a sandboxed run whose mounts could not be set up
+	sandboxFailure = "recmd: unable to set up sandbox: "
+
+	// sandboxStatusFD is the file descriptor that the prelude reports a failure to set up
+	// the sandbox on. It is closed before the Command runs, so the Command cannot write
+	// to it.
+	sandboxStatusFD = "3"
+)
+
+// scriptPrelude returns the shell statements that set up the mounts inside the sandbox.
+// They run as root of the new user namespace before the Command. A fresh /proc is mounted
+// for the new PID namespace, the working directory is bind mounted onto itself and then
+// every other mount is remounted read-only, keeping the options that the user namespace
+// is not allowed to change. If any step fails the reason is written to sandboxStatusFD
+// and the script exits with status 126.
+func (s SandboxSettings) scriptPrelude(workingDirectory string) string {
+
+	wd := quoteShell(workingDirectory)
+
+	fail := func(reason string) string {
+		return " || { echo \"" + reason + "\" >&" + sandboxStatusFD + "; exit 126; }\n"
+	}
+
+	var prelude strings.Builder
+
+	prelude.WriteString("mount --make-rprivate /" + fail("private mounts"))
+	prelude.WriteString("mount -t proc proc /proc" + fail("/proc"))
+	prelude.WriteString("mount --bind " + wd + " " + wd + fail("working directory"))
+	prelude.WriteString("while read -r m o; do\n")
+	prelude.WriteString("\tm=$(printf '%b' \"$m\")\n")
+	prelude.WriteString("\t[ \"$m\" = " + wd + " ] && continue\n")
+	prelude.WriteString("\tmount -o \"remount,bind,$o\" \"$m\"" + fail("$m is not read-only"))
+	prelude.WriteString("done <<EOF\n")
+	prelude.WriteString("$(awk '{ o = $6; sub(/^rw/, \"ro\", o); print $5, o }' /proc/self/mountinfo)\n")
+	prelude.WriteString("EOF\n")
+	prelude.WriteString("cd " + wd + fail("working directory"))
+	prelude.WriteString("exec " + sandboxStatusFD + ">&-\n\n")
+
+	return prelude.String()
+}
@@ -0,0 +1,99 @@
+package dmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleSandbox sets the sandbox settings of a Command. The settings are passed in as
+// base64 encoded JSON.
+func (a *App) HandleSandbox(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	var settings SandboxSettings
+
+	if err := json.Unmarshal([]byte(variables.Sandbox), &settings); err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to parse sandbox settings", err)
+		return
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	updatedCmd, err := a.UpdateCommandSandbox(selectedCmd.CmdHash, settings)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to update sandbox settings", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, CmdHash: updatedCmd.CmdHash, Detail: "sandbox", Before: &selectedCmd, After: &updatedCmd})
+
+	out, err := json.Marshal(updatedCmd)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// UpdateCommandSandbox validates the sandbox settings and stores them with the Command
+func (a *App) UpdateCommandSandbox(value string, settings SandboxSettings) (Command, error) {
+
+	selectedCmd, err := a.SelectCmd(value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	if err := settings.Validate(selectedCmd.ExecSettings); err != nil {
+		return Command{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Updating sandbox settings for %v\n", selectedCmd.CmdHash)
+
+	return a.History.UpdateCmd(selectedCmd.CmdHash, func(cmd *Command) {
+		cmd.Sandbox = settings
+	})
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package dmn
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+var (
+	sandboxProbeOnce sync.Once
+	sandboxProbeErr  error
+)
+
+// cloneFlags returns the namespaces the sandboxed Command is created in
+func (s SandboxSettings) cloneFlags() uintptr {
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID)
+
+	if s.IsolateNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	return flags
+}
+
+// apply creates the process in new namespaces. The daemon's user and group are mapped
+// to root inside the user namespace so that the prelude is allowed to mount.
+func (s SandboxSettings) apply(cmd *exec.Cmd) {
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Cloneflags |= s.cloneFlags()
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+}
+
+// sandboxAvailable checks once whether this host allows unprivileged namespaces by
+// starting a trivial process in them.
+func sandboxAvailable() error {
+
+	sandboxProbeOnce.Do(func() {
+		probe := exec.Command("true")
+		SandboxSettings{Enabled: true, IsolateNetwork: true}.apply(probe)
+		sandboxProbeErr = probe.Run()
+	})
+
+	return sandboxProbeErr
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package dmn
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// apply does nothing since namespaces are only supported on Linux
+func (s SandboxSettings) apply(cmd *exec.Cmd) {
+}
+
+// sandboxAvailable always returns an error since namespaces are only supported on Linux
+func sandboxAvailable() error {
+	return errors.New("the sandbox is only supported on Linux")
+}
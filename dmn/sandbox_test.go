@@ -0,0 +1,101 @@
+package dmn
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+
+	if err := sandboxAvailable(); err != nil {
+		t.Skipf("Sandbox is not available: %v", err)
+	}
+
+	os.MkdirAll(testdataDir, 0755)
+
+	outside := filepath.Join(os.TempDir(), "recmd-sandbox-test")
+	os.Remove(outside)
+
+	var sc ScheduledCommand
+	sc.Set("touch inside; touch "+outside+"; echo $$; cat /proc/net/dev", "sandboxed", testdataDir)
+	sc.Sandbox.Enabled = true
+	sc.Sandbox.IsolateNetwork = true
+	sc.Sandbox.Required = true
+
+	sc.RunShellScriptCommandWithExitStatus()
+
+	if !sc.Sandboxed {
+		t.Fatalf("Command did not run in the sandbox: %v", sc.Coutput)
+	}
+
+	if _, err := os.Stat(filepath.Join(testdataDir, "inside")); err != nil {
+		t.Errorf("Unable to write to the working directory: %v", sc.Coutput)
+	}
+
+	if _, err := os.Stat(outside); err == nil {
+		os.Remove(outside)
+		t.Errorf("Able to write outside of the working directory")
+	}
+
+	lines := strings.Fields(sc.Coutput)
+
+	found := false
+	for _, line := range lines {
+		if line == "1" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("Command was not run in a new PID namespace: %v", sc.Coutput)
+	}
+
+	if strings.Contains(sc.Coutput, "eth") {
+		t.Errorf("Network was not isolated: %v", sc.Coutput)
+	}
+}
+
+func TestSandboxFailureCannotBeForged(t *testing.T) {
+
+	if err := sandboxAvailable(); err != nil {
+		t.Skipf("Sandbox is not available: %v", err)
+	}
+
+	os.MkdirAll(testdataDir, 0755)
+
+	// A Command that prints the failure message and exits like the prelude still ran in
+	// the sandbox, and cannot write to the status file descriptor
+	var sc ScheduledCommand
+	sc.Set("echo '"+sandboxFailure+"/ is not read-only' >&2; echo forged >&"+sandboxStatusFD+"; exit 126", "forged", testdataDir)
+	sc.Sandbox.Enabled = true
+	sc.Sandbox.Required = true
+
+	if sc.RunShellScriptCommandWithExitStatus() != 126 {
+		t.Fatalf("Expected exit status 126 but got %v: %v", sc.ExitStatus, sc.Coutput)
+	}
+
+	if !sc.Sandboxed || sc.Status != Failed {
+		t.Errorf("Expected a failed run in the sandbox but got %v, sandboxed %v: %v", sc.Status, sc.Sandboxed, sc.Coutput)
+	}
+
+	// Only the prelude reports on the status file descriptor
+	prelude := sc.Sandbox.scriptPrelude(testdataDir)
+
+	if !strings.Contains(prelude, ">&"+sandboxStatusFD) || !strings.Contains(prelude, "exec "+sandboxStatusFD+">&-") {
+		t.Errorf("Expected the prelude to report on and then close the status file descriptor: %v", prelude)
+	}
+}
+
+func TestSandboxWithCredential(t *testing.T) {
+
+	uid := uint32(1000)
+
+	var sandbox SandboxSettings
+	sandbox.Enabled = true
+
+	if sandbox.Validate(ExecSettings{UID: &uid}) == nil {
+		t.Errorf("Accepted uid together with the sandbox")
+	}
+}
@@ -0,0 +1,373 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// The schedules file
+	recmdSchedulesFile = "recmd_schedules.json"
+
+	// maxCatchUpRuns limits how many missed runs are triggered by CatchUpMissedRuns
+	maxCatchUpRuns = 100
+)
+
+// ErrScheduleNotFound is returned when there is no schedule with an ID
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// CronTick is how often the cron scheduler checks for schedules that are due
+var CronTick = time.Second
+
+// MissedRunPolicy decides what happens to runs that were missed while the daemon was down
+type MissedRunPolicy string
+
+const (
+	// SkipMissedRuns ignores missed runs
+	SkipMissedRuns MissedRunPolicy = "skip"
+
+	// RunOnceForMissedRuns runs the Command once if any runs were missed
+	RunOnceForMissedRuns MissedRunPolicy = "once"
+
+	// CatchUpMissedRuns runs the Command once for every missed run
+	CatchUpMissedRuns MissedRunPolicy = "catchup"
+)
+
+// OverlapPolicy decides what happens when a schedule fires while its previous run is still going
+type OverlapPolicy string
+
+const (
+	// AllowOverlap queues another run of the Command behind the previous one
+	AllowOverlap OverlapPolicy = "allow"
+
+	// SkipOverlap skips the run
+	SkipOverlap OverlapPolicy = "skip"
+)
+
+// Schedule represents a recurring run of a Command
+type Schedule struct {
+	ID              string          `json:"id"`
+	CmdHash         string          `json:"commandHash"`
+	Expression      string          `json:"expression"`
+	MissedRunPolicy MissedRunPolicy `json:"missedRunPolicy"`
+	OverlapPolicy   OverlapPolicy   `json:"overlapPolicy"`
+	Paused          bool            `json:"paused"`
+	LastRun         time.Time       `json:"lastRun"`
+	NextRun         time.Time       `json:"nextRun"`
+}
+
+// Validate checks the expression and policies of the schedule
+func (s Schedule) Validate() error {
+
+	if _, err := ParseCronExpression(s.Expression); err != nil {
+		return fmt.Errorf("invalid expression %q: %v", s.Expression, err)
+	}
+
+	switch s.MissedRunPolicy {
+	case SkipMissedRuns, RunOnceForMissedRuns, CatchUpMissedRuns:
+	default:
+		return fmt.Errorf("invalid missed run policy %q", s.MissedRunPolicy)
+	}
+
+	switch s.OverlapPolicy {
+	case AllowOverlap, SkipOverlap:
+	default:
+		return fmt.Errorf("invalid overlap policy %q", s.OverlapPolicy)
+	}
+
+	return nil
+}
+
+// missedRuns counts the fire times of the expression from next up to and including now
+func missedRuns(expr CronExpression, next time.Time, now time.Time) int {
+
+	count := 0
+
+	for t := next; !t.IsZero() && !t.After(now) && count < maxCatchUpRuns; t = expr.Next(t) {
+		count++
+	}
+
+	return count
+}
+
+// ScheduleFile represents the file containing the schedules
+type ScheduleFile struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Set sets the path to the schedules file
+func (f *ScheduleFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdSchedulesFile)
+}
+
+// WriteSchedulesToFile creates an empty schedules file if it doesn't exist
+func (f *ScheduleFile) WriteSchedulesToFile() error {
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		return ioutil.WriteFile(f.Path, []byte(nil), os.FileMode(0644))
+	}
+
+	return nil
+}
+
+// ReadSchedules reads the schedules file
+func (f *ScheduleFile) ReadSchedules() ([]Schedule, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.read()
+}
+
+func (f *ScheduleFile) read() ([]Schedule, error) {
+
+	var schedules []Schedule
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return schedules, err
+	}
+
+	if len(data) == 0 {
+		return schedules, nil
+	}
+
+	err = json.Unmarshal(data, &schedules)
+
+	return schedules, err
+}
+
+func (f *ScheduleFile) write(schedules []Schedule) error {
+
+	data, err := json.MarshalIndent(schedules, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.Path, data, os.FileMode(0644))
+}
+
+// AddSchedule appends a schedule to the file
+func (f *ScheduleFile) AddSchedule(s Schedule) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	schedules, err := f.read()
+
+	if err != nil {
+		return err
+	}
+
+	return f.write(append(schedules, s))
+}
+
+// GetSchedule returns the schedule with the given ID
+func (f *ScheduleFile) GetSchedule(id string) (Schedule, error) {
+
+	schedules, err := f.ReadSchedules()
+
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	for _, s := range schedules {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+
+	return Schedule{}, fmt.Errorf("%w: %v", ErrScheduleNotFound, id)
+}
+
+// UpdateSchedule applies update to the schedule with the given ID and returns the result
+func (f *ScheduleFile) UpdateSchedule(id string, update func(*Schedule)) (Schedule, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	schedules, err := f.read()
+
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	for index := range schedules {
+		if schedules[index].ID == id {
+			update(&schedules[index])
+			return schedules[index], f.write(schedules)
+		}
+	}
+
+	return Schedule{}, fmt.Errorf("%w: %v", ErrScheduleNotFound, id)
+}
+
+// DeleteSchedule removes the schedule with the given ID and returns it
+func (f *ScheduleFile) DeleteSchedule(id string) (Schedule, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	schedules, err := f.read()
+
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	for index, s := range schedules {
+		if s.ID == id {
+			schedules = append(schedules[:index], schedules[index+1:]...)
+			return s, f.write(schedules)
+		}
+	}
+
+	return Schedule{}, fmt.Errorf("%w: %v", ErrScheduleNotFound, id)
+}
+
+// RunCronScheduler triggers schedules when they are due. Runs that were missed while the
+// daemon was down are handled first according to the MissedRunPolicy of each schedule.
+func (a *App) RunCronScheduler() {
+
+	a.CatchUpSchedules(time.Now())
+
+	ticker := time.NewTicker(CronTick)
+
+	for now := range ticker.C {
+		a.TriggerDueSchedules(now)
+	}
+}
+
+// CatchUpSchedules triggers the runs that were missed before now
+func (a *App) CatchUpSchedules(now time.Time) {
+
+	schedules, err := a.Schedules.ReadSchedules()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read schedules: %v\n", err)
+		return
+	}
+
+	for _, s := range schedules {
+
+		if s.Paused || s.NextRun.IsZero() || s.NextRun.After(now) {
+			continue
+		}
+
+		expr, err := ParseCronExpression(s.Expression)
+
+		if err != nil {
+			a.DmnLogFile.Log.Printf("Invalid expression for schedule %v: %v\n", s.ID, err)
+			continue
+		}
+
+		missed := missedRuns(expr, s.NextRun, now)
+
+		runs := 0
+
+		switch s.MissedRunPolicy {
+		case RunOnceForMissedRuns:
+			runs = 1
+		case CatchUpMissedRuns:
+			runs = missed
+		}
+
+		a.DmnLogFile.Log.Printf("Schedule %v missed %v runs, running %v\n", s.ID, missed, runs)
+
+		updated, err := a.Schedules.UpdateSchedule(s.ID, func(s *Schedule) {
+			if runs > 0 {
+				s.LastRun = now
+			}
+			s.NextRun = expr.Next(now)
+		})
+
+		if err != nil {
+			a.DmnLogFile.Log.Printf("Unable to update schedule %v: %v\n", s.ID, err)
+			continue
+		}
+
+		a.triggerSchedule(updated, runs)
+	}
+}
+
+// TriggerDueSchedules triggers every schedule whose next run is not after now
+func (a *App) TriggerDueSchedules(now time.Time) {
+
+	schedules, err := a.Schedules.ReadSchedules()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to read schedules: %v\n", err)
+		return
+	}
+
+	for _, s := range schedules {
+
+		if s.Paused || s.NextRun.IsZero() || s.NextRun.After(now) {
+			continue
+		}
+
+		expr, err := ParseCronExpression(s.Expression)
+
+		if err != nil {
+			a.DmnLogFile.Log.Printf("Invalid expression for schedule %v: %v\n", s.ID, err)
+			continue
+		}
+
+		updated, err := a.Schedules.UpdateSchedule(s.ID, func(s *Schedule) {
+			s.LastRun = now
+			s.NextRun = expr.Next(now)
+		})
+
+		if err != nil {
+			a.DmnLogFile.Log.Printf("Unable to update schedule %v: %v\n", s.ID, err)
+			continue
+		}
+
+		a.triggerSchedule(updated, 1)
+	}
+}
+
+// triggerSchedule runs the Command of the schedule the given number of times in the
+// background, unless the previous run is still going and the schedule skips overlaps.
+func (a *App) triggerSchedule(s Schedule, runs int) {
+
+	if runs == 0 {
+		return
+	}
+
+	if s.OverlapPolicy == SkipOverlap && a.CommandScheduler.scheduleRunning(s.ID) {
+		a.DmnLogFile.Log.Printf("Skipping schedule %v since it is still running\n", s.ID)
+		return
+	}
+
+	selectedCmd, err := a.SelectCmd(s.CmdHash)
+
+	if err != nil || selectedCmd.CmdHash == "" {
+		a.DmnLogFile.Log.Printf("Unable to select command %v for schedule %v\n", s.CmdHash, s.ID)
+		return
+	}
+
+	a.CommandScheduler.startSchedule(s.ID)
+
+	go func() {
+		defer a.CommandScheduler.finishSchedule(s.ID)
+
+		for i := 0; i < runs; i++ {
+			a.DmnLogFile.Log.Printf("Triggering schedule %v: %v\n", s.ID, selectedCmd.CmdHash)
+			sc, err := a.RunCmd(selectedCmd)
+			if err != nil {
+				a.DmnLogFile.Log.Printf("Unable to run schedule %v: %v\n", s.ID, err)
+				continue
+			}
+			a.DmnLogFile.Log.Printf("Schedule %v completed: %v\n", s.ID, sc.Status)
+		}
+	}()
+}
@@ -0,0 +1,277 @@
+package dmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleSchedules lists the schedules of the Commands that the user can see, along with
+// their next fire times
+func (a *App) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
+		return
+	}
+
+	schedules, err := a.ListSchedules()
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read schedules", err)
+		return
+	}
+
+	// Schedules of Commands in the libraries of other users are left out
+	hidden, err := a.hiddenCmds(user)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read history file", err)
+		return
+	}
+
+	visible := []Schedule{}
+
+	for _, s := range schedules {
+		if !hidden[s.CmdHash] {
+			visible = append(visible, s)
+		}
+	}
+
+	out, err := json.Marshal(visible)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleAddSchedule attaches a cron expression or a fixed interval to a Command. If the
+// policies are not part of the request, missed runs are skipped and overlaps are allowed.
+func (a *App) HandleAddSchedule(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	missedRunPolicy := MissedRunPolicy(variables.MissedRunPolicy)
+	if missedRunPolicy == "" {
+		missedRunPolicy = SkipMissedRuns
+	}
+
+	overlapPolicy := OverlapPolicy(variables.OverlapPolicy)
+	if overlapPolicy == "" {
+		overlapPolicy = AllowOverlap
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	s, err := a.AddSchedule(selectedCmd.CmdHash, variables.Expression, missedRunPolicy, overlapPolicy)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to add schedule", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditSchedule, CmdHash: s.CmdHash, Detail: "add " + s.ID + ": " + s.Expression})
+
+	out, err := json.Marshal(s)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandlePauseSchedule pauses a schedule
+func (a *App) HandlePauseSchedule(w http.ResponseWriter, r *http.Request) {
+	a.handleScheduleUpdate(w, r, "pause", a.PauseSchedule)
+}
+
+// HandleResumeSchedule resumes a paused schedule
+func (a *App) HandleResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	a.handleScheduleUpdate(w, r, "resume", a.ResumeSchedule)
+}
+
+// HandleDeleteSchedule deletes a schedule
+func (a *App) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	a.handleScheduleUpdate(w, r, "delete", a.Schedules.DeleteSchedule)
+}
+
+// handleScheduleUpdate applies update to the schedule in the request and returns the result.
+// action names the update in the audit log. Schedules of Commands in the libraries of
+// other users are not found.
+func (a *App) handleScheduleUpdate(w http.ResponseWriter, r *http.Request, action string, update func(string) (Schedule, error)) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	s, err := a.Schedules.GetSchedule(variables.ScheduleID)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to update schedule", err)
+		return
+	}
+
+	if !a.authorizeCmds(w, r, user, EditCommands, []string{s.CmdHash}, fmt.Errorf("%w: %v", ErrScheduleNotFound, s.ID)) {
+		return
+	}
+
+	s, err = update(variables.ScheduleID)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to update schedule", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditSchedule, CmdHash: s.CmdHash, Detail: action + " " + s.ID})
+
+	out, err := json.Marshal(s)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// ListSchedules returns the schedules
+func (a *App) ListSchedules() ([]Schedule, error) {
+
+	schedules, err := a.Schedules.ReadSchedules()
+
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+
+	return schedules, err
+}
+
+// AddSchedule creates a schedule for a Command. The first run is the next time the
+// expression fires.
+func (a *App) AddSchedule(cmdHash string, expression string, missedRunPolicy MissedRunPolicy, overlapPolicy OverlapPolicy) (Schedule, error) {
+
+	selectedCmd, err := a.SelectCmd(cmdHash)
+
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s := Schedule{
+		ID:              newID(),
+		CmdHash:         selectedCmd.CmdHash,
+		Expression:      expression,
+		MissedRunPolicy: missedRunPolicy,
+		OverlapPolicy:   overlapPolicy,
+	}
+
+	if err := s.Validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	expr, _ := ParseCronExpression(expression)
+	s.NextRun = expr.Next(time.Now())
+
+	a.DmnLogFile.Log.Printf("Adding schedule %v for %v: %v\n", s.ID, s.CmdHash, s.Expression)
+
+	return s, a.Schedules.AddSchedule(s)
+}
+
+// PauseSchedule stops a schedule from firing until it is resumed
+func (a *App) PauseSchedule(id string) (Schedule, error) {
+
+	a.DmnLogFile.Log.Printf("Pausing schedule %v\n", id)
+
+	return a.Schedules.UpdateSchedule(id, func(s *Schedule) {
+		s.Paused = true
+	})
+}
+
+// ResumeSchedule resumes a paused schedule. Runs that would have fired while the schedule
+// was paused are not made up for.
+func (a *App) ResumeSchedule(id string) (Schedule, error) {
+
+	a.DmnLogFile.Log.Printf("Resuming schedule %v\n", id)
+
+	return a.Schedules.UpdateSchedule(id, func(s *Schedule) {
+		if expr, err := ParseCronExpression(s.Expression); err == nil {
+			s.NextRun = expr.Next(time.Now())
+		}
+		s.Paused = false
+	})
+}
@@ -0,0 +1,105 @@
+package dmn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleHandler(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if app.SaveCmd(cmd) != true {
+		t.Errorf("Unable to save command")
+	}
+
+	if _, err := app.AddSchedule(cmd.CmdHash, "not an expression", SkipMissedRuns, AllowOverlap); err == nil {
+		t.Errorf("Added schedule with an invalid expression")
+	}
+
+	s, err := app.AddSchedule(cmd.CmdHash, "@every 1h", SkipMissedRuns, SkipOverlap)
+
+	if err != nil {
+		t.Fatalf("Unable to add schedule: %v", err)
+	}
+
+	if s.NextRun.IsZero() {
+		t.Errorf("Next run was not set")
+	}
+
+	s, err = app.PauseSchedule(s.ID)
+
+	if err != nil || s.Paused != true {
+		t.Errorf("Unable to pause schedule: %v", err)
+	}
+
+	s, err = app.ResumeSchedule(s.ID)
+
+	if err != nil || s.Paused != false {
+		t.Errorf("Unable to resume schedule: %v", err)
+	}
+
+	schedules, err := app.ListSchedules()
+
+	if err != nil || len(schedules) != 1 {
+		t.Errorf("Expected one schedule but got %v", len(schedules))
+	}
+}
+
+func TestTriggerDueSchedules(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls", "list files", ".")
+
+	if app.SaveCmd(cmd) != true {
+		t.Errorf("Unable to save command")
+	}
+
+	app.CreateScheduler()
+	go app.RunScheduler()
+	go app.QueuedCommandsCleanup()
+
+	s, err := app.AddSchedule(cmd.CmdHash, "@every 1h", SkipMissedRuns, AllowOverlap)
+
+	if err != nil {
+		t.Fatalf("Unable to add schedule: %v", err)
+	}
+
+	now := s.NextRun.Add(time.Second)
+
+	app.TriggerDueSchedules(now)
+
+	schedules, _ := app.ListSchedules()
+
+	if !schedules[0].LastRun.Equal(now) || !schedules[0].NextRun.After(now) {
+		t.Errorf("Schedule was not updated after it fired: %v", schedules[0])
+	}
+
+	// The Command runs in the background, so wait for its duration to be recorded
+	for i := 0; i < 50; i++ {
+		selectedCmd, _ := app.SelectCmd(cmd.CmdHash)
+		if selectedCmd.Duration != -1 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Errorf("Scheduled command did not run")
+}
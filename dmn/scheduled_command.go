@@ -1,11 +1,14 @@
 package dmn
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,6 +19,10 @@ type ScheduledCommand struct {
 	ExitStatus int       `json:"exitStatus"`
 	StartTime  time.Time `json:"startTime"`
 	EndTime    time.Time `json:"endTime"`
+	Sandboxed  bool      `json:"sandboxed"`
+
+	// Attempts has every attempt of a run that was retried
+	Attempts []ScheduledCommand `json:"attempts,omitempty"`
 }
 
 func getCurrentWorkingDirectory() string {
@@ -32,8 +39,56 @@ func (sc *ScheduledCommand) RunShellScriptCommandWithExpectedStatus(expectedStat
 	fmt.Println("Completed RunShellScriptCommandWithExpectedStatus")
 }
 
-// RunShellScriptCommandWithExitStatus runs a Command written to a temporary file
+// RunShellScriptCommandWithExitStatus runs a Command written to a temporary file.
+// The ExecSettings of the Command are applied to the process, and if the sandbox is
+// enabled the Command runs inside it.
 func (sc *ScheduledCommand) RunShellScriptCommandWithExitStatus() int {
+	return sc.RunShellScriptCommandWithContext(context.Background())
+}
+
+// RunShellScriptCommandWithContext runs a Command like RunShellScriptCommandWithExitStatus
+// and kills it if ctx is cancelled, in which case the status is Cancelled.
+func (sc *ScheduledCommand) RunShellScriptCommandWithContext(ctx context.Context) int {
+
+	// Set a default working directory if it's not set
+	if sc.WorkingDirectory == "" {
+		sc.WorkingDirectory = getCurrentWorkingDirectory()
+	}
+
+	sc.Sandboxed = false
+
+	var sandboxPrelude string
+
+	if sc.Sandbox.Enabled {
+		err := sc.Sandbox.Validate(sc.ExecSettings)
+
+		if err == nil {
+			err = sandboxAvailable()
+		}
+
+		if err != nil && sc.Sandbox.Required {
+			sc.Status = Failed
+			sc.Coutput = "Unable to run in sandbox: " + err.Error()
+			return sc.ExitStatus
+		}
+
+		if err == nil {
+			// The mounts inside the sandbox are matched against absolute paths
+			wd, absErr := filepath.Abs(sc.WorkingDirectory)
+			if absErr == nil {
+				wd, absErr = filepath.EvalSymlinks(wd)
+			}
+
+			if absErr != nil {
+				sc.Status = Failed
+				sc.Coutput = "Unable to resolve working directory: " + absErr.Error()
+				return sc.ExitStatus
+			}
+
+			sandboxPrelude = sc.Sandbox.scriptPrelude(wd)
+			sc.Sandboxed = true
+		}
+	}
 
 	tempFile, err := ioutil.TempFile(os.TempDir(), "recmd-")
 
@@ -43,33 +98,77 @@ func (sc *ScheduledCommand) RunShellScriptCommandWithExitStatus() int {
 
 	defer os.Remove(tempFile.Name())
 
-	_, err = tempFile.WriteString("#!/bin/sh\n\n" + sc.CmdString)
+	_, err = tempFile.WriteString("#!/bin/sh\n\n" + sandboxPrelude + sc.ExecSettings.scriptPrelude() + sc.CmdString)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Errror: unable to write script to temp file: : %s\n", err)
 	}
 
-	cmd := exec.Command("sh", tempFile.Name())
+	cmd := sc.ExecSettings.command(ctx, tempFile.Name())
 	cmd.Dir = sc.WorkingDirectory
 
-	// Set a default working directory if it's not set
-	if sc.WorkingDirectory == "" {
-		sc.WorkingDirectory = getCurrentWorkingDirectory()
+	cleanup, err := sc.ExecSettings.apply(cmd, sc.CmdHash, tempFile.Name())
+	defer cleanup()
+
+	if err != nil {
+		sc.Status = Failed
+		sc.Coutput = "Unable to apply execution settings: " + err.Error()
+		return sc.ExitStatus
+	}
+
+	// The prelude of the sandbox reports a failure to set it up on a pipe of its own
+	var sandboxStatus *os.File
+
+	if sc.Sandboxed {
+		sc.Sandbox.apply(cmd)
+
+		status, statusWriter, err := os.Pipe()
+
+		if err != nil {
+			sc.Status = Failed
+			sc.Coutput = "Unable to set up sandbox: " + err.Error()
+			return sc.ExitStatus
+		}
+
+		defer status.Close()
+
+		cmd.ExtraFiles = []*os.File{statusWriter}
+		sandboxStatus = status
 	}
-	cmd.Dir = sc.WorkingDirectory
 
 	combinedOutput, combinedOutputErr := cmd.CombinedOutput()
 
+	if sandboxStatus != nil {
+		cmd.ExtraFiles[0].Close()
+	}
+
 	// fmt.Fprintf(os.Stdout, "\nError: %s error 2: %v\n", string(combinedOutput), err2)
 
+	sc.ExitStatus = 0
+
 	if combinedOutputErr != nil {
-		//sc.ExitStatus = -1
+		sc.ExitStatus = -1
+		if exitErr, ok := combinedOutputErr.(*exec.ExitError); ok {
+			sc.ExitStatus = exitErr.ExitCode()
+		}
 		sc.Status = Failed
 	} else {
 		sc.Status = Completed
 	}
 
+	if ctx.Err() != nil {
+		sc.Status = Cancelled
+	}
+
 	sc.Coutput = string(combinedOutput)
 
+	// The Command did not run if the mounts of the sandbox could not be set up
+	if sandboxStatus != nil {
+		if reason, _ := ioutil.ReadAll(sandboxStatus); len(reason) > 0 {
+			sc.Sandboxed = false
+			sc.Coutput = sandboxFailure + strings.TrimSpace(string(reason)) + "\n" + sc.Coutput
+		}
+	}
+
 	return sc.ExitStatus
 }
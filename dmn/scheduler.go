@@ -1,7 +1,10 @@
 package dmn
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -9,47 +12,111 @@ import (
 type Scheduler struct {
 	CommandQueue   chan Command
 	CompletedQueue chan ScheduledCommand
-	VacuumQueue    chan Command
-	QueuedCommands []Command
+
+	// Runs holds the runs that are queued, running or recently finished
+	Runs RunRegistry
+
+	// queueMutex guards the waiting runs and the cancellation state below. It is held
+	// while checking and adding runs so that the concurrency policies see a consistent
+	// view of the queue.
+	queueMutex sync.Mutex
+
+	// Runs that were cancelled before they started, and the cancel functions of the
+	// runs in progress, by run ID
+	cancelled map[string]bool
+	cancels   map[string]context.CancelFunc
+
+	// Runs waiting for the scheduler, ordered by priority when they are taken off
+	waiting     []queuedRun
+	waitingCond *sync.Cond
+	seq         uint64
+
+	// Callers waiting on the result of a run they were coalesced into, by run ID
+	waiters map[string][]chan ScheduledCommand
+
+	// Number of runs in progress for each schedule
+	runningSchedules map[string]int
+	schedulesMutex   sync.Mutex
+
+	// Timers for the pending runs, by run ID
+	pendingTimers map[string]*time.Timer
+	pendingMutex  sync.Mutex
+
+	// Runs waiting for their next attempt, by run ID. They are guarded by queueMutex.
+	retrying map[string]retryingRun
 }
 
-// CreateScheduler creates the channels
+// retryingRun is a run that failed and is put back on the waiting runs when timer fires
+type retryingRun struct {
+	run   queuedRun
+	timer *time.Timer
+}
+
+// CreateScheduler creates the channels. Finished runs are kept for the queue retention
+// window of the configuration.
 func (a *App) CreateScheduler() {
+
+	retention, err := a.Settings.Retention()
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Invalid queue retention, using %v: %v\n", DefaultQueueRetention, err)
+		retention = DefaultQueueRetention
+	}
+
+	a.CommandScheduler.Runs.SetRetention(retention)
+
 	a.CommandScheduler.CompletedQueue = make(chan ScheduledCommand)
 	a.CommandScheduler.CommandQueue = make(chan Command)
-	a.CommandScheduler.VacuumQueue = make(chan Command)
+	a.CommandScheduler.runningSchedules = make(map[string]int)
+	a.CommandScheduler.pendingTimers = make(map[string]*time.Timer)
+	a.CommandScheduler.cancelled = make(map[string]bool)
+	a.CommandScheduler.cancels = make(map[string]context.CancelFunc)
+	a.CommandScheduler.waiters = make(map[string][]chan ScheduledCommand)
+	a.CommandScheduler.retrying = make(map[string]retryingRun)
+	a.CommandScheduler.createWaiting()
 }
 
-// QueuedCommandsCleanup removes completed commands from the array.
-// Once it receives a command from the channel, it starts a goroutine
-// to make it a non-blocking operation.
-func (a *App) QueuedCommandsCleanup() {
-	for selectedCmd := range a.CommandScheduler.VacuumQueue {
-		go func() {
-			time.Sleep(time.Second * 3)
-			a.DmnLogFile.Log.Printf("Vacuuming %v\n", selectedCmd.CmdHash)
-			for foundIndex, cmd := range a.CommandScheduler.QueuedCommands {
-				if cmd.CmdHash == selectedCmd.CmdHash {
-					//log.Printf("Vacuuming command: %v\n", cmd.CmdHash)
-					a.CommandScheduler.QueuedCommands = append(a.CommandScheduler.QueuedCommands[:foundIndex], a.CommandScheduler.QueuedCommands[foundIndex+1:]...)
-					break
-				}
-			}
-		}()
+func (s *Scheduler) startSchedule(id string) {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+	s.runningSchedules[id]++
+}
+
+func (s *Scheduler) finishSchedule(id string) {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+	s.runningSchedules[id]--
+	if s.runningSchedules[id] <= 0 {
+		delete(s.runningSchedules, id)
 	}
-	a.DmnLogFile.Log.Printf("Total queued: %v\n", len(a.CommandScheduler.QueuedCommands))
 }
 
-func (a *App) updateStatusForQueuedCommand(selectedCmd Command, status CommandStatus) {
-	for foundIndex, cmd := range a.CommandScheduler.QueuedCommands {
-		if cmd.CmdHash == selectedCmd.CmdHash {
-			a.DmnLogFile.Log.Printf("Updating status for %v: %v to %v\n", cmd.CmdHash, a.CommandScheduler.QueuedCommands[foundIndex].Status, status)
-			a.CommandScheduler.QueuedCommands[foundIndex].Status = status
-			break
+func (s *Scheduler) scheduleRunning(id string) bool {
+	s.schedulesMutex.Lock()
+	defer s.schedulesMutex.Unlock()
+	return s.runningSchedules[id] > 0
+}
+
+// CleanupInterval is how often finished runs are removed from the queue
+var CleanupInterval = time.Second
+
+// QueuedCommandsCleanup periodically removes the runs that finished longer than the
+// retention window ago
+func (a *App) QueuedCommandsCleanup() {
+	for {
+		time.Sleep(CleanupInterval)
+
+		if removed := a.CommandScheduler.Runs.Prune(time.Now()); removed > 0 {
+			a.DmnLogFile.Log.Printf("Vacuumed %v runs, total queued: %v\n", removed, a.CommandScheduler.Runs.Len())
 		}
 	}
 }
 
+func (a *App) updateStatusForQueuedCommand(selectedCmd Command, status CommandStatus) {
+	a.DmnLogFile.Log.Printf("Updating status for %v to %v\n", selectedCmd.CmdHash, status)
+	a.CommandScheduler.Runs.SetStatus(selectedCmd, status)
+}
+
 // RunSchedulerMock runs a mock schedule
 func (a *App) RunSchedulerMock(expectedStatus CommandStatus) {
 
@@ -86,31 +153,141 @@ func (a *App) RunSchedulerMock(expectedStatus CommandStatus) {
 	}
 }
 
-// RunScheduler reads off the CommandQueue and runs Commands
+// RunScheduler runs the waiting Commands one at a time, highest priority first. Commands
+// put on the CommandQueue are added to the waiting runs. Failed runs are retried
+// according to the RetryPolicy of the Command: the run goes back to the waiting runs
+// once the backoff has passed, so other runs are not held up in the meantime. Runs that
+// were cancelled while they were waiting are not run.
 func (a *App) RunScheduler() {
-	for cmd := range a.CommandScheduler.CommandQueue {
+
+	go a.CommandScheduler.feedCommandQueue()
+
+	for {
+		run := a.CommandScheduler.next()
+		cmd := run.cmd
 		//log.Printf("Scheduling command: %v\n", cmd.CmdHash)
 
-		var sc ScheduledCommand
+		ctx, ok := a.CommandScheduler.startRun(cmd.RunID)
+
+		if !ok {
+			a.DmnLogFile.Log.Printf("Skipping cancelled run %v of %v\n", cmd.RunID, cmd.CmdHash)
+
+			var sc ScheduledCommand
+			sc.Command = cmd
+			sc.Status = Cancelled
+
+			// A run that was waiting to be retried ends with the attempts it made
+			if len(run.attempts) > 0 {
+				run.attempts[len(run.attempts)-1].Status = Cancelled
+				sc = finalAttempt(cmd, run.attempts)
+			}
+
+			a.updateStatusForQueuedCommand(cmd, Cancelled)
+
+			a.CommandScheduler.complete(run, sc)
+			continue
+		}
 
-		sc.CmdHash = cmd.CmdHash
-		sc.CmdString = cmd.CmdString
-		sc.Description = cmd.Description
-		sc.WorkingDirectory = cmd.WorkingDirectory
-		sc.Status = Running
 		a.updateStatusForQueuedCommand(cmd, Running)
 
-		sc.StartTime = time.Now()
-		sc.RunShellScriptCommandWithExitStatus()
-		sc.EndTime = time.Now()
-		sc.Duration = sc.EndTime.Sub(sc.StartTime)
-		//sc.Status = Completed
+		attempt := len(run.attempts) + 1
+
+		sc := a.runAttempt(ctx, cmd, attempt)
+
+		a.CommandScheduler.finishRun(cmd.RunID)
+
+		run.attempts = append(run.attempts, sc)
+
+		if cmd.Retry.shouldRetry(sc, attempt) {
+			delay := cmd.Retry.delay(attempt, rand.Float64)
+
+			a.DmnLogFile.Log.Printf("Retrying command %v in %v after attempt %v failed with exit status %v\n", cmd.CmdHash, delay, attempt, sc.ExitStatus)
+
+			a.updateStatusForQueuedCommand(cmd, Scheduled)
+			a.CommandScheduler.retryLater(run, delay)
+			continue
+		}
+
+		sc = finalAttempt(cmd, run.attempts)
+
+		a.indexRun(sc)
+
 		a.updateStatusForQueuedCommand(cmd, sc.Status)
 
 		if sc.Status != Completed {
 			a.DmnLogFile.Log.Printf("Error: Command %v failed with exit status %v: %v\n", sc.CmdHash, sc.ExitStatus, sc.Coutput)
 		}
 
-		a.CommandScheduler.CompletedQueue <- sc
+		a.CommandScheduler.complete(run, sc)
 	}
 }
+
+// runAttempt runs one attempt of a Command. Retries get their own run ID, linked to the
+// original run with ParentRunID, and are recorded in the run registry alongside it.
+// Cancelling ctx kills the attempt.
+func (a *App) runAttempt(ctx context.Context, cmd Command, attempt int) ScheduledCommand {
+
+	var sc ScheduledCommand
+
+	sc.Command = cmd
+	sc.Attempt = attempt
+	sc.Status = Running
+
+	if attempt > 1 {
+		sc.RunID = newID()
+		sc.ParentRunID = cmd.RunID
+		a.CommandScheduler.Runs.Add(sc.Command)
+	}
+
+	sc.StartTime = time.Now()
+	sc.RunShellScriptCommandWithContext(ctx)
+	sc.EndTime = time.Now()
+	sc.Duration = sc.EndTime.Sub(sc.StartTime)
+	//sc.Status = Completed
+
+	if attempt > 1 {
+		a.updateStatusForQueuedCommand(sc.Command, sc.Status)
+	}
+
+	return sc
+}
+
+// finalAttempt returns the result of a run. It reflects the last attempt, except that it
+// keeps the run ID and start time of the first one. If there was more than one attempt,
+// every attempt is in Attempts.
+func finalAttempt(cmd Command, attempts []ScheduledCommand) ScheduledCommand {
+
+	final := attempts[len(attempts)-1]
+	final.RunID = cmd.RunID
+	final.ParentRunID = ""
+	final.StartTime = attempts[0].StartTime
+
+	if len(attempts) > 1 {
+		final.Attempts = attempts
+	}
+
+	return final
+}
+
+// retryLater puts a run back on the waiting runs after delay. The run stays scheduled in
+// the meantime, and cancelling it puts it back right away so that it ends without waiting.
+func (s *Scheduler) retryLater(run queuedRun, delay time.Duration) {
+
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	runID := run.cmd.RunID
+
+	timer := time.AfterFunc(delay, func() {
+
+		s.queueMutex.Lock()
+		defer s.queueMutex.Unlock()
+
+		if _, ok := s.retrying[runID]; ok {
+			delete(s.retrying, runID)
+			s.requeue(run)
+		}
+	})
+
+	s.retrying[runID] = retryingRun{run: run, timer: timer}
+}
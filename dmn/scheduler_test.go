@@ -36,13 +36,8 @@ func TestScheduler(t *testing.T) {
 		for sc := range a.CommandScheduler.CompletedQueue {
 			//fmt.Printf("Command received from CompletedQueue: %v %v %v\n", sc.CmdHash, sc.Description, sc.Status)
 
-			for index, cmd := range a.CommandScheduler.QueuedCommands {
-				if cmd.CmdHash == sc.CmdHash {
-					fmt.Printf("Updating status of %v: %v\n", cmd.CmdHash, Completed)
-					a.CommandScheduler.QueuedCommands[index].Status = Completed
-					break
-				}
-			}
+			fmt.Printf("Updating status of %v: %v\n", sc.CmdHash, Completed)
+			a.CommandScheduler.Runs.SetStatus(sc.Command, Completed)
 		}
 	}()
 
@@ -50,8 +45,8 @@ func TestScheduler(t *testing.T) {
 	go a.RunSchedulerMock(Completed)
 
 	// Add commands to the array of queued commands. This is used to track the state.
-	a.CommandScheduler.QueuedCommands = append(a.CommandScheduler.QueuedCommands, cmd1)
-	a.CommandScheduler.QueuedCommands = append(a.CommandScheduler.QueuedCommands, cmd2)
+	a.CommandScheduler.Runs.Add(cmd1)
+	a.CommandScheduler.Runs.Add(cmd2)
 
 	// Now feed the CommandQueue
 	a.CommandScheduler.CommandQueue <- cmd1
@@ -10,7 +10,7 @@ import (
 )
 
 // HandleSearch searches for a Command by its description. Only lowercase is used to evaulate
-// whether a substring matches.
+// whether a substring matches. The results can be filtered and grouped like in HandleList.
 func (a *App) HandleSearch(w http.ResponseWriter, r *http.Request) {
 
 	// Get variables from the request
@@ -21,54 +21,49 @@ func (a *App) HandleSearch(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
 		return
 	}
 
-	// Select the dmn.Command, otherwise, if the dmn.Command hash cannot be found, return error 400
-	selectedCmds, cerr := a.SearchCmd(variables.Description)
+	selectedCmds := a.SearchCmd(variables.Description)
+
+	ret, err := filterAndGroup(r.URL.Query(), user.Visible(selectedCmds))
 
-	if cerr != nil {
-		a.DmnLogFile.Log.Println("Unable to select Command")
-		w.WriteHeader(http.StatusBadRequest)
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid filter", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-
-	out, err := json.Marshal(selectedCmds)
+	out, err := json.Marshal(ret)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
 		return
 	}
 
 	io.WriteString(w, string(out))
 }
 
-// SearchCmd returns a Command by name
-func (a *App) SearchCmd(description string) ([]Command, error) {
+// SearchCmd returns the Commands whose description contains the given text. The search
+// index looks up the Commands that contain the words of the text, so that only their
+// descriptions have to be compared.
+func (a *App) SearchCmd(description string) []Command {
 
 	a.DmnLogFile.Log.Println("Searching " + description)
 
-	cmds, error := a.History.ReadCmdHistoryFile()
-
 	ret := []Command{}
 
-	if error != nil {
-		return []Command{}, error
-	}
-
 	expectedDescription := strings.ToLower(description)
 
-	for _, cmd := range cmds {
+	for _, cmd := range a.Index.CandidateCmds(description) {
 
 		// Use lower case for evaluation
 		lowerDescription := strings.ToLower(cmd.Description)
@@ -78,5 +73,5 @@ func (a *App) SearchCmd(description string) ([]Command, error) {
 		}
 	}
 
-	return ret, nil
+	return ret
 }
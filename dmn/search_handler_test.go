@@ -29,11 +29,7 @@ func TestSearchHandler(t *testing.T) {
 	}
 
 	// Select the command. The hash is computed from the command string, so this is a well known constant.
-	cmds, err := app.SearchCmd(cmdDescription)
-
-	if err != nil {
-		t.Errorf("Unable to select command")
-	}
+	cmds := app.SearchCmd(cmdDescription)
 
 	if len(cmds) != 1 {
 		t.Errorf("Command not found")
@@ -0,0 +1,954 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The file the search index is kept in
+	recmdSearchIndexFile = "recmd_search_index.json"
+
+	// The search index file written by older versions. Its runs are moved to the outputs
+	// directory when the index is loaded.
+	recmdIndexFile = "recmd_index.json"
+
+	// The directory containing the output of past runs
+	recmdOutputsDir = "outputs"
+
+	// MaxMatchedLines is the number of matching lines returned for each run
+	MaxMatchedLines = 20
+
+	// Prefixes of the keys of the documents in the index
+	cmdDoc = "cmd:"
+	runDoc = "run:"
+
+	// The field of a run that is indexed
+	fieldOutput = "output"
+
+	// The length of the longest substrings of terms that are indexed
+	gramSize = 3
+)
+
+// IndexedRun represents a past run whose output is stored
+type IndexedRun struct {
+	RunID      string        `json:"runId"`
+	CmdHash    string        `json:"commandHash"`
+	CmdString  string        `json:"commandString"`
+	Status     CommandStatus `json:"status"`
+	ExitStatus int           `json:"exitStatus"`
+	StartTime  time.Time     `json:"startTime"`
+	EndTime    time.Time     `json:"endTime"`
+}
+
+// OutputLine represents a line of output. Lines are numbered from 1.
+type OutputLine struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// OutputMatch represents a run whose output matched a search
+type OutputMatch struct {
+	IndexedRun
+	Lines []OutputLine `json:"lines"`
+}
+
+// posting is a field of a document that contains a term
+type posting struct {
+	doc   string
+	field string
+}
+
+// fieldTerm is a term in a field of a document
+type fieldTerm struct {
+	field string
+	term  string
+}
+
+// indexPosting is a posting as it is written to the index file
+type indexPosting struct {
+	Doc   string `json:"doc"`
+	Field string `json:"field"`
+}
+
+// storedIndex is the search index as it is written to the index file
+type storedIndex struct {
+	Postings map[string][]indexPosting `json:"postings"`
+	Grams    map[string][]string       `json:"grams"`
+	Cmds     []Command                 `json:"commands"`
+	Runs     map[string]IndexedRun     `json:"runs"`
+}
+
+// IndexFile represents the search index and the stored output of past runs. The index
+// is an inverted index from the words in the fields of Commands and in the output of
+// runs to the documents containing them, and from every substring of up to gramSize
+// characters of those words to the words, so that a search looks up the words that
+// contain its own words instead of comparing it with every word. The index is kept in
+// memory and written to the index file every time it changes: the Commands in it are
+// the ones last written to the history file, and each run is stored in the outputs
+// directory, with its output in <run ID>.log and what is known about the run in
+// <run ID>.json.
+type IndexFile struct {
+	Path       string
+	OutputsDir string
+	legacyPath string
+	mutex      sync.Mutex
+
+	postings  map[string]map[posting]bool
+	grams     map[string]map[string]bool
+	docs      map[string][]fieldTerm
+	cmds      []Command
+	positions map[string]int
+	runs      map[string]IndexedRun
+}
+
+// Set sets the path to the index file in confPath and to the outputs directory in dataPath
+func (f *IndexFile) Set(confPath string, dataPath string) {
+	f.Path = filepath.Join(confPath, recmdSearchIndexFile)
+	f.OutputsDir = filepath.Join(dataPath, recmdOutputsDir)
+	f.legacyPath = filepath.Join(dataPath, recmdIndexFile)
+}
+
+// Remove removes the index file and the stored outputs
+func (f *IndexFile) Remove() {
+	os.Remove(f.Path)
+	os.Remove(f.legacyPath)
+	os.RemoveAll(f.OutputsDir)
+}
+
+// Load reads the index file. If it is missing or corrupt, the index is built again from
+// the runs in the outputs directory and the Commands are added with SetCmds.
+func (f *IndexFile) Load() error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.reset()
+
+	if err := os.MkdirAll(f.OutputsDir, os.FileMode(0755)); err != nil {
+		return err
+	}
+
+	migrated, err := f.migrate()
+
+	if err != nil {
+		return err
+	}
+
+	if !migrated && f.read() == nil {
+		return nil
+	}
+
+	f.reset()
+
+	if err := f.rebuild(); err != nil {
+		return err
+	}
+
+	return f.write()
+}
+
+// reset empties the index. The caller must hold the mutex.
+func (f *IndexFile) reset() {
+
+	f.postings = nil
+	f.grams = nil
+	f.docs = nil
+	f.cmds = nil
+	f.positions = nil
+	f.runs = nil
+
+	f.init()
+}
+
+// read reads the index from the index file. An error is returned if the file is missing
+// or if it refers to Commands or runs that are not in it. The caller must hold the mutex.
+func (f *IndexFile) read() error {
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return err
+	}
+
+	var stored storedIndex
+
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	if stored.Postings == nil || stored.Grams == nil || stored.Cmds == nil || stored.Runs == nil {
+		return errors.New("incomplete index file")
+	}
+
+	f.cmds = stored.Cmds
+	f.runs = stored.Runs
+
+	for index, cmd := range f.cmds {
+		f.positions[cmd.CmdHash] = index
+	}
+
+	for term, postings := range stored.Postings {
+		f.postings[term] = make(map[posting]bool)
+
+		for _, p := range postings {
+			if !f.knownDoc(p.Doc) {
+				return errors.New("index file refers to an unknown document: " + p.Doc)
+			}
+
+			f.postings[term][posting{doc: p.Doc, field: p.Field}] = true
+			f.docs[p.Doc] = append(f.docs[p.Doc], fieldTerm{field: p.Field, term: term})
+		}
+	}
+
+	for gram, terms := range stored.Grams {
+		f.grams[gram] = make(map[string]bool)
+
+		for _, term := range terms {
+			f.grams[gram][term] = true
+		}
+	}
+
+	return nil
+}
+
+// knownDoc returns true if key is the key of a Command or of a run in the index. The
+// caller must hold the mutex.
+func (f *IndexFile) knownDoc(key string) bool {
+
+	if strings.HasPrefix(key, cmdDoc) {
+		_, ok := f.positions[key[len(cmdDoc):]]
+		return ok
+	}
+
+	if strings.HasPrefix(key, runDoc) {
+		_, ok := f.runs[key[len(runDoc):]]
+		return ok
+	}
+
+	return false
+}
+
+// write writes the index to the index file. The caller must hold the mutex.
+func (f *IndexFile) write() error {
+
+	if f.Path == "" {
+		return nil
+	}
+
+	stored := storedIndex{
+		Postings: make(map[string][]indexPosting),
+		Grams:    make(map[string][]string),
+		Cmds:     f.cmds,
+		Runs:     f.runs,
+	}
+
+	for term, postings := range f.postings {
+		for p := range postings {
+			stored.Postings[term] = append(stored.Postings[term], indexPosting{Doc: p.doc, Field: p.field})
+		}
+	}
+
+	for gram, terms := range f.grams {
+		stored.Grams[gram] = keys(terms)
+	}
+
+	data, err := json.Marshal(stored)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, os.FileMode(0600)); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.Path)
+}
+
+// save writes the index to the index file. If that fails the index file is removed, so
+// that the index is built again the next time it is loaded instead of being read from a
+// stale file. The caller must hold the mutex.
+func (f *IndexFile) save() error {
+
+	err := f.write()
+
+	if err != nil {
+		os.Remove(f.Path)
+	}
+
+	return err
+}
+
+// rebuild indexes the runs in the outputs directory. The caller must hold the mutex.
+func (f *IndexFile) rebuild() error {
+
+	entries, err := ioutil.ReadDir(f.OutputsDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		var run IndexedRun
+
+		data, err := ioutil.ReadFile(filepath.Join(f.OutputsDir, entry.Name()))
+
+		if err == nil {
+			err = json.Unmarshal(data, &run)
+		}
+
+		if err != nil || run.RunID == "" {
+			continue
+		}
+
+		output, err := ioutil.ReadFile(f.outputPath(run.RunID))
+
+		if err != nil {
+			continue
+		}
+
+		f.addDoc(runDoc+run.RunID, []fieldValue{{field: fieldOutput, value: string(output)}})
+		f.runs[run.RunID] = run
+	}
+
+	return nil
+}
+
+// init creates the maps of the index. The caller must hold the mutex.
+func (f *IndexFile) init() {
+
+	if f.postings == nil {
+		f.postings = make(map[string]map[posting]bool)
+		f.grams = make(map[string]map[string]bool)
+		f.docs = make(map[string][]fieldTerm)
+		f.cmds = []Command{}
+		f.positions = make(map[string]int)
+		f.runs = make(map[string]IndexedRun)
+	}
+}
+
+// migrate moves the runs in the index file written by older versions to the outputs
+// directory and removes that file. migrated is true if there was such a file. The caller
+// must hold the mutex.
+func (f *IndexFile) migrate() (migrated bool, err error) {
+
+	data, err := ioutil.ReadFile(f.legacyPath)
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	var legacy struct {
+		Runs map[string]IndexedRun `json:"runs"`
+	}
+
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, &legacy)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, run := range legacy.Runs {
+		if err := f.writeRun(run); err != nil {
+			return false, err
+		}
+	}
+
+	return true, os.Remove(f.legacyPath)
+}
+
+// indexTerms returns the distinct words of text in lowercase
+func indexTerms(text string) []string {
+
+	lower := strings.ToLower(text)
+
+	terms := []string{}
+	seen := make(map[string]bool)
+
+	for _, w := range words(lower) {
+		term := lower[w[0]:w[1]]
+
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// termGrams returns the distinct substrings of up to size characters of term
+func termGrams(term string, size int) []string {
+
+	runes := []rune(term)
+
+	ret := []string{}
+	seen := make(map[string]bool)
+
+	for n := 1; n <= size; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			gram := string(runes[i : i+n])
+
+			if !seen[gram] {
+				seen[gram] = true
+				ret = append(ret, gram)
+			}
+		}
+	}
+
+	return ret
+}
+
+// addDoc adds the words of the values to the index under key. The caller must hold the mutex.
+func (f *IndexFile) addDoc(key string, values []fieldValue) {
+
+	terms := []fieldTerm{}
+	seen := make(map[fieldTerm]bool)
+
+	for _, v := range values {
+		for _, term := range indexTerms(v.value) {
+			ft := fieldTerm{field: v.field, term: term}
+
+			if seen[ft] {
+				continue
+			}
+
+			seen[ft] = true
+			terms = append(terms, ft)
+
+			if f.postings[term] == nil {
+				f.postings[term] = make(map[posting]bool)
+
+				for _, gram := range termGrams(term, gramSize) {
+					if f.grams[gram] == nil {
+						f.grams[gram] = make(map[string]bool)
+					}
+
+					f.grams[gram][term] = true
+				}
+			}
+
+			f.postings[term][posting{doc: key, field: v.field}] = true
+		}
+	}
+
+	f.docs[key] = terms
+}
+
+// removeDoc removes the document with the key from the index. The caller must hold the mutex.
+func (f *IndexFile) removeDoc(key string) {
+
+	for _, ft := range f.docs[key] {
+		postings := f.postings[ft.term]
+
+		delete(postings, posting{doc: key, field: ft.field})
+
+		if len(postings) > 0 {
+			continue
+		}
+
+		delete(f.postings, ft.term)
+
+		for _, gram := range termGrams(ft.term, gramSize) {
+			delete(f.grams[gram], ft.term)
+
+			if len(f.grams[gram]) == 0 {
+				delete(f.grams, gram)
+			}
+		}
+	}
+
+	delete(f.docs, key)
+}
+
+// containingTerms returns the indexed terms that contain word. Only the terms that have
+// the rarest of the substrings of word are compared with it. The caller must hold the mutex.
+func (f *IndexFile) containingTerms(word string) []string {
+
+	runes := []rune(word)
+
+	if len(runes) <= gramSize {
+		return keys(f.grams[word])
+	}
+
+	var rarest map[string]bool
+
+	for i := 0; i+gramSize <= len(runes); i++ {
+		terms := f.grams[string(runes[i:i+gramSize])]
+
+		if len(terms) == 0 {
+			return nil
+		}
+
+		if rarest == nil || len(terms) < len(rarest) {
+			rarest = terms
+		}
+	}
+
+	ret := []string{}
+
+	for term := range rarest {
+		if strings.Contains(term, word) {
+			ret = append(ret, term)
+		}
+	}
+
+	return ret
+}
+
+// similarTerms returns the indexed terms that are at most maxEdits edits away from text.
+// Every edit changes at most two of the pairs of adjacent characters of text, so only the
+// terms that share one of the pairs are compared with it. If text is too short for that,
+// ok is false. The caller must hold the mutex.
+func (f *IndexFile) similarTerms(text string, maxEdits int) (terms []string, ok bool) {
+
+	runes := []rune(text)
+
+	if len(runes)-1 <= 2*maxEdits {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+
+	for i := 0; i+2 <= len(runes); i++ {
+		for term := range f.grams[string(runes[i:i+2])] {
+			if seen[term] {
+				continue
+			}
+
+			seen[term] = true
+
+			if levenshtein(term, text) <= maxEdits {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	return terms, true
+}
+
+// keys returns the keys of set
+func keys(set map[string]bool) []string {
+
+	ret := []string{}
+
+	for key := range set {
+		ret = append(ret, key)
+	}
+
+	return ret
+}
+
+// addPostings adds the documents whose keys start with prefix and that contain term in
+// field to docs. The prefix is removed from the keys. An empty field matches every field.
+// The caller must hold the mutex.
+func (f *IndexFile) addPostings(docs map[string]bool, term string, prefix string, field string) {
+
+	for p := range f.postings[term] {
+		if strings.HasPrefix(p.doc, prefix) && (field == "" || p.field == field) {
+			docs[p.doc[len(prefix):]] = true
+		}
+	}
+}
+
+// matchingDocs returns the documents whose keys start with prefix and that contain every
+// word of text in field, either as a whole word or as part of a word. The prefix is
+// removed from the keys. If text has no words, ok is false and every document may match.
+// The caller must hold the mutex.
+func (f *IndexFile) matchingDocs(text string, prefix string, field string) (docs map[string]bool, ok bool) {
+
+	words := indexTerms(text)
+
+	if len(words) == 0 {
+		return nil, false
+	}
+
+	for _, word := range words {
+		found := make(map[string]bool)
+
+		for _, term := range f.containingTerms(word) {
+			f.addPostings(found, term, prefix, field)
+		}
+
+		if docs != nil {
+			for key := range found {
+				if !docs[key] {
+					delete(found, key)
+				}
+			}
+		}
+
+		docs = found
+
+		if len(docs) == 0 {
+			break
+		}
+	}
+
+	return docs, true
+}
+
+// queryDocs returns the Commands that may match node. Terms that are regular expressions
+// and terms under NOT cannot narrow down the Commands, so if ok is false every Command may
+// match. The caller must hold the mutex.
+func (f *IndexFile) queryDocs(node queryNode) (docs map[string]bool, ok bool) {
+
+	switch n := node.(type) {
+	case andNode:
+		for _, child := range n.children {
+			found, ok := f.queryDocs(child)
+
+			if !ok {
+				continue
+			}
+
+			if docs != nil {
+				for key := range found {
+					if !docs[key] {
+						delete(found, key)
+					}
+				}
+			}
+
+			docs = found
+		}
+
+		return docs, docs != nil
+
+	case orNode:
+		docs = make(map[string]bool)
+
+		for _, child := range n.children {
+			found, ok := f.queryDocs(child)
+
+			if !ok {
+				return nil, false
+			}
+
+			for key := range found {
+				docs[key] = true
+			}
+		}
+
+		return docs, true
+
+	case termNode:
+		if n.regex {
+			return nil, false
+		}
+
+		docs, ok = f.matchingDocs(n.text, cmdDoc, n.field)
+
+		if !ok || !n.fuzzy {
+			return docs, ok
+		}
+
+		similar, ok := f.similarTerms(strings.ToLower(n.text), n.maxEdits())
+
+		if !ok {
+			return nil, false
+		}
+
+		for _, term := range similar {
+			f.addPostings(docs, term, cmdDoc, n.field)
+		}
+
+		return docs, true
+	}
+
+	return nil, false
+}
+
+// SetCmds replaces the Commands in the index with cmds. Only the Commands whose indexed
+// values changed are indexed again. Stored outputs are kept. The index file is only
+// written if a Command was added, removed or indexed again: the other fields of the
+// Commands are taken from the history file when the index is loaded.
+func (f *IndexFile) SetCmds(cmds []Command) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.init()
+
+	positions := make(map[string]int)
+
+	for index, cmd := range cmds {
+		positions[cmd.CmdHash] = index
+	}
+
+	changed := false
+
+	for hash, index := range f.positions {
+		if _, ok := positions[hash]; !ok {
+			f.removeDoc(cmdDoc + hash)
+			changed = true
+		} else if !sameValues(fieldValues(f.cmds[index]), fieldValues(cmds[positions[hash]])) {
+			f.removeDoc(cmdDoc + hash)
+			f.addDoc(cmdDoc+hash, fieldValues(cmds[positions[hash]]))
+			changed = true
+		}
+	}
+
+	for hash, index := range positions {
+		if _, ok := f.positions[hash]; !ok {
+			f.addDoc(cmdDoc+hash, fieldValues(cmds[index]))
+			changed = true
+		}
+	}
+
+	f.cmds = append([]Command{}, cmds...)
+	f.positions = positions
+
+	if changed {
+		f.save()
+	}
+}
+
+// sameValues returns true if both Commands have the same indexed values
+func sameValues(a []fieldValue, b []fieldValue) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cmdsIn returns the Commands whose hashes are in docs, in the order of the history file.
+// If ok is false, every Command is returned. The caller must hold the mutex.
+func (f *IndexFile) cmdsIn(docs map[string]bool, ok bool) []Command {
+
+	if !ok {
+		return append([]Command{}, f.cmds...)
+	}
+
+	indexes := []int{}
+
+	for hash := range docs {
+		if index, found := f.positions[hash]; found {
+			indexes = append(indexes, index)
+		}
+	}
+
+	sort.Ints(indexes)
+
+	ret := []Command{}
+
+	for _, index := range indexes {
+		ret = append(ret, f.cmds[index])
+	}
+
+	return ret
+}
+
+// CandidateCmds returns the Commands whose description may contain text
+func (f *IndexFile) CandidateCmds(text string) []Command {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.init()
+
+	return f.cmdsIn(f.matchingDocs(text, cmdDoc, fieldDescription))
+}
+
+// QueryCmds returns the Commands that may match the query
+func (f *IndexFile) QueryCmds(q Query) []Command {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.init()
+
+	return f.cmdsIn(f.queryDocs(q.root))
+}
+
+// outputPath returns the path to the stored output of a run
+func (f *IndexFile) outputPath(runID string) string {
+	return filepath.Join(f.OutputsDir, filepath.Base(runID)+".log")
+}
+
+// runPath returns the path to what is stored about a run
+func (f *IndexFile) runPath(runID string) string {
+	return filepath.Join(f.OutputsDir, filepath.Base(runID)+".json")
+}
+
+// writeRun writes what is known about a run next to its output
+func (f *IndexFile) writeRun(run IndexedRun) error {
+
+	data, err := json.Marshal(run)
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.runPath(run.RunID), data, os.FileMode(0644))
+}
+
+// AddRun stores and indexes the output of a run. If the run was retried, each attempt is
+// stored under its own run ID. Only the output of the last maxOutputs runs is kept.
+func (f *IndexFile) AddRun(sc ScheduledCommand, maxOutputs int) error {
+
+	if f.OutputsDir == "" || maxOutputs <= 0 {
+		return nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.init()
+
+	runs := sc.Attempts
+
+	if len(runs) == 0 {
+		runs = []ScheduledCommand{sc}
+	}
+
+	for _, run := range runs {
+		if run.RunID == "" {
+			continue
+		}
+
+		if err := ioutil.WriteFile(f.outputPath(run.RunID), []byte(run.Coutput), os.FileMode(0644)); err != nil {
+			return err
+		}
+
+		indexed := IndexedRun{
+			RunID:      run.RunID,
+			CmdHash:    run.CmdHash,
+			CmdString:  run.CmdString,
+			Status:     run.Status,
+			ExitStatus: run.ExitStatus,
+			StartTime:  run.StartTime,
+			EndTime:    run.EndTime,
+		}
+
+		if err := f.writeRun(indexed); err != nil {
+			return err
+		}
+
+		key := runDoc + run.RunID
+
+		f.removeDoc(key)
+		f.addDoc(key, []fieldValue{{field: fieldOutput, value: run.Coutput}})
+
+		f.runs[run.RunID] = indexed
+	}
+
+	f.prune(maxOutputs)
+
+	return f.save()
+}
+
+// prune removes the oldest runs until at most maxOutputs are left. The caller must hold
+// the mutex.
+func (f *IndexFile) prune(maxOutputs int) {
+
+	if len(f.runs) <= maxOutputs {
+		return
+	}
+
+	runs := []IndexedRun{}
+
+	for _, run := range f.runs {
+		runs = append(runs, run)
+	}
+
+	sortRuns(runs)
+
+	for _, run := range runs[maxOutputs:] {
+		f.removeDoc(runDoc + run.RunID)
+		delete(f.runs, run.RunID)
+		os.Remove(f.outputPath(run.RunID))
+		os.Remove(f.runPath(run.RunID))
+	}
+}
+
+// sortRuns sorts runs newest first
+func sortRuns(runs []IndexedRun) {
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartTime.Equal(runs[j].StartTime) {
+			return runs[i].StartTime.After(runs[j].StartTime)
+		}
+		return runs[i].RunID < runs[j].RunID
+	})
+}
+
+// SearchOutputs returns the runs whose output contains text, newest first. The search is
+// case insensitive and returns up to MaxMatchedLines matching lines of each run.
+func (f *IndexFile) SearchOutputs(text string) ([]OutputMatch, error) {
+
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("empty search")
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.init()
+
+	candidates, ok := f.matchingDocs(text, runDoc, fieldOutput)
+
+	runs := []IndexedRun{}
+
+	for runID, run := range f.runs {
+		if !ok || candidates[runID] {
+			runs = append(runs, run)
+		}
+	}
+
+	sortRuns(runs)
+
+	expected := strings.ToLower(text)
+
+	ret := []OutputMatch{}
+
+	for _, run := range runs {
+		data, err := ioutil.ReadFile(f.outputPath(run.RunID))
+
+		if err != nil {
+			continue
+		}
+
+		match := OutputMatch{IndexedRun: run, Lines: []OutputLine{}}
+
+		for index, line := range strings.Split(string(data), "\n") {
+			if strings.Contains(strings.ToLower(line), expected) {
+				match.Lines = append(match.Lines, OutputLine{Number: index + 1, Text: line})
+
+				if len(match.Lines) == MaxMatchedLines {
+					break
+				}
+			}
+		}
+
+		if len(match.Lines) > 0 {
+			ret = append(ret, match)
+		}
+	}
+
+	return ret, nil
+}
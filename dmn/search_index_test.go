@@ -0,0 +1,242 @@
+package dmn
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSearchIndexCommands(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd1 Command
+	cmd1.Set("ls -ltr", "list files", ".")
+
+	var cmd2 Command
+	cmd2.Set("df -h", "check free disk space", ".")
+
+	if !app.SaveCmd(cmd1) || !app.SaveCmd(cmd2) {
+		t.Fatalf("Unable to save commands")
+	}
+
+	search := func(description string) int {
+		return len(app.SearchCmd(description))
+	}
+
+	if n := search("st fi"); n != 1 {
+		t.Errorf("Expected 1 command to contain %q but got %v", "st fi", n)
+	}
+
+	description := "show mounted filesystems"
+
+	if _, err := app.UpdateCmd(cmd2.CmdHash, CommandUpdate{Description: &description}); err != nil {
+		t.Fatalf("Unable to update command: %v", err)
+	}
+
+	if n := search("disk"); n != 0 {
+		t.Errorf("Found %v commands with the old description", n)
+	}
+
+	if n := search("mounted"); n != 1 {
+		t.Errorf("Expected 1 command with the new description but got %v", n)
+	}
+
+	if _, err := app.DeleteCmd(cmd1.CmdHash); err != nil {
+		t.Fatalf("Unable to delete command: %v", err)
+	}
+
+	if n := search("list"); n != 0 {
+		t.Errorf("Found %v deleted commands", n)
+	}
+
+	// Runs of the command are seen by queries without reading the history file
+	if !app.UpdateCommandDuration(cmd2, 0) {
+		t.Fatalf("Unable to update command")
+	}
+
+	results, err := app.QueryCmd("mounted", CommandFilter{})
+
+	if err != nil || len(results) != 1 || results[0].Command.RunCount != 1 {
+		t.Errorf("Unexpected query results %v: %v", results, err)
+	}
+}
+
+func TestSearchIndexQuery(t *testing.T) {
+
+	var index IndexFile
+
+	index.SetCmds([]Command{
+		{CmdHash: "a", CmdString: "kubectl get pods", Description: "list pods", WorkingDirectory: "/srv", Tags: []string{"k8s"}},
+		{CmdHash: "b", CmdString: "df -h", Description: "check free disk space", WorkingDirectory: "/"},
+		{CmdHash: "c", CmdString: "tar czf backup.tgz /srv", Description: "backup the server", WorkingDirectory: "/srv"},
+	})
+
+	tests := []struct {
+		query  string
+		hashes string
+	}{
+		// Words are looked up as part of the indexed words, in every field or in one
+		{"od", "a"},
+		{"srv", "ac"},
+		{"dir:srv", "ac"},
+		{"desc:srv", ""},
+		{"tag:k8", "a"},
+		{`"free disk"`, "b"},
+		// Typos are looked up through the pairs of characters they share
+		{"bakup", "c"},
+		{"kubectl OR disk", "ab"},
+		{"srv -backup", "ac"},
+		// Regular expressions and terms under NOT cannot narrow down the Commands
+		{"/d.sk/", "abc"},
+		{"NOT pods", "abc"},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", test.query, err)
+		}
+
+		hashes := ""
+
+		for _, cmd := range index.QueryCmds(q) {
+			hashes += cmd.CmdHash
+		}
+
+		if hashes != test.hashes {
+			t.Errorf("Expected %q to be narrowed down to %q but got %q", test.query, test.hashes, hashes)
+		}
+	}
+
+	// Words that no Command has any more are removed from the index
+	index.SetCmds([]Command{{CmdHash: "b", CmdString: "df -h", Description: "show mounted filesystems"}})
+
+	if cmds := index.CandidateCmds("disk"); len(cmds) != 0 {
+		t.Errorf("Found %v commands with the old description", len(cmds))
+	}
+
+	if len(index.postings) != len(indexTerms("df -h show mounted filesystems")) {
+		t.Errorf("Unexpected words in the index: %v", index.postings)
+	}
+}
+
+func TestSearchIndexOutputs(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	start := time.Now()
+
+	run := func(runID string, output string, age time.Duration) ScheduledCommand {
+		var sc ScheduledCommand
+		sc.RunID = runID
+		sc.CmdHash = "abc"
+		sc.Coutput = output
+		sc.StartTime = start.Add(-age)
+		return sc
+	}
+
+	if err := app.Index.AddRun(run("old", "starting\npod OOMKilled\n", time.Hour), 3); err != nil {
+		t.Fatalf("Unable to add run: %v", err)
+	}
+
+	// Each attempt of a retried run is stored
+	retried := run("new", "", 0)
+	retried.Attempts = []ScheduledCommand{run("new", "oomkilled again", time.Minute), run("retry", "done", 0)}
+
+	if err := app.Index.AddRun(retried, 3); err != nil {
+		t.Fatalf("Unable to add run: %v", err)
+	}
+
+	matches, err := app.Index.SearchOutputs("OOMKilled")
+
+	if err != nil || len(matches) != 2 {
+		t.Fatalf("Expected 2 runs to match but got %v: %v", matches, err)
+	}
+
+	if matches[0].RunID != "new" || matches[1].RunID != "old" || matches[1].Lines[0].Number != 2 || matches[1].Lines[0].Text != "pod OOMKilled" {
+		t.Errorf("Unexpected matches: %v", matches)
+	}
+
+	// Only the output of the newest runs is kept
+	if err := app.Index.AddRun(run("newest", "OOMKilled", -time.Minute), 2); err != nil {
+		t.Fatalf("Unable to add run: %v", err)
+	}
+
+	matches, _ = app.Index.SearchOutputs("oomkilled")
+
+	if len(matches) != 1 || matches[0].RunID != "newest" {
+		t.Errorf("Expected only the newest run to match but got %v", matches)
+	}
+
+	// The index is read from the index file when it is loaded, without looking at what
+	// is stored about the runs in the outputs directory
+	os.Remove(app.Index.runPath("newest"))
+
+	app.Index.SetCmds([]Command{{CmdHash: "abc", CmdString: "kubectl rollout restart", Description: "restart the pods"}})
+
+	var index IndexFile
+	index.Set(app.Footprint.confDirPath, app.Footprint.dataDirPath)
+
+	if err := index.Load(); err != nil {
+		t.Fatalf("Unable to load index: %v", err)
+	}
+
+	if matches, _ := index.SearchOutputs("oomkilled"); len(matches) != 1 || matches[0].RunID != "newest" || matches[0].CmdHash != "abc" {
+		t.Errorf("Unexpected matches after loading the index: %v", matches)
+	}
+
+	if cmds := index.CandidateCmds("restart"); len(cmds) != 1 || cmds[0].CmdHash != "abc" {
+		t.Errorf("Unexpected commands after loading the index: %v", cmds)
+	}
+
+	// A corrupt index file is built again from the outputs directory
+	if err := ioutil.WriteFile(index.Path, []byte(`{"postings":`), os.FileMode(0600)); err != nil {
+		t.Fatalf("Unable to write index file: %v", err)
+	}
+
+	if err := index.Load(); err != nil {
+		t.Fatalf("Unable to load index: %v", err)
+	}
+
+	if matches, _ := index.SearchOutputs("oomkilled"); len(matches) != 0 {
+		t.Errorf("Expected the index to be built again but got %v", matches)
+	}
+
+	if matches, _ := index.SearchOutputs("done"); len(matches) != 1 || matches[0].RunID != "retry" {
+		t.Errorf("Unexpected matches after building the index again: %v", matches)
+	}
+
+	// So is a missing one, and the index file is written again
+	os.Remove(index.Path)
+
+	if err := index.Load(); err != nil {
+		t.Fatalf("Unable to load index: %v", err)
+	}
+
+	if _, err := os.Stat(index.Path); err != nil {
+		t.Errorf("Index file was not written: %v", err)
+	}
+
+	if matches, _ := index.SearchOutputs("done"); len(matches) != 1 || matches[0].RunID != "retry" {
+		t.Errorf("Unexpected matches after building the index again: %v", matches)
+	}
+
+	if _, err := app.Index.SearchOutputs(" "); err == nil {
+		t.Errorf("Accepted an empty search")
+	}
+}
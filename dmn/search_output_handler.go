@@ -0,0 +1,97 @@
+package dmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleSearchOutput searches the stored output of past runs. Only lowercase is used to
+// evaluate whether a line matches.
+func (a *App) HandleSearchOutput(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
+		return
+	}
+
+	a.DmnLogFile.Log.Println("Searching outputs for " + variables.Output)
+
+	matches, err := a.Index.SearchOutputs(variables.Output)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to search outputs", err)
+		return
+	}
+
+	matches, err = a.visibleOutputs(user, matches)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read history file", err)
+		return
+	}
+
+	out, err := json.Marshal(matches)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// visibleOutputs returns the matches from runs of Commands that the user can see
+func (a *App) visibleOutputs(user User, matches []OutputMatch) ([]OutputMatch, error) {
+
+	if user.Admin {
+		return matches, nil
+	}
+
+	cmds, err := a.History.ReadCmdHistoryFile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make(map[string]bool)
+
+	for _, cmd := range user.Visible(cmds) {
+		visible[cmd.CmdHash] = true
+	}
+
+	ret := []OutputMatch{}
+
+	for _, match := range matches {
+		if visible[match.CmdHash] {
+			ret = append(ret, match)
+		}
+	}
+
+	return ret, nil
+}
+
+// indexRun stores the output of a run so that it can be searched
+func (a *App) indexRun(sc ScheduledCommand) {
+
+	if err := a.Index.AddRun(sc, a.Settings.MaxStoredOutputs); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to store the output of run %v: %v\n", sc.RunID, err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -20,45 +19,43 @@ func (a *App) HandleSelect(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
 		return
 	}
 
-	// Select the Command, otherwise, if the Command hash cannot be found, return error 400
-	selectedCmd, cerr := a.SelectCmd(variables.CmdHash)
+	// Select the Command, otherwise, if the Command hash cannot be found, return error 404
+	selectedCmd, cerr := a.SelectUserCmd(user, variables.CmdHash)
 
-	if cerr != nil {
-		a.DmnLogFile.Log.Println("Unable to select Command")
-		w.WriteHeader(http.StatusBadRequest)
+	if a.writeResolveError(w, cerr) {
 		return
 	}
 
-	if selectedCmd.CmdHash == "" {
-		a.DmnLogFile.Log.Println("Invalid hash")
-		w.WriteHeader(http.StatusBadRequest)
+	if cerr != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", cerr)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-
 	out, err := json.Marshal(selectedCmd)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
 		return
 	}
 
 	io.WriteString(w, string(out))
 }
 
-// SelectCmd returns a Command
+// SelectCmd returns the Command that value refers to, either by its full hash or ID or
+// by a prefix of at least MinPrefixLength characters. ErrCommandNotFound is returned if no
+// Command matches, and an AmbiguousPrefixError if more than one does.
 func (a *App) SelectCmd(value string) (Command, error) {
 
 	a.DmnLogFile.Log.Println("Selecting " + value)
@@ -69,11 +66,11 @@ func (a *App) SelectCmd(value string) (Command, error) {
 		return Command{}, error
 	}
 
-	for _, cmd := range cmds {
-		if strings.Index(cmd.CmdHash, value) == 0 {
-			return cmd, nil
-		}
+	index, err := resolveCmd(cmds, value)
+
+	if err != nil {
+		return Command{}, err
 	}
 
-	return Command{}, nil
+	return cmds[index], nil
 }
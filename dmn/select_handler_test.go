@@ -33,7 +33,7 @@ func TestSelectHandler(t *testing.T) {
 		t.Errorf("Unable to save command")
 	}
 
-	// Select the command. The hash is computed from the command string, so this is a well known constant.
+	// Select the command by the hash that was assigned when it was created
 	cmd, err = app.SelectCmd(expectedCommandHash)
 
 	if err != nil {
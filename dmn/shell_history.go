@@ -0,0 +1,241 @@
+package dmn
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shell names a shell whose history file can be imported
+type Shell string
+
+const (
+	// Bash reads ~/.bash_history. Timestamps written with HISTTIMEFORMAT are supported.
+	Bash Shell = "bash"
+
+	// Zsh reads ~/.zsh_history, with or without extended history timestamps
+	Zsh Shell = "zsh"
+)
+
+// DefaultHistoryBlocklist lists the commands that are too trivial to import
+var DefaultHistoryBlocklist = []string{"ls", "ll", "cd", "pwd", "clear", "exit", "history", "fg", "bg", "jobs"}
+
+// zshExtendedHistory matches a line of a zsh history file written with EXTENDED_HISTORY,
+// such as ": 1609459200:0;make test"
+var zshExtendedHistory = regexp.MustCompile(`^: *(\d+):\d+;(.*)$`)
+
+// bashTimestamp matches the comment that bash writes before a command when HISTTIMEFORMAT is set
+var bashTimestamp = regexp.MustCompile(`^#(\d+)$`)
+
+// ShellHistoryEntry represents a command in a shell history file. Time is only set if the
+// history file has timestamps.
+type ShellHistoryEntry struct {
+	CmdString string
+	Time      *time.Time
+}
+
+// HistoryCandidate represents a command from a shell history file that could be saved.
+// Count is how many times it appears in the history file and LastUsed the last time it
+// was run, if the history file has timestamps.
+type HistoryCandidate struct {
+	Command  Command    `json:"command"`
+	Count    int        `json:"count"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// ParseShell checks that shell is a supported shell
+func ParseShell(shell string) (Shell, error) {
+
+	switch Shell(shell) {
+	case Bash, Zsh:
+		return Shell(shell), nil
+	}
+
+	return "", errors.New("invalid shell: " + shell)
+}
+
+// HistoryPath returns the default history file of the shell
+func (s Shell) HistoryPath() (string, error) {
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "."+string(s)+"_history"), nil
+}
+
+// unmetafy decodes the bytes that zsh escapes in its history file. zsh writes the bytes
+// that it uses internally, which are found in UTF-8 characters, as 0x83 followed by the
+// byte XOR 32.
+func unmetafy(data []byte) []byte {
+
+	if bytes.IndexByte(data, 0x83) < 0 {
+		return data
+	}
+
+	ret := make([]byte, 0, len(data))
+
+	for i := 0; i < len(data); i++ {
+		if data[i] == 0x83 && i+1 < len(data) {
+			i++
+			ret = append(ret, data[i]^32)
+			continue
+		}
+
+		ret = append(ret, data[i])
+	}
+
+	return ret
+}
+
+// ParseShellHistory reads the commands in a shell history file, oldest first. Multi-line
+// commands in zsh history files, where each line but the last ends with a backslash, are
+// joined.
+func ParseShellHistory(data []byte, shell Shell) ([]ShellHistoryEntry, error) {
+
+	if shell == Zsh {
+		data = unmetafy(data)
+	}
+
+	var (
+		entries []ShellHistoryEntry
+		pending *ShellHistoryEntry
+		stamp   *time.Time
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// A line of a multi-line command
+		if pending != nil {
+			if strings.HasSuffix(line, "\\") {
+				pending.CmdString += "\n" + strings.TrimSuffix(line, "\\")
+				continue
+			}
+
+			pending.CmdString += "\n" + line
+			entries = append(entries, *pending)
+			pending = nil
+			continue
+		}
+
+		entry := ShellHistoryEntry{CmdString: line}
+
+		switch shell {
+		case Zsh:
+			if m := zshExtendedHistory.FindStringSubmatch(line); m != nil {
+				seconds, _ := strconv.ParseInt(m[1], 10, 64)
+				t := time.Unix(seconds, 0)
+				entry = ShellHistoryEntry{CmdString: m[2], Time: &t}
+			}
+
+			if strings.HasSuffix(entry.CmdString, "\\") {
+				entry.CmdString = strings.TrimSuffix(entry.CmdString, "\\")
+				pending = &entry
+				continue
+			}
+		case Bash:
+			if m := bashTimestamp.FindStringSubmatch(line); m != nil {
+				seconds, _ := strconv.ParseInt(m[1], 10, 64)
+				t := time.Unix(seconds, 0)
+				stamp = &t
+				continue
+			}
+
+			entry.Time = stamp
+			stamp = nil
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if pending != nil {
+		entries = append(entries, *pending)
+	}
+
+	return entries, scanner.Err()
+}
+
+// blocked returns true if the command is one of the commands in the blocklist, with or
+// without arguments. An entry in the blocklist can have arguments of its own, such as
+// "git status".
+func blocked(cmdString string, blocklist []string) bool {
+
+	for _, entry := range blocklist {
+		entry = strings.TrimSpace(entry)
+
+		if entry != "" && (cmdString == entry || strings.HasPrefix(cmdString, entry+" ")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HistoryCandidates turns the commands of a shell history file into Commands in the
+// working directory. Commands in the blocklist and commands that are already saved, with
+// the same command string or the hash that was derived from it, are left out, and
+// commands that appear more than once are only returned once. The most used commands
+// come first.
+func HistoryCandidates(entries []ShellHistoryEntry, saved []Command, blocklist []string, workingDirectory string, shell Shell) []HistoryCandidate {
+
+	known := make(map[string]bool)
+
+	for _, cmd := range saved {
+		known[cmd.CmdString] = true
+		known[cmd.CmdHash] = true
+	}
+
+	candidates := make(map[string]*HistoryCandidate)
+	var order []string
+
+	for _, entry := range entries {
+		cmdString := strings.TrimSpace(entry.CmdString)
+
+		if cmdString == "" || blocked(cmdString, blocklist) || known[cmdString] || known[legacyHash(cmdString)] {
+			continue
+		}
+
+		candidate, ok := candidates[cmdString]
+
+		if !ok {
+			var cmd Command
+			cmd.Set(cmdString, "", workingDirectory)
+			cmd.Tags = []string{string(shell)}
+
+			candidate = &HistoryCandidate{Command: cmd}
+			candidates[cmdString] = candidate
+			order = append(order, cmdString)
+		}
+
+		candidate.Count++
+
+		if entry.Time != nil && (candidate.LastUsed == nil || entry.Time.After(*candidate.LastUsed)) {
+			candidate.LastUsed = entry.Time
+		}
+	}
+
+	ret := []HistoryCandidate{}
+
+	for _, cmdString := range order {
+		ret = append(ret, *candidates[cmdString])
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Count > ret[j].Count
+	})
+
+	return ret
+}
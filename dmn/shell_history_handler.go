@@ -0,0 +1,172 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ShellHistoryResult represents the Commands found in a shell history file. Saved is
+// only set when the candidates were saved.
+type ShellHistoryResult struct {
+	Candidates []HistoryCandidate `json:"candidates"`
+	Saved      []Command          `json:"saved"`
+}
+
+// HandleImportShellHistory imports the commands in a bash or zsh history file. The history
+// file is the body of the request, or the history file of the shell in the home directory
+// if the body is empty. The candidates are returned for review unless the query parameter
+// save is true, in which case they are saved as well. The query parameter dir sets the
+// working directory of the Commands, which defaults to the home directory, and block adds
+// commands to the blocklist in the configuration.
+func (a *App) HandleImportShellHistory(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	shell, err := ParseShell(variables.Shell)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid shell", err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxImportSize+1))
+
+	if err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to read history file", err)
+		return
+	}
+
+	if len(data) > MaxImportSize {
+		a.DmnLogFile.Log.Println("History file is too large to import")
+		writeError(w, http.StatusRequestEntityTooLarge, "history file is too large to import", nil)
+		return
+	}
+
+	result, err := a.ImportShellHistory(shell, data, r.URL.Query())
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to import shell history", err)
+		return
+	}
+
+	// Only saving changes the library
+	if len(result.Saved) > 0 {
+		a.audit(r, user, AuditEntry{Action: AuditImport, Detail: fmt.Sprintf("%v history: %v saved", shell, len(result.Saved))})
+	}
+
+	out, err := json.Marshal(result)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// ImportShellHistory finds the candidates in a shell history file, see HistoryCandidates,
+// and saves them with SaveCmd if the query parameter save is true. If data is empty the
+// history file of the shell is read.
+func (a *App) ImportShellHistory(shell Shell, data []byte, query url.Values) (ShellHistoryResult, error) {
+
+	result := ShellHistoryResult{Candidates: []HistoryCandidate{}, Saved: []Command{}}
+
+	save := false
+
+	if value := query.Get("save"); value != "" {
+		b, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return result, errors.New("invalid save: " + value)
+		}
+
+		save = b
+	}
+
+	dir := query.Get("dir")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return result, err
+		}
+
+		dir = home
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return result, errors.New("invalid working directory: " + dir)
+	}
+
+	if len(data) == 0 {
+		path, err := shell.HistoryPath()
+
+		if err != nil {
+			return result, err
+		}
+
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return result, err
+		}
+	}
+
+	entries, err := ParseShellHistory(data, shell)
+
+	if err != nil {
+		return result, err
+	}
+
+	saved, err := a.History.ReadCmds()
+
+	if err != nil {
+		return result, err
+	}
+
+	blocklist := append(append([]string{}, a.Settings.HistoryBlocklist...), query["block"]...)
+
+	result.Candidates = HistoryCandidates(entries, saved, blocklist, dir, shell)
+
+	a.DmnLogFile.Log.Printf("Found %v new commands in %v commands of %v history\n", len(result.Candidates), len(entries), shell)
+
+	if !save {
+		return result, nil
+	}
+
+	for _, candidate := range result.Candidates {
+		if a.SaveCmd(candidate.Command) {
+			result.Saved = append(result.Saved, candidate.Command)
+		} else {
+			a.DmnLogFile.Log.Printf("Unable to save %v\n", candidate.Command.CmdString)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package dmn
+
+import (
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestParseShellHistory(t *testing.T) {
+
+	zsh := ": 1609459200:0;make test\n: 1609459260:3;for f in *; do\\\n  echo $f\\\ndone\n: 1609459300:0;caf\xc3\x83\x89\nplain command\n"
+
+	entries, err := ParseShellHistory([]byte(zsh), Zsh)
+
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("Unexpected entries: %v: %v", entries, err)
+	}
+
+	if entries[0].CmdString != "make test" || entries[0].Time == nil || entries[0].Time.Unix() != 1609459200 {
+		t.Errorf("Unexpected entry: %v", entries[0])
+	}
+
+	if entries[1].CmdString != "for f in *; do\n  echo $f\ndone" {
+		t.Errorf("Multi-line command was not joined: %q", entries[1].CmdString)
+	}
+
+	if entries[2].CmdString != "café" {
+		t.Errorf("Metafied bytes were not decoded: %q", entries[2].CmdString)
+	}
+
+	if entries[3].CmdString != "plain command" || entries[3].Time != nil {
+		t.Errorf("Unexpected entry: %v", entries[3])
+	}
+
+	bash := "#1609459200\nmake test\nls -la\n"
+
+	entries, err = ParseShellHistory([]byte(bash), Bash)
+
+	if err != nil || len(entries) != 2 || entries[0].Time == nil || entries[1].Time != nil {
+		t.Fatalf("Unexpected entries: %v: %v", entries, err)
+	}
+}
+
+func TestHistoryCandidates(t *testing.T) {
+
+	var saved Command
+	saved.Set("make build", "build", "/")
+
+	legacy := Command{CmdString: "go vet ./...", CmdHash: legacyHash("go vet ./...")}
+
+	entries := []ShellHistoryEntry{
+		{CmdString: "make test"},
+		{CmdString: "ls -la"},
+		{CmdString: "make build"},
+		{CmdString: "go vet ./..."},
+		{CmdString: "git status -s"},
+		{CmdString: "docker ps"},
+		{CmdString: "make test"},
+	}
+
+	candidates := HistoryCandidates(entries, []Command{saved, legacy}, append(append([]string{}, DefaultHistoryBlocklist...), "git status"), "/", Bash)
+
+	if len(candidates) != 2 || candidates[0].Command.CmdString != "make test" || candidates[0].Count != 2 || candidates[1].Command.CmdString != "docker ps" {
+		t.Fatalf("Unexpected candidates: %v", candidates)
+	}
+
+	if len(candidates[0].Command.Tags) != 1 || candidates[0].Command.Tags[0] != "bash" {
+		t.Errorf("Candidate was not tagged with the shell: %v", candidates[0].Command.Tags)
+	}
+}
+
+func TestImportShellHistory(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	wd, _ := os.Getwd()
+
+	history := []byte(": 1609459200:0;make test\n: 1609459201:0;cd /tmp\n")
+
+	result, err := app.ImportShellHistory(Zsh, history, url.Values{"dir": {wd}})
+
+	if err != nil || len(result.Candidates) != 1 || len(result.Saved) != 0 {
+		t.Fatalf("Unexpected result: %+v: %v", result, err)
+	}
+
+	result, err = app.ImportShellHistory(Zsh, history, url.Values{"dir": {wd}, "save": {"true"}})
+
+	if err != nil || len(result.Saved) != 1 {
+		t.Fatalf("Unable to save candidates: %+v: %v", result, err)
+	}
+
+	// Saved commands are not candidates any more
+	result, _ = app.ImportShellHistory(Zsh, history, url.Values{"dir": {wd}})
+
+	if len(result.Candidates) != 0 {
+		t.Errorf("Saved command was a candidate again: %v", result.Candidates)
+	}
+
+	if _, err := app.ImportShellHistory(Zsh, history, url.Values{"dir": {"/does/not/exist"}}); err == nil {
+		t.Errorf("Accepted a working directory that does not exist")
+	}
+}
@@ -26,29 +26,33 @@ func (a *App) HandleShow(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ViewCommands)
+
+	if !ok {
 		return
 	}
 
-	// Select the Command, otherwise, if the Command hash cannot be found, return error 400
-	selectedCmd, cerr := a.SelectCmd(variables.CmdHash)
+	// Select the Command, otherwise, if the Command hash cannot be found, return error 404
+	selectedCmd, cerr := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, cerr) {
+		return
+	}
 
 	if cerr != nil {
-		a.DmnLogFile.Log.Println("Unable to select Command")
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", cerr)
 		return
 	}
 
 	if selectedCmd.CmdHash == "" {
 		a.DmnLogFile.Log.Println("Invalid hash")
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusNotFound, ErrCommandNotFound.Error(), nil)
 		return
 	}
 
@@ -80,12 +84,10 @@ func (a *App) HandleShow(w http.ResponseWriter, r *http.Request) {
 		ret = selectedCmd.CmdString
 	}
 
-	w.WriteHeader(http.StatusOK)
-
 	out, err := json.Marshal(ret)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
 		return
 	}
 
@@ -17,34 +17,30 @@ func (a *App) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	err := variables.GetVariablesFromRequestVars(vars)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeVariablesError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	// Check if the secret we passed in is valid, otherwise, return error 400
-	if !a.Secret.Valid(variables.Secret) {
-		a.DmnLogFile.Log.Println("Bad secret!")
-		w.WriteHeader(http.StatusBadRequest)
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	if _, ok := a.authorize(w, r, variables, ViewCommands); !ok {
 		return
 	}
 
-	// Select the Command, otherwise, if the Command hash cannot be found, return error 400
+	// Get the status of the Commands, otherwise return error 500
 	status, cerr := a.StatusCmd()
 
 	if cerr != nil {
-		a.DmnLogFile.Log.Println("Unable to get status")
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to get status", cerr)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-
 	out, err := json.Marshal(status)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
 		return
 	}
 
@@ -0,0 +1,238 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SyncResult lists the changes that synchronising the library made to the history file
+type SyncResult struct {
+	Added   []Command `json:"added"`
+	Updated []Command `json:"updated"`
+	Deleted []Command `json:"deleted"`
+}
+
+// syncConflictDetails are the details of the error returned when Commands were changed
+// both locally and in the remote
+type syncConflictDetails struct {
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// HandleSync synchronises the command library with its git repository. If Commands were
+// changed both locally and in the remote, status 409 is returned with the conflicts in
+// the details of the error and nothing is changed. The query parameter resolve set to ours or theirs settles them.
+func (a *App) HandleSync(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	result, err := a.SyncLibrary(r.URL.Query().Get("resolve"))
+
+	if err != nil {
+		var conflict *SyncConflictError
+
+		if errors.As(err, &conflict) {
+			a.DmnLogFile.Log.Printf("Unable to synchronise library: %v\n", err)
+			writeError(w, http.StatusConflict, err.Error(), syncConflictDetails{Conflicts: conflict.Conflicts})
+			return
+		}
+
+		// The library is not configured (409), or the remote failed
+		a.writeFailure(w, http.StatusBadGateway, "Unable to synchronise library", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditSync, Detail: fmt.Sprintf("%v added, %v updated, %v deleted", len(result.Added), len(result.Updated), len(result.Deleted))})
+
+	out, err := json.Marshal(result)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// InitLibrary checks out the library repository if synchronisation is enabled in the
+// configuration
+func (a *App) InitLibrary() {
+
+	a.Library.Configure(a.Settings.Sync)
+
+	if !a.Library.Enabled() {
+		return
+	}
+
+	cmds, err := a.History.ReadCmds()
+
+	if err == nil {
+		err = a.Library.Init(sharedCmds(cmds))
+	}
+
+	if err != nil {
+		a.DmnLogFile.Log.Printf("Unable to initialize library repository: %v\n", err)
+	}
+}
+
+// SyncLibrary pulls the changes to the library repository, pushes the local changes, and
+// makes the team library in the history file match the library repository. Commands are
+// matched by ID. Commands that are not shared are never pushed.
+func (a *App) SyncLibrary(resolve string) (SyncResult, error) {
+
+	result := SyncResult{Added: []Command{}, Updated: []Command{}, Deleted: []Command{}}
+
+	local, err := a.History.ReadCmds()
+
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	err = a.Library.Sync(resolve, sharedCmds(local), func(library []LibraryCommand, deleted map[string]bool) error {
+		return a.History.Modify(func(cmds []Command) ([]Command, error) {
+			return applyLibrary(cmds, library, deleted, &result), nil
+		})
+	})
+
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	a.DmnLogFile.Log.Printf("Synchronised library: %v added, %v updated, %v deleted\n", len(result.Added), len(result.Updated), len(result.Deleted))
+
+	return result, nil
+}
+
+// applyLibrary makes the shared Commands match the library and records the changes in
+// result. A shared Command that is not in the library is only deleted if its file was
+// deleted, since it may have been saved after the library was read. Commands that are not
+// shared are left alone, unless the library has a Command with the same ID.
+func applyLibrary(cmds []Command, library []LibraryCommand, deleted map[string]bool, result *SyncResult) []Command {
+
+	byID := make(map[string]LibraryCommand)
+
+	for _, lc := range library {
+		byID[lc.ID] = lc
+	}
+
+	now := time.Now()
+	kept := []Command{}
+
+	for _, cmd := range cmds {
+		lc, ok := byID[cmd.ID]
+
+		if !ok && cmd.Shared && deleted[cmd.ID] {
+			result.Deleted = append(result.Deleted, cmd)
+			continue
+		}
+
+		if !ok {
+			kept = append(kept, cmd)
+			continue
+		}
+
+		delete(byID, cmd.ID)
+
+		if lc.differsFrom(cmd) {
+			lc.applyTo(&cmd)
+			cmd.UpdatedAt = now
+			result.Updated = append(result.Updated, cmd)
+		}
+
+		kept = append(kept, cmd)
+	}
+
+	var added []LibraryCommand
+
+	for _, lc := range byID {
+		added = append(added, lc)
+	}
+
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].ID < added[j].ID
+	})
+
+	for _, lc := range added {
+		var cmd Command
+		cmd.Set(lc.CmdString, lc.Description, lc.WorkingDirectory)
+		cmd.ID = lc.ID
+		cmd.CmdHash = hashFromID(lc.ID)
+		lc.applyTo(&cmd)
+
+		kept = append(kept, cmd)
+		result.Added = append(result.Added, cmd)
+	}
+
+	return kept
+}
+
+// sharedCmds returns the Commands in the team library
+func sharedCmds(cmds []Command) []Command {
+
+	ret := []Command{}
+
+	for _, cmd := range cmds {
+		if cmd.Shared {
+			ret = append(ret, cmd)
+		}
+	}
+
+	return ret
+}
+
+// syncCmd commits a new or changed shared Command to the library repository if
+// synchronisation is enabled. A Command that is not shared is removed from the library
+// repository, in case it was shared before. Failing to commit is logged but does not fail
+// the change to the history file.
+func (a *App) syncCmd(cmd Command, message string) {
+
+	if !a.Library.Enabled() {
+		return
+	}
+
+	if !cmd.Shared {
+		a.unsyncCmd(cmd)
+		return
+	}
+
+	if err := a.Library.SaveCmd(cmd, message+" "+cmd.CmdHash+": "+cmd.CmdString); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to commit command %v: %v\n", cmd.CmdHash, err)
+	}
+}
+
+// unsyncCmd commits the deletion of a Command to the library repository if
+// synchronisation is enabled
+func (a *App) unsyncCmd(cmd Command) {
+
+	if !a.Library.Enabled() {
+		return
+	}
+
+	if err := a.Library.DeleteCmd(cmd, "Delete "+cmd.CmdHash+": "+cmd.CmdString); err != nil {
+		a.DmnLogFile.Log.Printf("Unable to commit the deletion of command %v: %v\n", cmd.CmdHash, err)
+	}
+}
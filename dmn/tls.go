@@ -0,0 +1,221 @@
+package dmn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// The self-signed certificate created when TLS is enabled without a certificate
+	recmdCertFile = "recmd_cert.pem"
+
+	// The private key of the self-signed certificate
+	recmdKeyFile = "recmd_key.pem"
+
+	// How long the self-signed certificate is valid
+	selfSignedValidity = 365 * 24 * time.Hour
+)
+
+// GenerateSelfSignedCert creates a self-signed certificate for localhost and the host name
+// of the machine, and writes it and its private key in PEM format. Only the user running
+// the daemon can read the key.
+func GenerateSelfSignedCert(certPath string, keyPath string) error {
+	return generateCert(certPath, keyPath, time.Now().Add(selfSignedValidity))
+}
+
+// generateCert creates a self-signed certificate that is valid until notAfter. It is a
+// server certificate only, so it can't be used to sign other certificates.
+func generateCert(certPath string, keyPath string, notAfter time.Time) error {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"recmd-dmn"}, CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if host, err := os.Hostname(); err == nil && host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), os.FileMode(0600)); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), os.FileMode(0644))
+}
+
+// certExpired returns whether the certificate in a PEM file is no longer valid. A file
+// that doesn't exist counts as expired.
+func certExpired(certPath string) (bool, error) {
+
+	data, err := ioutil.ReadFile(certPath)
+
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return false, errors.New("tls: no certificate found in " + certPath)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+
+	if err != nil {
+		return false, err
+	}
+
+	return time.Now().After(cert.NotAfter), nil
+}
+
+// ServerConfig returns the TLS configuration of the server. Relative paths are resolved
+// against confDir, and a self-signed certificate is created there on first start if no
+// certificate is configured. It is created again once it has expired.
+func (c TLSConfig) ServerConfig(confDir string) (*tls.Config, error) {
+
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(confDir, path)
+	}
+
+	certPath, keyPath := resolve(c.CertFile), resolve(c.KeyFile)
+
+	if (certPath == "") != (keyPath == "") {
+		return nil, errors.New("tls: certFile and keyFile must be set together")
+	}
+
+	if certPath == "" {
+		certPath = filepath.Join(confDir, recmdCertFile)
+		keyPath = filepath.Join(confDir, recmdKeyFile)
+
+		expired, err := certExpired(certPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if expired {
+			if err := GenerateSelfSignedCert(certPath, keyPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCAFile == "" {
+		if c.RequireClientCert {
+			return nil, errors.New("tls: requireClientCert needs clientCAFile")
+		}
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(resolve(c.ClientCAFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("tls: no certificates found in clientCAFile")
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+
+	if c.RequireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// clientCertName returns the common name of the verified client certificate of a request,
+// if there is one
+func clientCertName(r *http.Request) (string, bool) {
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+
+	return name, name != ""
+}
+
+// authenticateRequest returns the user that a request belongs to. A verified client
+// certificate whose common name is a user authenticates as that user; otherwise the
+// secret or token in the request is used.
+func (a *App) authenticateRequest(r *http.Request, secret string) (User, bool) {
+
+	if name, ok := clientCertName(r); ok {
+		if user, err := a.Users.GetUser(name); err == nil {
+			return user, true
+		}
+
+		a.DmnLogFile.Log.Printf("Client certificate of unknown user %v\n", name)
+	}
+
+	return a.Authenticate(secret)
+}
@@ -0,0 +1,206 @@
+package dmn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// testCA is a certificate authority that issues certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) testCA {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "recmd test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for a server or a client with a common name
+func (ca testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "recmd")
+	defer os.RemoveAll(dir)
+
+	config, err := TLSConfig{Enabled: true}.ServerConfig(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ClientAuth != tls.NoClientCert {
+		t.Errorf("Expected no client certificates without a CA")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, recmdKeyFile))
+
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key to be created with mode 0600: %v", err)
+	}
+
+	// The certificate is created once
+	again, _ := TLSConfig{Enabled: true}.ServerConfig(dir)
+
+	if string(again.Certificates[0].Certificate[0]) != string(config.Certificates[0].Certificate[0]) {
+		t.Errorf("Expected the certificate to be kept")
+	}
+
+	cert, _ := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Errorf("Expected the certificate not to be able to sign certificates")
+	}
+
+	// An expired certificate is created again
+	if err := generateCert(filepath.Join(dir, recmdCertFile), filepath.Join(dir, recmdKeyFile), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := TLSConfig{Enabled: true}.ServerConfig(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert, _ := x509.ParseCertificate(renewed.Certificates[0].Certificate[0]); !cert.NotAfter.After(time.Now()) {
+		t.Errorf("Expected the expired certificate to be replaced but it expires %v", cert.NotAfter)
+	}
+
+	if _, err := (TLSConfig{CertFile: "cert.pem"}).ServerConfig(dir); err == nil {
+		t.Errorf("Expected a certificate without a key to be rejected")
+	}
+
+	if _, err := (TLSConfig{RequireClientCert: true}).ServerConfig(dir); err == nil {
+		t.Errorf("Expected requireClientCert without a CA to be rejected")
+	}
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	if _, err := app.Users.AddUser("alice", false, Viewer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ca := newTestCA(t)
+	caPath := filepath.Join(TestConfigDir, "ca.pem")
+
+	if err := ioutil.WriteFile(caPath, ca.pem, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := TLSConfig{Enabled: true, ClientCAFile: "ca.pem"}.ServerConfig(TestConfigDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Certificates = []tls.Certificate{ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/secret/{secret}/list", app.HandleList)
+
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(secret string, certs ...tls.Certificate) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+
+		response, err := client.Get(server.URL + "/secret/" + base64.StdEncoding.EncodeToString([]byte(secret)) + "/list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	if code := get("-", ca.issue(t, "alice", x509.ExtKeyUsageClientAuth)); code != http.StatusOK {
+		t.Errorf("Expected alice to be authenticated by a certificate but got %v", code)
+	}
+
+	if code := get("-", ca.issue(t, "mallory", x509.ExtKeyUsageClientAuth)); code != http.StatusUnauthorized {
+		t.Errorf("Expected a certificate of an unknown user to be rejected but got %v", code)
+	}
+
+	if code := get("-"); code != http.StatusUnauthorized {
+		t.Errorf("Expected a request without a certificate or secret to be rejected but got %v", code)
+	}
+
+	if code := get(app.Secret.Value); code != http.StatusOK {
+		t.Errorf("Expected the secret to still be accepted but got %v", code)
+	}
+}
@@ -0,0 +1,213 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CommandUpdate represents the fields of a Command to change. Fields that are nil are
+// left as they are.
+type CommandUpdate struct {
+	CmdString        *string   `json:"commandString,omitempty"`
+	Description      *string   `json:"description,omitempty"`
+	WorkingDirectory *string   `json:"workingDirectory,omitempty"`
+	Tags             *[]string `json:"tags,omitempty"`
+	Folder           *string   `json:"folder,omitempty"`
+	Owner            *string   `json:"owner,omitempty"`
+	Shared           *bool     `json:"shared,omitempty"`
+}
+
+// ErrDuplicateCommand is returned when an update would give a Command the same command
+// string and working directory as another Command
+var ErrDuplicateCommand = errors.New("another command has the same command string and working directory")
+
+// HandleUpdate updates a Command in place. The update is passed in as base64 encoded JSON.
+// Status 409 is returned if another Command already has the same command string and
+// working directory. Only admins can give a Command to another user.
+func (a *App) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	user, ok := a.authorize(w, r, variables, EditCommands)
+
+	if !ok {
+		return
+	}
+
+	var update CommandUpdate
+
+	if err := json.Unmarshal([]byte(variables.Update), &update); err != nil {
+		a.writeFailure(w, http.StatusBadRequest, "Unable to parse update", err)
+		return
+	}
+
+	if update.Owner != nil && *update.Owner != user.Name && !user.Admin {
+		a.DmnLogFile.Log.Printf("User %v cannot give commands to %v\n", user.Name, *update.Owner)
+		writeError(w, http.StatusForbidden, fmt.Sprintf("user %v cannot give commands to %v", user.Name, *update.Owner), nil)
+		return
+	}
+
+	// Commands in the libraries of other users are not found
+	selectedCmd, err := a.SelectUserCmd(user, variables.CmdHash)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to select command", err)
+		return
+	}
+
+	if !a.authorizeCmd(w, r, user, EditCommands, selectedCmd) {
+		return
+	}
+
+	updatedCmd, err := a.UpdateCmd(selectedCmd.CmdHash, update)
+
+	if a.writeResolveError(w, err) {
+		return
+	}
+
+	// A duplicate Command is a conflict, see errorStatus
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Unable to update command", err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUpdate, CmdHash: updatedCmd.CmdHash, Before: &selectedCmd, After: &updatedCmd})
+
+	out, err := json.Marshal(updatedCmd)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// UpdateCmd changes the fields of a Command in the history file. The hash of a Command
+// is its identity, so it is kept when the command string changes. This way schedules and
+// pipelines that refer to the Command keep working, and so does its Duration.
+func (a *App) UpdateCmd(value string, update CommandUpdate) (Command, error) {
+
+	selectedCmd, err := a.SelectCmd(value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	if update.CmdString != nil && strings.TrimSpace(*update.CmdString) == "" {
+		return Command{}, errors.New("command string must not be empty")
+	}
+
+	if update.WorkingDirectory != nil {
+		if _, err := os.Stat(*update.WorkingDirectory); os.IsNotExist(err) {
+			return Command{}, errors.New("invalid working directory: " + *update.WorkingDirectory)
+		}
+	}
+
+	if update.Folder != nil {
+		folder, err := normalizeFolder(*update.Folder)
+
+		if err != nil {
+			return Command{}, err
+		}
+
+		update.Folder = &folder
+	}
+
+	if update.Tags != nil {
+		tags := normalizeTags(*update.Tags)
+		update.Tags = &tags
+	}
+
+	apply := func(cmd *Command) {
+		if update.CmdString != nil {
+			cmd.CmdString = *update.CmdString
+		}
+		if update.Description != nil {
+			cmd.Description = *update.Description
+		}
+		if update.WorkingDirectory != nil {
+			cmd.WorkingDirectory = *update.WorkingDirectory
+		}
+		if update.Tags != nil {
+			cmd.Tags = *update.Tags
+		}
+		if update.Folder != nil {
+			cmd.Folder = *update.Folder
+		}
+		if update.Owner != nil {
+			cmd.Owner = *update.Owner
+		}
+		if update.Shared != nil {
+			cmd.Shared = *update.Shared
+		}
+	}
+
+	a.DmnLogFile.Log.Printf("Updating command %v\n", selectedCmd.CmdHash)
+
+	var updatedCmd Command
+
+	// The duplicate check and the update are done under the lock of the history file, so
+	// that Commands added or updated at the same time cannot become duplicates
+	err = a.History.Modify(func(cmds []Command) ([]Command, error) {
+
+		index := -1
+
+		for i := range cmds {
+			if cmds[i].CmdHash == selectedCmd.CmdHash {
+				index = i
+			}
+		}
+
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %v", ErrCommandNotFound, selectedCmd.CmdHash)
+		}
+
+		updated := cmds[index]
+		apply(&updated)
+
+		for _, cmd := range cmds {
+			if cmd.CmdHash != updated.CmdHash && updated.duplicates(cmd) {
+				return nil, ErrDuplicateCommand
+			}
+		}
+
+		updated.UpdatedAt = time.Now()
+		cmds[index] = updated
+		updatedCmd = updated
+
+		return cmds, nil
+	})
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	a.syncCmd(updatedCmd, "Update")
+
+	return updatedCmd, nil
+}
@@ -0,0 +1,131 @@
+package dmn
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUpdateCmd(t *testing.T) {
+
+	var app App
+
+	err := app.InitalizeTest()
+
+	if err != nil {
+		t.Errorf("Error initializing test %v", err)
+	}
+
+	var cmd Command
+	cmd.Set("ls -ltr", "lsit files", ".")
+	cmd.Duration = 42
+
+	var other Command
+	other.Set("pwd", "print working directory", ".")
+
+	if app.SaveCmd(cmd) != true || app.SaveCmd(other) != true {
+		t.Fatalf("Unable to save commands")
+	}
+
+	description := "list files"
+	cmdString := "ls -la"
+
+	updatedCmd, err := app.UpdateCmd(cmd.CmdHash, CommandUpdate{Description: &description, CmdString: &cmdString})
+
+	if err != nil {
+		t.Fatalf("Unable to update command: %v", err)
+	}
+
+	if updatedCmd.CmdHash != cmd.CmdHash || updatedCmd.Duration != 42 {
+		t.Errorf("The hash and duration should be kept: %v %v", updatedCmd.CmdHash, updatedCmd.Duration)
+	}
+
+	selectedCmd, _ := app.SelectCmd(cmd.CmdHash)
+
+	if selectedCmd.Description != description || selectedCmd.CmdString != cmdString || selectedCmd.WorkingDirectory != "." {
+		t.Errorf("Command was not updated: %v", selectedCmd)
+	}
+
+	// The updated command string can't be added again
+	var duplicate Command
+	duplicate.Set(cmdString, "duplicate", ".")
+
+	if app.SaveCmd(duplicate) {
+		t.Errorf("Added a command with the same command string")
+	}
+
+	cmdString = "pwd"
+
+	if _, err := app.UpdateCmd(cmd.CmdHash, CommandUpdate{CmdString: &cmdString}); err != ErrDuplicateCommand {
+		t.Errorf("Expected ErrDuplicateCommand but got %v", err)
+	}
+
+	workingDirectory := "does-not-exist"
+
+	if _, err := app.UpdateCmd(cmd.CmdHash, CommandUpdate{WorkingDirectory: &workingDirectory}); err == nil {
+		t.Errorf("Accepted an invalid working directory")
+	}
+
+	if _, err := app.History.UpdateCmd("ffff", func(cmd *Command) {}); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("Expected ErrCommandNotFound but got %v", err)
+	}
+}
+
+func TestConcurrentUpdatesToTheSameCommand(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	var cmds []Command
+
+	for i := 0; i < 20; i++ {
+		var cmd Command
+		cmd.Set(fmt.Sprintf("echo %v", i), "echo", ".")
+
+		if !app.SaveCmd(cmd) {
+			t.Fatalf("Unable to save command")
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	// Only one of the Commands can become "whoami"
+	cmdString := "whoami"
+	updated := make(chan error, len(cmds))
+
+	var wg sync.WaitGroup
+
+	start := make(chan struct{})
+
+	for _, cmd := range cmds {
+		wg.Add(1)
+		go func(cmd Command) {
+			defer wg.Done()
+			<-start
+			_, err := app.UpdateCmd(cmd.CmdHash, CommandUpdate{CmdString: &cmdString})
+			updated <- err
+		}(cmd)
+	}
+
+	close(start)
+	wg.Wait()
+	close(updated)
+
+	succeeded := 0
+
+	for err := range updated {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrDuplicateCommand) {
+			t.Errorf("Expected ErrDuplicateCommand but got %v", err)
+		}
+	}
+
+	if succeeded != 1 {
+		t.Errorf("Expected exactly one update to succeed but %v did", succeeded)
+	}
+}
@@ -0,0 +1,381 @@
+package dmn
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The users file
+	recmdUsersFile = "recmd_users.json"
+
+	// The prefix of user tokens, which tells them apart from the secret
+	tokenPrefix = "rcmd_"
+)
+
+var (
+	// ErrUserNotFound is returned when there is no user with a name
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrUserExists is returned when a user is added with a name that is taken
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrTokenNotFound is returned when a user has no token with an ID
+	ErrTokenNotFound = errors.New("token not found")
+
+	// ErrInvalidUserName is returned when a user is added with a name that cannot be used
+	ErrInvalidUserName = errors.New("invalid user name")
+)
+
+// validUserName matches the names that can be given to users
+var validUserName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// Token represents an API token of a user. Only the SHA256 hash of the token is kept;
+// the token itself is returned once, when it is created.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// User represents a user of the daemon. Commands owned by a user make up their own library,
+// and shared Commands make up the team library. Admins see every library and manage users.
+// Role decides what the user can do with the Commands they see, and if Scopes is set the
+// user can only run and edit Commands with one of those tags.
+type User struct {
+	Name   string   `json:"name"`
+	Admin  bool     `json:"admin"`
+	Role   Role     `json:"role,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	Tokens []Token  `json:"tokens"`
+}
+
+// secretUser returns the user that the secret authenticates as. This is the user running
+// the daemon, who owns the Commands saved before there were users.
+func secretUser() User {
+	return User{Name: defaultOwner(), Admin: true}
+}
+
+// CanSee returns true if the Command is in the user's library or the team library
+func (u User) CanSee(cmd Command) bool {
+	return u.Admin || cmd.Shared || cmd.Owner == u.Name
+}
+
+// Visible returns the Commands that the user can see
+func (u User) Visible(cmds []Command) []Command {
+
+	ret := []Command{}
+
+	for _, cmd := range cmds {
+		if u.CanSee(cmd) {
+			ret = append(ret, cmd)
+		}
+	}
+
+	return ret
+}
+
+// hashToken returns the hash of a token that is stored in the users file
+func hashToken(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// UserFile represents the file containing the users
+type UserFile struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Set sets the path to the users file
+func (f *UserFile) Set(path string) {
+	f.Path = filepath.Join(path, recmdUsersFile)
+}
+
+// WriteUsersToFile creates an empty users file if it doesn't exist
+func (f *UserFile) WriteUsersToFile() error {
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		return ioutil.WriteFile(f.Path, []byte(nil), os.FileMode(0600))
+	}
+
+	return nil
+}
+
+// ReadUsers reads the users file
+func (f *UserFile) ReadUsers() ([]User, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.read()
+}
+
+func (f *UserFile) read() ([]User, error) {
+
+	var users []User
+
+	data, err := ioutil.ReadFile(f.Path)
+
+	if err != nil {
+		return users, err
+	}
+
+	if len(data) == 0 {
+		return users, nil
+	}
+
+	err = json.Unmarshal(data, &users)
+
+	return users, err
+}
+
+func (f *UserFile) write(users []User) error {
+
+	data, err := json.MarshalIndent(users, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(f.Path, data, os.FileMode(0600))
+}
+
+// AddUser adds a user without tokens
+func (f *UserFile) AddUser(name string, admin bool, role Role, scopes []string) (User, error) {
+
+	if !validUserName.MatchString(name) {
+		return User{}, fmt.Errorf("%w: %v", ErrInvalidUserName, name)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	users, err := f.read()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, u := range users {
+		if u.Name == name {
+			return User{}, ErrUserExists
+		}
+	}
+
+	user := User{Name: name, Admin: admin, Role: role, Scopes: scopes, Tokens: []Token{}}
+
+	return user, f.write(append(users, user))
+}
+
+// SetRole changes the role and scopes of a user
+func (f *UserFile) SetRole(name string, role Role, scopes []string) (User, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	users, err := f.read()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	for index, u := range users {
+		if u.Name == name {
+			users[index].Role = role
+			users[index].Scopes = scopes
+			return users[index], f.write(users)
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+// DeleteUser removes a user and their tokens. The Commands of the user are kept.
+func (f *UserFile) DeleteUser(name string) (User, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	users, err := f.read()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	for index, u := range users {
+		if u.Name == name {
+			users = append(users[:index], users[index+1:]...)
+			return u, f.write(users)
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+// CreateToken gives a user a new token. It returns the Token and the token itself, which
+// cannot be recovered later.
+func (f *UserFile) CreateToken(name string, tokenName string) (Token, string, error) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	users, err := f.read()
+
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	for index, u := range users {
+		if u.Name == name {
+			secret := tokenPrefix + newID() + newID()
+
+			token := Token{ID: newID(), Name: tokenName, Hash: hashToken(secret), CreatedAt: time.Now()}
+			users[index].Tokens = append(users[index].Tokens, token)
+
+			return token, secret, f.write(users)
+		}
+	}
+
+	return Token{}, "", ErrUserNotFound
+}
+
+// RevokeToken removes a token of a user
+func (f *UserFile) RevokeToken(name string, id string) error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	users, err := f.read()
+
+	if err != nil {
+		return err
+	}
+
+	for index, u := range users {
+		if u.Name != name {
+			continue
+		}
+
+		for t, token := range u.Tokens {
+			if token.ID == id {
+				users[index].Tokens = append(u.Tokens[:t], u.Tokens[t+1:]...)
+				return f.write(users)
+			}
+		}
+
+		return ErrTokenNotFound
+	}
+
+	return ErrUserNotFound
+}
+
+// Authenticate returns the user that a token belongs to
+func (f *UserFile) Authenticate(token string) (User, bool) {
+
+	users, err := f.ReadUsers()
+
+	if err != nil {
+		return User{}, false
+	}
+
+	hash := []byte(hashToken(token))
+
+	for _, u := range users {
+		for _, t := range u.Tokens {
+			if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+				return u, true
+			}
+		}
+	}
+
+	return User{}, false
+}
+
+// GetUser returns the user with a name
+func (f *UserFile) GetUser(name string) (User, error) {
+
+	users, err := f.ReadUsers()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	for _, u := range users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+// Authenticate returns the user that a secret or token passed in a request belongs to.
+// The secret authenticates as the user running the daemon, who is an admin.
+func (a *App) Authenticate(secret string) (User, bool) {
+
+	if a.Secret.Valid(secret) {
+		return secretUser(), true
+	}
+
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return User{}, false
+	}
+
+	return a.Users.Authenticate(secret)
+}
+
+// hiddenCmds returns the hashes of the Commands that the user cannot see
+func (a *App) hiddenCmds(user User) (map[string]bool, error) {
+
+	cmds, err := a.History.ReadCmds()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := make(map[string]bool)
+
+	for _, cmd := range cmds {
+		if !user.CanSee(cmd) {
+			hidden[cmd.CmdHash] = true
+		}
+	}
+
+	return hidden, nil
+}
+
+// SelectUserCmd selects a Command like SelectCmd, among the Commands that the user can
+// see. Commands in the libraries of other users are not found.
+func (a *App) SelectUserCmd(user User, value string) (Command, error) {
+
+	cmds, err := a.History.ReadCmdHistoryFile()
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	cmds = user.Visible(cmds)
+
+	index, err := resolveCmd(cmds, value)
+
+	if err != nil {
+		return Command{}, err
+	}
+
+	return cmds[index], nil
+}
@@ -0,0 +1,407 @@
+package dmn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// tokenResponse is the body returned when a token is created. Token is only returned here.
+type tokenResponse struct {
+	User  string `json:"user"`
+	Info  Token  `json:"info"`
+	Token string `json:"token"`
+}
+
+// tokenOwner returns the user whose tokens are managed: the user in the user query
+// parameter if an admin asks for it, otherwise the user making the request
+func tokenOwner(user User, r *http.Request) (string, bool) {
+
+	name := r.URL.Query().Get("user")
+
+	if name == "" || name == user.Name {
+		return user.Name, true
+	}
+
+	return name, user.Admin
+}
+
+// writeUserError writes the error response for an error returned by the users file:
+// status 422 for a name that cannot be used, 404 or 409 as decided by errorStatus, or
+// 500 if the file could not be read or written
+func (a *App) writeUserError(w http.ResponseWriter, err error) {
+
+	status := http.StatusInternalServerError
+
+	if errors.Is(err, ErrInvalidUserName) {
+		status = http.StatusUnprocessableEntity
+	}
+
+	a.writeFailure(w, status, "Unable to update users", err)
+}
+
+// withoutHashes returns the users with the hashes of their tokens removed
+func withoutHashes(users []User) []User {
+
+	ret := []User{}
+
+	for _, u := range users {
+		tokens := []Token{}
+
+		for _, t := range u.Tokens {
+			t.Hash = ""
+			tokens = append(tokens, t)
+		}
+
+		u.Tokens = tokens
+		ret = append(ret, u)
+	}
+
+	return ret
+}
+
+// HandleUsers lists the users and their tokens. Only admins can list users.
+func (a *App) HandleUsers(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	if _, ok := a.authorize(w, r, variables, ManageUsers); !ok {
+		return
+	}
+
+	users, err := a.Users.ReadUsers()
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read users", err)
+		return
+	}
+
+	out, err := json.Marshal(withoutHashes(users))
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleAddUser adds a user. The user is an admin if the admin query parameter is true.
+// The role query parameter sets the role of the user, which defaults to editor, and the
+// scope query parameters the tags they are limited to. Only admins can add users.
+func (a *App) HandleAddUser(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	admin, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	role := Editor
+
+	if value := query.Get("role"); value != "" {
+		if role, err = ParseRole(value); err != nil {
+			a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid role", err)
+			return
+		}
+	}
+
+	a.DmnLogFile.Log.Printf("Adding user %v with role %v\n", variables.Name, role)
+
+	user, err := a.Users.AddUser(variables.Name, query.Get("admin") == "true", role, parseScopes(query["scope"]))
+
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+
+	a.audit(r, admin, AuditEntry{Action: AuditUser, Detail: fmt.Sprintf("add %v (%v)", user.Name, user.EffectiveRole())})
+
+	out, err := json.Marshal(user)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleSetRole changes the role of a user and the tags they are limited to, which are
+// passed in the scope query parameters. Without scopes the user is not limited. Only
+// admins can change roles.
+func (a *App) HandleSetRole(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	admin, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	role, err := ParseRole(variables.Role)
+
+	if err != nil {
+		a.writeFailure(w, http.StatusUnprocessableEntity, "Invalid role", err)
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Changing the role of %v to %v\n", variables.Name, role)
+
+	user, err := a.Users.SetRole(variables.Name, role, parseScopes(r.URL.Query()["scope"]))
+
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+
+	a.audit(r, admin, AuditEntry{Action: AuditUser, Detail: fmt.Sprintf("role %v %v %v", user.Name, role, strings.Join(user.Scopes, ","))})
+
+	out, err := json.Marshal(withoutHashes([]User{user})[0])
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleDeleteUser deletes a user and their tokens. The Commands in the library of the
+// user are kept. Only admins can delete users.
+func (a *App) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid and allowed, otherwise, return
+	// error 401 or 403
+	admin, ok := a.authorize(w, r, variables, ManageUsers)
+
+	if !ok {
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Deleting user %v\n", variables.Name)
+
+	user, err := a.Users.DeleteUser(variables.Name)
+
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+
+	a.audit(r, admin, AuditEntry{Action: AuditUser, Detail: "delete " + user.Name})
+
+	out, err := json.Marshal(withoutHashes([]User{user})[0])
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleTokens lists the tokens of the user. Admins can list the tokens of another user
+// with the user query parameter.
+func (a *App) HandleTokens(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid, otherwise, return error 401
+	user, ok := a.authenticateRequest(r, variables.Secret)
+
+	if !ok {
+		a.unauthorized(w)
+		return
+	}
+
+	name, ok := tokenOwner(user, r)
+
+	if !ok {
+		a.deny(w, r, user.Check(ManageUsers, nil))
+		return
+	}
+
+	users, err := a.Users.ReadUsers()
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to read users", err)
+		return
+	}
+
+	for _, u := range withoutHashes(users) {
+		if u.Name == name {
+			out, _ := json.Marshal(u.Tokens)
+			io.WriteString(w, string(out))
+			return
+		}
+	}
+
+	a.writeUserError(w, ErrUserNotFound)
+}
+
+// HandleAddToken creates a token for the user and returns it. The token cannot be
+// retrieved again. Admins can create a token for another user with the user query
+// parameter.
+func (a *App) HandleAddToken(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid, otherwise, return error 401
+	user, ok := a.authenticateRequest(r, variables.Secret)
+
+	if !ok {
+		a.unauthorized(w)
+		return
+	}
+
+	name, ok := tokenOwner(user, r)
+
+	if !ok {
+		a.deny(w, r, user.Check(ManageUsers, nil))
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Creating token %v for %v\n", variables.Name, name)
+
+	token, secret, err := a.Users.CreateToken(name, variables.Name)
+
+	if err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUser, Detail: fmt.Sprintf("token add %v %v", name, token.ID)})
+
+	token.Hash = ""
+
+	out, err := json.Marshal(tokenResponse{User: name, Info: token, Token: secret})
+
+	if err != nil {
+		a.writeFailure(w, http.StatusInternalServerError, "Unable to encode response", err)
+		return
+	}
+
+	io.WriteString(w, string(out))
+}
+
+// HandleDeleteToken revokes a token of the user. Admins can revoke the token of another
+// user with the user query parameter.
+func (a *App) HandleDeleteToken(w http.ResponseWriter, r *http.Request) {
+
+	// Get variables from the request
+	vars := mux.Vars(r)
+	var variables RequestVariable
+	err := variables.GetVariablesFromRequestVars(vars)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		writeVariablesError(w, err)
+		return
+	}
+
+	// Check if the secret or token we passed in is valid, otherwise, return error 401
+	user, ok := a.authenticateRequest(r, variables.Secret)
+
+	if !ok {
+		a.unauthorized(w)
+		return
+	}
+
+	name, ok := tokenOwner(user, r)
+
+	if !ok {
+		a.deny(w, r, user.Check(ManageUsers, nil))
+		return
+	}
+
+	a.DmnLogFile.Log.Printf("Revoking token %v of %v\n", variables.TokenID, name)
+
+	if err := a.Users.RevokeToken(name, variables.TokenID); err != nil {
+		a.writeUserError(w, err)
+		return
+	}
+
+	a.audit(r, user, AuditEntry{Action: AuditUser, Detail: fmt.Sprintf("token revoke %v %v", name, variables.TokenID)})
+
+	out, _ := json.Marshal("true")
+	io.WriteString(w, string(out))
+}
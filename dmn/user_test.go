@@ -0,0 +1,103 @@
+package dmn
+
+import (
+	"testing"
+)
+
+func TestUserTokens(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	if _, err := app.Users.AddUser("alice", false, Editor, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Users.AddUser("alice", false, Editor, nil); err != ErrUserExists {
+		t.Errorf("Expected ErrUserExists but got %v", err)
+	}
+
+	if _, err := app.Users.AddUser("../alice", false, Editor, nil); err == nil {
+		t.Errorf("Expected an invalid user name to be rejected")
+	}
+
+	token, secret, err := app.Users.CreateToken("alice", "laptop")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Hash == secret || token.Hash != hashToken(secret) {
+		t.Errorf("Expected the hash of the token to be kept")
+	}
+
+	user, ok := app.Authenticate(secret)
+
+	if !ok || user.Name != "alice" || user.Admin {
+		t.Errorf("Expected the token to authenticate alice but got %v", user)
+	}
+
+	if user, ok := app.Authenticate(app.Secret.Value); !ok || !user.Admin {
+		t.Errorf("Expected the secret to authenticate an admin")
+	}
+
+	if _, ok := app.Authenticate(tokenPrefix + "0123"); ok {
+		t.Errorf("Expected an unknown token to be rejected")
+	}
+
+	if err := app.Users.RevokeToken("alice", token.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := app.Authenticate(secret); ok {
+		t.Errorf("Expected a revoked token to be rejected")
+	}
+}
+
+func TestUserLibraries(t *testing.T) {
+
+	var app App
+
+	if err := app.InitalizeTest(); err != nil {
+		t.Fatalf("Error initializing test %v", err)
+	}
+
+	alice := User{Name: "alice"}
+	bob := User{Name: "bob"}
+
+	var own, team, other Command
+	own.Set("ls", "list files", ".")
+	own.Owner = "alice"
+	team.Set("pwd", "print working directory", ".")
+	team.Owner = "bob"
+	team.Shared = true
+	other.Set("df", "show disk usage", ".")
+	other.Owner = "bob"
+
+	app.History.OverwriteCmdHistoryFile([]Command{own, team, other})
+
+	if _, err := app.SelectUserCmd(alice, team.CmdHash); err != nil {
+		t.Errorf("Expected alice to see the team library: %v", err)
+	}
+
+	if _, err := app.SelectUserCmd(alice, other.CmdHash); err != ErrCommandNotFound {
+		t.Errorf("Expected ErrCommandNotFound but got %v", err)
+	}
+
+	if _, err := app.SelectUserCmd(bob, own.CmdHash); err != ErrCommandNotFound {
+		t.Errorf("Expected ErrCommandNotFound but got %v", err)
+	}
+
+	cmds, _ := app.History.ReadCmdHistoryFile()
+
+	if visible := alice.Visible(cmds); len(visible) != 2 {
+		t.Errorf("Expected alice to see 2 commands but got %v", len(visible))
+	}
+
+	if visible := secretUser().Visible(cmds); len(visible) != 3 {
+		t.Errorf("Expected the admin to see 3 commands but got %v", len(visible))
+	}
+}
@@ -1,7 +1,10 @@
 module github.com/tarof429/recmd-dmn
 
-go 1.15
+go 1.20
 
 replace github.com/tarof429/recmd-dmn => ./
 
-require github.com/gorilla/mux v1.8.0
+require (
+	github.com/gorilla/mux v1.8.0
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -27,6 +27,9 @@ func TestMain(m *testing.M) {
 
 	a.Router = mux.NewRouter()
 
+	// The tests make more requests than the rate limit allows
+	a.Settings.Limits.RequestsPerSecond = 0
+
 	a.InitializeRoutes()
 
 	a.CreateScheduler()
@@ -114,12 +117,12 @@ func TestListHandler(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, response.Code)
 
-		var ret string
+		var ret dmn.Command
 
 		json.Unmarshal(response.Body.Bytes(), &ret)
 
-		if ret != "true" {
-			t.Errorf("Unable to save command")
+		if ret.CmdHash == "" || ret.CmdString != params["{command}"] {
+			t.Errorf("Unable to save command, got %v", ret)
 		}
 	}()
 
@@ -163,12 +166,12 @@ func TestAddHandler(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, response.Code)
 
-		var ret string
+		var ret dmn.Command
 
 		json.Unmarshal(response.Body.Bytes(), &ret)
 
-		if ret != "true" {
-			t.Errorf("Unable to save command")
+		if ret.CmdHash == "" || ret.CmdString != params["{command}"] {
+			t.Errorf("Unable to save command, got %v", ret)
 		}
 	}()
 
@@ -294,12 +297,12 @@ func TestAdd2Items(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, response.Code)
 
-		var ret string
+		var ret dmn.Command
 
 		json.Unmarshal(response.Body.Bytes(), &ret)
 
-		if ret != "true" {
-			t.Errorf("Unable to save command")
+		if ret.CmdHash == "" || ret.CmdString != params["{command}"] {
+			t.Errorf("Unable to save command, got %v", ret)
 		}
 	}
 
@@ -330,11 +333,11 @@ func TestSelecthHandler(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, response.Code)
 
-		var ret string
+		var ret dmn.Command
 
 		json.Unmarshal(response.Body.Bytes(), &ret)
-		if ret != "true" {
-			t.Errorf("Unable to save command")
+		if ret.CmdHash == "" || ret.CmdString != params["{command}"] {
+			t.Errorf("Unable to save command, got %v", ret)
 		}
 	}
 
@@ -514,11 +517,11 @@ func TestShowHandler(t *testing.T) {
 
 		checkResponseCode(t, http.StatusOK, response.Code)
 
-		var ret string
+		var ret dmn.Command
 
 		json.Unmarshal(response.Body.Bytes(), &ret)
-		if ret != "true" {
-			t.Errorf("Unable to save command")
+		if ret.CmdHash == "" || ret.CmdString != params["{command}"] {
+			t.Errorf("Unable to save command, got %v", ret)
 		}
 	}
 
@@ -576,3 +579,544 @@ func TestShowHandler(t *testing.T) {
 
 	selectFunc(expectedHash)
 }
+
+func TestSelectHandlerPrefixResolution(t *testing.T) {
+
+	clearHistory()
+
+	var cmd1 dmn.Command
+	cmd1.Set("ls", "list files", ".")
+	cmd1.CmdHash = "abcd1" + cmd1.CmdHash[5:]
+
+	var cmd2 dmn.Command
+	cmd2.Set("pwd", "print working directory", ".")
+	cmd2.CmdHash = "abcd2" + cmd2.CmdHash[5:]
+
+	a.History.OverwriteCmdHistoryFile([]dmn.Command{cmd1, cmd2})
+
+	request := func(route string, prefix string) *httptest.ResponseRecorder {
+		params := make(map[string]string)
+		params["{secret}"] = a.Secret.GetSecret()
+		params["{cmdHash}"] = prefix
+
+		req, _ := http.NewRequest("GET", makeEndpoint(route, params), nil)
+
+		return executeRequest(req)
+	}
+
+	selectRoute := "/secret/{secret}/select/cmdHash/{cmdHash}"
+	deleteRoute := "/secret/{secret}/delete/cmdHash/{cmdHash}"
+
+	response := request(selectRoute, "abcd")
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	var ambiguous struct {
+		Error struct {
+			Code    dmn.ErrorCode `json:"code"`
+			Details struct {
+				Candidates []dmn.Command `json:"candidates"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &ambiguous)
+
+	if ambiguous.Error.Code != dmn.CodeConflict || len(ambiguous.Error.Details.Candidates) != 2 {
+		t.Errorf("Expected a conflict with 2 candidates but got %v", response.Body.String())
+	}
+
+	checkResponseCode(t, http.StatusUnprocessableEntity, request(selectRoute, "ab").Code)
+	checkResponseCode(t, http.StatusNotFound, request(selectRoute, "ffff").Code)
+	checkResponseCode(t, http.StatusOK, request(selectRoute, "abcd1").Code)
+
+	// Nothing is deleted when the prefix is ambiguous
+	checkResponseCode(t, http.StatusConflict, request(deleteRoute, "abcd").Code)
+	checkResponseCode(t, http.StatusNotFound, request(deleteRoute, "ffff").Code)
+
+	cmds, _ := a.History.ReadCmdHistoryFile()
+
+	if len(cmds) != 2 {
+		t.Errorf("Expected 2 commands but got %v", len(cmds))
+	}
+}
+
+func TestListHandlerPagination(t *testing.T) {
+
+	clearHistory()
+
+	var cmds []dmn.Command
+
+	for _, description := range []string{"list files", "print working directory", "show disk usage"} {
+		var cmd dmn.Command
+		cmd.Set(description, description, ".")
+		cmds = append(cmds, cmd)
+	}
+
+	a.History.OverwriteCmdHistoryFile(cmds)
+
+	params := make(map[string]string)
+	params["{secret}"] = a.Secret.GetSecret()
+
+	endpoint := makeEndpoint("/secret/{secret}/list", params)
+
+	req, _ := http.NewRequest("GET", endpoint+"?sort=-description&limit=2", nil)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var page []dmn.Command
+	json.Unmarshal(response.Body.Bytes(), &page)
+
+	if len(page) != 2 || page[0].Description != "show disk usage" || response.Header().Get("X-Total-Count") != "3" {
+		t.Fatalf("Unexpected first page: %v", page)
+	}
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON page but got %v", contentType)
+	}
+
+	req, _ = http.NewRequest("GET", endpoint+"?sort=-description&limit=2&cursor="+response.Header().Get("X-Next-Cursor"), nil)
+	response = executeRequest(req)
+
+	json.Unmarshal(response.Body.Bytes(), &page)
+
+	if len(page) != 1 || page[0].Description != "list files" || response.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("Unexpected last page: %v", page)
+	}
+
+	// The list is not sent again if it has not changed
+	req, _ = http.NewRequest("GET", endpoint, nil)
+	response = executeRequest(req)
+	etag := response.Header().Get("ETag")
+
+	req.Header.Set("If-None-Match", etag)
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusNotModified, response.Code)
+
+	if response.Body.Len() != 0 {
+		t.Errorf("Expected an empty body but got %v", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", endpoint+"?limit=abc", nil)
+	checkResponseCode(t, http.StatusUnprocessableEntity, executeRequest(req).Code)
+
+	// The queue is paged the same way
+	req, _ = http.NewRequest("GET", makeEndpoint("/secret/{secret}/queue", params)+"?limit=2", nil)
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" || response.Header().Get("X-Total-Count") == "" {
+		t.Errorf("Expected a JSON page but got %v", response.Header())
+	}
+}
+
+func TestUserHandlers(t *testing.T) {
+
+	clearHistory()
+
+	request := func(route string, params map[string]string, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", makeEndpoint(route, params)+query, nil)
+		return executeRequest(req)
+	}
+
+	admin := map[string]string{"{secret}": a.Secret.GetSecret(), "{name}": "carol"}
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/add/name/{name}", admin, "").Code)
+
+	response := request("/secret/{secret}/token/add/name/{name}", admin, "?user=carol")
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+
+	carol := map[string]string{
+		"{secret}":           created.Token,
+		"{command}":          "ls",
+		"{description}":      "list files",
+		"{workingDirectory}": ".",
+		"{name}":             "dave",
+	}
+
+	// Users cannot manage other users
+	checkResponseCode(t, http.StatusForbidden, request("/secret/{secret}/user/add/name/{name}", carol, "").Code)
+	checkResponseCode(t, http.StatusForbidden, request("/secret/{secret}/users", carol, "").Code)
+
+	addRoute := "/secret/{secret}/add/command/{command}/description/{description}/workingDirectory/{workingDirectory}"
+	checkResponseCode(t, http.StatusOK, request(addRoute, carol, "").Code)
+
+	// The same command can be saved once in the library of each user
+	checkResponseCode(t, http.StatusConflict, request(addRoute, carol, "").Code)
+
+	root := map[string]string{}
+
+	for key, value := range carol {
+		root[key] = value
+	}
+
+	root["{secret}"] = a.Secret.GetSecret()
+	checkResponseCode(t, http.StatusOK, request(addRoute, root, "").Code)
+	checkResponseCode(t, http.StatusConflict, request(addRoute, root, "?library=team").Code)
+
+	// A Command of the user running the daemon is not in the library of carol
+	var cmd dmn.Command
+	cmd.Set("pwd", "print working directory", ".")
+	a.SaveCmd(cmd)
+
+	response = request("/secret/{secret}/list", carol, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var cmds []dmn.Command
+	json.Unmarshal(response.Body.Bytes(), &cmds)
+
+	if len(cmds) != 1 || cmds[0].Owner != "carol" {
+		t.Errorf("Expected carol to see only their command but got %v", cmds)
+	}
+
+	carol["{cmdHash}"] = cmd.CmdHash
+	checkResponseCode(t, http.StatusNotFound, request("/secret/{secret}/delete/cmdHash/{cmdHash}", carol, "").Code)
+
+	// Nor are its schedules and pipelines
+	s, err := a.AddSchedule(cmd.CmdHash, "@every 1h", dmn.SkipMissedRuns, dmn.AllowOverlap)
+
+	if err != nil {
+		t.Fatalf("Unable to add schedule: %v", err)
+	}
+
+	p, err := a.AddPipeline(dmn.Pipeline{Name: "pwd", Steps: []dmn.PipelineStep{{Name: "pwd", CmdHash: cmd.CmdHash}}})
+
+	if err != nil {
+		t.Fatalf("Unable to add pipeline: %v", err)
+	}
+
+	for _, route := range []string{"/secret/{secret}/schedules", "/secret/{secret}/pipelines"} {
+		response = request(route, carol, "")
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		if response.Body.String() != "[]" {
+			t.Errorf("Expected carol to see nothing at %v but got %v", route, response.Body.String())
+		}
+	}
+
+	carol["{scheduleID}"] = s.ID
+	carol["{pipelineID}"] = p.ID
+	checkResponseCode(t, http.StatusNotFound, request("/secret/{secret}/schedule/pause/scheduleID/{scheduleID}", carol, "").Code)
+	checkResponseCode(t, http.StatusNotFound, request("/secret/{secret}/schedule/delete/scheduleID/{scheduleID}", carol, "").Code)
+	checkResponseCode(t, http.StatusNotFound, request("/secret/{secret}/pipeline/delete/pipelineID/{pipelineID}", carol, "").Code)
+
+	if schedules, _ := a.ListSchedules(); len(schedules) != 1 || schedules[0].Paused {
+		t.Errorf("Expected the schedule to be left alone but got %v", schedules)
+	}
+
+	admin["{scheduleID}"] = s.ID
+	admin["{pipelineID}"] = p.ID
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/schedule/delete/scheduleID/{scheduleID}", admin, "").Code)
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/pipeline/delete/pipelineID/{pipelineID}", admin, "").Code)
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/delete/name/{name}", admin, "").Code)
+	checkResponseCode(t, http.StatusUnauthorized, request("/secret/{secret}/list", carol, "").Code)
+}
+
+func TestRoleHandlers(t *testing.T) {
+
+	clearHistory()
+
+	request := func(route string, params map[string]string, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", makeEndpoint(route, params)+query, nil)
+		return executeRequest(req)
+	}
+
+	token := func(name string, query string) string {
+		admin := map[string]string{"{secret}": a.Secret.GetSecret(), "{name}": name}
+
+		checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/add/name/{name}", admin, query).Code)
+
+		response := request("/secret/{secret}/token/add/name/{name}", admin, "?user="+name)
+
+		var created struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(response.Body.Bytes(), &created)
+
+		return created.Token
+	}
+
+	var db, web dmn.Command
+	db.Set("ls", "list database dumps", ".")
+	db.Tags = []string{"db"}
+	db.Shared = true
+	web.Set("pwd", "print web root", ".")
+	web.Tags = []string{"web"}
+	web.Shared = true
+	a.History.OverwriteCmdHistoryFile([]dmn.Command{db, web})
+
+	viewer := map[string]string{"{secret}": token("erin", "?role=viewer"), "{cmdHash}": db.CmdHash}
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/select/cmdHash/{cmdHash}", viewer, "").Code)
+
+	response := request("/secret/{secret}/delete/cmdHash/{cmdHash}", viewer, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	if !strings.Contains(response.Body.String(), "viewer") {
+		t.Errorf("Expected the role in the error but got %v", response.Body.String())
+	}
+
+	checkResponseCode(t, http.StatusForbidden, request("/secret/{secret}/run/cmdHash/{cmdHash}", viewer, "").Code)
+
+	operator := map[string]string{"{secret}": token("frank", "?role=operator&scope=db"), "{cmdHash}": web.CmdHash}
+
+	checkResponseCode(t, http.StatusForbidden, request("/secret/{secret}/run/cmdHash/{cmdHash}", operator, "").Code)
+
+	operator["{cmdHash}"] = db.CmdHash
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/run/cmdHash/{cmdHash}", operator, "").Code)
+
+	cmds, _ := a.History.ReadCmdHistoryFile()
+
+	if len(cmds) != 2 {
+		t.Errorf("Expected 2 commands but got %v", len(cmds))
+	}
+}
+
+func TestAuditHandlers(t *testing.T) {
+
+	clearHistory()
+
+	request := func(route string, params map[string]string, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", makeEndpoint(route, params)+query, nil)
+		return executeRequest(req)
+	}
+
+	admin := map[string]string{
+		"{secret}":           a.Secret.GetSecret(),
+		"{command}":          "uptime",
+		"{description}":      "show uptime",
+		"{workingDirectory}": ".",
+		"{name}":             "grace",
+	}
+
+	addRoute := "/secret/{secret}/add/command/{command}/description/{description}/workingDirectory/{workingDirectory}"
+	checkResponseCode(t, http.StatusOK, request(addRoute, admin, "").Code)
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/add/name/{name}", admin, "?role=viewer").Code)
+
+	response := request("/secret/{secret}/token/add/name/{name}", admin, "?user=grace")
+
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+
+	grace := map[string]string{"{secret}": created.Token}
+
+	// Viewers cannot read the audit log, and the attempt is recorded
+	checkResponseCode(t, http.StatusForbidden, request("/secret/{secret}/audit", grace, "").Code)
+
+	response = request("/secret/{secret}/audit", admin, "?user=grace&action=denied")
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var entries []dmn.AuditEntry
+	json.Unmarshal(response.Body.Bytes(), &entries)
+
+	if len(entries) != 1 || entries[0].Route != "GET /secret/{secret}/audit" {
+		t.Errorf("Expected the denied attempt to be recorded but got %v", entries)
+	}
+
+	if strings.Contains(response.Body.String(), created.Token) {
+		t.Errorf("Expected the token not to be recorded")
+	}
+
+	response = request("/secret/{secret}/audit", admin, "?action=add")
+	json.Unmarshal(response.Body.Bytes(), &entries)
+
+	if len(entries) == 0 || entries[len(entries)-1].After == nil || entries[len(entries)-1].After.CmdString != "uptime" {
+		t.Errorf("Expected the added command to be recorded but got %v", entries)
+	}
+
+	checkResponseCode(t, http.StatusUnprocessableEntity, request("/secret/{secret}/audit", admin, "?since=yesterday").Code)
+
+	response = request("/secret/{secret}/audit/verify", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	if !strings.Contains(response.Body.String(), `"valid":true`) {
+		t.Errorf("Expected the audit log to be intact but got %v", response.Body.String())
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+
+	clearHistory()
+
+	var cmd dmn.Command
+	cmd.Set("ls", "list files", ".")
+	cmd.Shared = true
+	a.History.OverwriteCmdHistoryFile([]dmn.Command{cmd})
+
+	admin := a.Secret.GetSecret()
+
+	// Requests with a body are posted
+	request := func(route string, params map[string]string, query string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", makeEndpoint(route, params)+query, nil)
+		if body != "" {
+			req, _ = http.NewRequest("POST", makeEndpoint(route, params)+query, strings.NewReader(body))
+		}
+		return executeRequest(req)
+	}
+
+	viewer := map[string]string{"{secret}": admin, "{name}": "heidi"}
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/add/name/{name}", viewer, "?role=viewer", "").Code)
+
+	response := request("/secret/{secret}/token/add/name/{name}", viewer, "?user=heidi", "")
+
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+
+	editor := map[string]string{"{secret}": admin, "{name}": "ivy"}
+
+	checkResponseCode(t, http.StatusOK, request("/secret/{secret}/user/add/name/{name}", editor, "?role=editor", "").Code)
+
+	response = request("/secret/{secret}/token/add/name/{name}", editor, "?user=ivy", "")
+
+	var editorToken struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &editorToken)
+
+	tests := []struct {
+		name   string
+		route  string
+		params map[string]string
+		query  string
+		body   string
+		status int
+		code   dmn.ErrorCode
+	}{
+		{"variable that is not base64", "/secret/!!!/list", nil, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"bad secret", "/secret/{secret}/list", map[string]string{"{secret}": "nope"}, "", "", http.StatusUnauthorized, dmn.CodeUnauthorized},
+		{"viewer deleting a command", "/secret/{secret}/delete/cmdHash/{cmdHash}", map[string]string{"{secret}": created.Token, "{cmdHash}": cmd.CmdHash}, "", "", http.StatusForbidden, dmn.CodeForbidden},
+		{"unknown command", "/secret/{secret}/select/cmdHash/{cmdHash}", map[string]string{"{cmdHash}": "ffff"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"unknown run", "/secret/{secret}/cancel/runID/{runID}", map[string]string{"{runID}": "999999"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"unknown schedule", "/secret/{secret}/schedule/pause/scheduleID/{scheduleID}", map[string]string{"{scheduleID}": "999999"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"unknown pipeline", "/secret/{secret}/pipeline/delete/pipelineID/{pipelineID}", map[string]string{"{pipelineID}": "999999"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"unknown user", "/secret/{secret}/user/delete/name/{name}", map[string]string{"{name}": "nobody"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"command that already exists", "/secret/{secret}/add/command/{command}/description/{description}/workingDirectory/{workingDirectory}", map[string]string{"{command}": "ls", "{description}": "list files again", "{workingDirectory}": "."}, "?library=team", "", http.StatusConflict, dmn.CodeConflict},
+		{"user that already exists", "/secret/{secret}/user/add/name/{name}", map[string]string{"{name}": "heidi"}, "", "", http.StatusConflict, dmn.CodeConflict},
+		{"update that is not JSON", "/secret/{secret}/update/cmdHash/{cmdHash}/update/{update}", map[string]string{"{cmdHash}": cmd.CmdHash, "{update}": "{"}, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"missing working directory", "/secret/{secret}/add/command/{command}/description/{description}/workingDirectory/{workingDirectory}", map[string]string{"{command}": "pwd", "{description}": "print directory", "{workingDirectory}": "/does/not/exist"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"invalid page size", "/secret/{secret}/list", nil, "?limit=abc", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"invalid queue page size", "/secret/{secret}/queue", nil, "?limit=abc", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"viewer of the queue with a bad cursor", "/secret/{secret}/queue", map[string]string{"{secret}": created.Token}, "?cursor=!", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"invalid delay", "/secret/{secret}/run/cmdHash/{cmdHash}/delay/{delay}", map[string]string{"{cmdHash}": cmd.CmdHash, "{delay}": "soon"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"invalid role", "/secret/{secret}/user/add/name/{name}", map[string]string{"{name}": "ivan"}, "?role=boss", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"invalid user name", "/secret/{secret}/user/add/name/{name}", map[string]string{"{name}": "no spaces"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"editor importing a library", "/secret/{secret}/import/format/{format}", map[string]string{"{secret}": editorToken.Token, "{format}": "json"}, "", "[]", http.StatusForbidden, dmn.CodeForbidden},
+		{"import of an unknown format", "/secret/{secret}/import/format/{format}", map[string]string{"{format}": "xml"}, "", "[]", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"import that is not a library", "/secret/{secret}/import/format/{format}", map[string]string{"{format}": "json"}, "", "{", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"import with an unknown strategy", "/secret/{secret}/import/format/{format}", map[string]string{"{format}": "json"}, "?strategy=merge", "[]", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"export of an unknown format", "/secret/{secret}/export/format/{format}", map[string]string{"{format}": "xml"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"viewer synchronising the library", "/secret/{secret}/sync", map[string]string{"{secret}": created.Token}, "", "", http.StatusForbidden, dmn.CodeForbidden},
+		{"sync without a library", "/secret/{secret}/sync", nil, "", "", http.StatusConflict, dmn.CodeConflict},
+		{"sandbox settings that are not JSON", "/secret/{secret}/sandbox/cmdHash/{cmdHash}/settings/{sandbox}", map[string]string{"{cmdHash}": cmd.CmdHash, "{sandbox}": "{"}, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"sandbox of an unknown command", "/secret/{secret}/sandbox/cmdHash/{cmdHash}/settings/{sandbox}", map[string]string{"{cmdHash}": "ffff", "{sandbox}": "{}"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"retry policy that is not JSON", "/secret/{secret}/retry/cmdHash/{cmdHash}/policy/{retryPolicy}", map[string]string{"{cmdHash}": cmd.CmdHash, "{retryPolicy}": "{"}, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"invalid concurrency policy", "/secret/{secret}/concurrency/cmdHash/{cmdHash}/policy/{concurrencyPolicy}", map[string]string{"{cmdHash}": cmd.CmdHash, "{concurrencyPolicy}": "sometimes"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"concurrency policy of an unknown command", "/secret/{secret}/concurrency/cmdHash/{cmdHash}/policy/{concurrencyPolicy}", map[string]string{"{cmdHash}": "ffff", "{concurrencyPolicy}": "allow"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"invalid priority", "/secret/{secret}/priority/cmdHash/{cmdHash}/priority/{priority}", map[string]string{"{cmdHash}": cmd.CmdHash, "{priority}": "urgent"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"exec settings that are not JSON", "/secret/{secret}/settings/cmdHash/{cmdHash}/execSettings/{execSettings}", map[string]string{"{cmdHash}": cmd.CmdHash, "{execSettings}": "{"}, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"viewer changing exec settings", "/secret/{secret}/settings/cmdHash/{cmdHash}/execSettings/{execSettings}", map[string]string{"{secret}": created.Token, "{cmdHash}": cmd.CmdHash, "{execSettings}": "{}"}, "", "", http.StatusForbidden, dmn.CodeForbidden},
+		{"search grouped by an unknown field", "/secret/{secret}/search/description/{description}", map[string]string{"{description}": "list"}, "?groupBy=color", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"query that does not parse", "/secret/{secret}/search/query/{query}", map[string]string{"{query}": "(ls"}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"viewer listing the tokens of another user", "/secret/{secret}/tokens", map[string]string{"{secret}": created.Token}, "?user=ivy", "", http.StatusForbidden, dmn.CodeForbidden},
+		{"unknown token", "/secret/{secret}/token/delete/tokenID/{tokenID}", map[string]string{"{tokenID}": "999999"}, "?user=heidi", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"pipeline that is not JSON", "/secret/{secret}/pipeline/add/pipeline/{pipeline}", map[string]string{"{pipeline}": "{"}, "", "", http.StatusBadRequest, dmn.CodeBadRequest},
+		{"pipeline with an unknown step", "/secret/{secret}/pipeline/add/pipeline/{pipeline}", map[string]string{"{pipeline}": `{"name":"p","steps":[{"name":"a","cmdHash":"ffff"}]}`}, "", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+		{"run of an unknown pipeline", "/secret/{secret}/pipeline/run/pipelineID/{pipelineID}", map[string]string{"{pipelineID}": "999999"}, "", "", http.StatusNotFound, dmn.CodeNotFound},
+		{"editor reading the audit log", "/secret/{secret}/audit", map[string]string{"{secret}": editorToken.Token}, "", "", http.StatusForbidden, dmn.CodeForbidden},
+		{"invalid audit query", "/secret/{secret}/audit", nil, "?since=yesterday", "", http.StatusUnprocessableEntity, dmn.CodeInvalid},
+	}
+
+	for _, test := range tests {
+
+		params := map[string]string{"{secret}": admin}
+
+		for key, value := range test.params {
+			params[key] = value
+		}
+
+		response := request(test.route, params, test.query, test.body)
+
+		if response.Code != test.status {
+			t.Errorf("%v: expected response code %v but got %v", test.name, test.status, response.Code)
+			continue
+		}
+
+		if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%v: expected a JSON error but got %v", test.name, contentType)
+		}
+
+		var body dmn.ErrorResponse
+
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil || body.Error.Code != test.code || body.Error.Message == "" {
+			t.Errorf("%v: expected error code %v but got %v", test.name, test.code, response.Body.String())
+		}
+	}
+}
+
+func TestRunLaterLimit(t *testing.T) {
+
+	clearHistory()
+
+	var cmd dmn.Command
+	cmd.Set("ls", "list files", ".")
+	a.History.OverwriteCmdHistoryFile([]dmn.Command{cmd})
+
+	a.Settings.Limits.MaxConcurrentRuns = 2
+	defer func() { a.Settings.Limits.MaxConcurrentRuns = dmn.DefaultMaxConcurrentRuns }()
+
+	params := map[string]string{"{secret}": a.Secret.GetSecret(), "{cmdHash}": cmd.CmdHash, "{delay}": "1h"}
+
+	runLater := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", makeEndpoint("/secret/{secret}/run/cmdHash/{cmdHash}/delay/{delay}", params), nil)
+		return executeRequest(req)
+	}
+
+	runIDs := []string{}
+
+	// Pending runs count against the limit until they start or are cancelled
+	for i := 0; i < 2; i++ {
+		response := runLater()
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var run dmn.PendingRun
+		json.Unmarshal(response.Body.Bytes(), &run)
+		runIDs = append(runIDs, run.ID)
+	}
+
+	response := runLater()
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+
+	if response.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+
+	cancel := func(runID string) {
+		req, _ := http.NewRequest("GET", makeEndpoint("/secret/{secret}/cancel/runID/{runID}", map[string]string{"{secret}": a.Secret.GetSecret(), "{runID}": runID}), nil)
+		checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	}
+
+	cancel(runIDs[0])
+
+	response = runLater()
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var run dmn.PendingRun
+	json.Unmarshal(response.Body.Bytes(), &run)
+
+	for _, runID := range []string{runIDs[1], run.ID} {
+		cancel(runID)
+	}
+}